@@ -0,0 +1,189 @@
+package aria2
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"kinozal-bot/bencode"
+	"kinozal-bot/config"
+	"kinozal-bot/downloader"
+	"kinozal-bot/errors"
+)
+
+// Client передает загрузки в aria2 через JSON-RPC
+type Client struct {
+	cfg  *config.Config
+	http *http.Client
+
+	requestID int64 // номер последнего запроса, увеличивается атомарно
+}
+
+// New создает клиент aria2 по настройкам из конфигурации
+func New(cfg *config.Config) *Client {
+	return &Client{
+		cfg:  cfg,
+		http: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Name возвращает название клиента для сообщений пользователю
+func (c *Client) Name() string {
+	return "aria2"
+}
+
+// AddFile добавляет торрент в aria2 в папку категории и возвращает его хеш.
+// aria2 не поддерживает приоритеты файлов, поэтому учитываются только пропущенные файлы.
+func (c *Client) AddFile(content []byte, category config.Category, files downloader.FileChoice) (string, error) {
+	options := addOptions(category)
+	if len(files.Unwanted) > 0 {
+		selected, err := selectFiles(content, files)
+		if err != nil {
+			return "", err
+		}
+		options["select-file"] = selected
+	}
+
+	var gid string
+	metainfo := base64.StdEncoding.EncodeToString(content)
+	if err := c.call("aria2.addTorrent", []interface{}{metainfo, []string{}, options}, &gid); err != nil {
+		return "", err
+	}
+	return c.infoHash(gid)
+}
+
+// AddMagnet добавляет торрент в aria2 по magnet-ссылке и возвращает его хеш
+func (c *Client) AddMagnet(link string, category config.Category) (string, error) {
+	var gid string
+	if err := c.call("aria2.addUri", []interface{}{[]string{link}, addOptions(category)}, &gid); err != nil {
+		return "", err
+	}
+	return c.infoHash(gid)
+}
+
+// FreeSpace не поддерживается: aria2 не сообщает свободное место на диске, и проверка пропускается
+func (c *Client) FreeSpace(path string) (int64, error) {
+	return 0, errors.NewDownloadClientError("aria2 does not report free disk space", map[string]interface{}{
+		"path": path,
+	})
+}
+
+// addOptions возвращает параметры загрузки с папкой и настройками категории.
+// Все значения параметров aria2 передаются строками.
+func addOptions(category config.Category) map[string]string {
+	options := map[string]string{
+		"dir": category.Path,
+	}
+	if category.DownloadLimit > 0 {
+		options["max-download-limit"] = strconv.FormatInt(category.DownloadLimit, 10) + "K"
+	}
+	if category.UploadLimit > 0 {
+		options["max-upload-limit"] = strconv.FormatInt(category.UploadLimit, 10) + "K"
+	}
+	if category.SeedRatio > 0 {
+		options["seed-ratio"] = strconv.FormatFloat(category.SeedRatio, 'f', -1, 64)
+	}
+	return options
+}
+
+// infoHash возвращает инфо-хеш загрузки по ее GID
+func (c *Client) infoHash(gid string) (string, error) {
+	var status struct {
+		InfoHash string `json:"infoHash"`
+	}
+	if err := c.call("aria2.tellStatus", []interface{}{gid, []string{"infoHash"}}, &status); err != nil {
+		return "", err
+	}
+	return strings.ToLower(status.InfoHash), nil
+}
+
+// selectFiles возвращает значение параметра select-file: номера загружаемых файлов, начиная с 1
+func selectFiles(content []byte, files downloader.FileChoice) (string, error) {
+	meta, err := bencode.ParseMetainfo(content)
+	if err != nil {
+		return "", errors.NewDownloadClientError("Invalid torrent file", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	unwanted := make(map[int64]bool, len(files.Unwanted))
+	for _, index := range files.Unwanted {
+		unwanted[index] = true
+	}
+
+	var selected []int
+	for index := range meta.Files {
+		if !unwanted[int64(index)] {
+			selected = append(selected, index+1)
+		}
+	}
+	if len(selected) == 0 {
+		return "", errors.NewDownloadClientError("No files selected for download", nil)
+	}
+
+	parts := make([]string, len(selected))
+	for i, number := range selected {
+		parts[i] = strconv.Itoa(number)
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// rpcError — ошибка, которую вернул метод JSON-RPC
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// call вызывает метод JSON-RPC aria2 и разбирает результат в result.
+// Секрет RPC передается первым параметром в виде "token:<секрет>".
+func (c *Client) call(method string, params []interface{}, result interface{}) error {
+	if c.cfg.Aria2.Secret != "" {
+		params = append([]interface{}{"token:" + c.cfg.Aria2.Secret}, params...)
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      strconv.FormatInt(atomic.AddInt64(&c.requestID, 1), 10),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.http.Post(c.cfg.Aria2.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.NewDownloadClientError("Failed to connect to aria2", map[string]interface{}{
+			"method": method,
+			"error":  err.Error(),
+		})
+	}
+	defer resp.Body.Close()
+
+	// aria2 отвечает на ошибки метода статусом 400 с описанием в поле error
+	var answer struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return errors.NewDownloadClientError("Invalid response from aria2", map[string]interface{}{
+			"method": method,
+			"status": resp.StatusCode,
+			"error":  err.Error(),
+		})
+	}
+	if answer.Error != nil {
+		return errors.NewDownloadClientError("aria2 rejected the request", map[string]interface{}{
+			"method": method,
+			"code":   answer.Error.Code,
+			"error":  answer.Error.Message,
+		})
+	}
+	if result == nil || len(answer.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(answer.Result, result)
+}
@@ -0,0 +1,229 @@
+package aria2
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"kinozal-bot/downloader"
+	"kinozal-bot/errors"
+	"kinozal-bot/logger"
+)
+
+// listLimit — сколько ожидающих и завершенных загрузок запрашивается у aria2
+const listLimit = 1000
+
+// statusKeys — поля, запрашиваемые у aria2 для TorrentInfo
+var statusKeys = []string{
+	"gid", "status", "infoHash", "dir", "totalLength", "completedLength", "uploadLength",
+	"downloadSpeed", "uploadSpeed", "connections", "errorMessage", "followedBy", "bittorrent",
+}
+
+// download — состояние загрузки из ответа aria2. Числа aria2 передает строками.
+type download struct {
+	GID             string   `json:"gid"`
+	Status          string   `json:"status"`
+	InfoHash        string   `json:"infoHash"`
+	Dir             string   `json:"dir"`
+	TotalLength     string   `json:"totalLength"`
+	CompletedLength string   `json:"completedLength"`
+	UploadLength    string   `json:"uploadLength"`
+	DownloadSpeed   string   `json:"downloadSpeed"`
+	UploadSpeed     string   `json:"uploadSpeed"`
+	Connections     string   `json:"connections"`
+	ErrorMessage    string   `json:"errorMessage"`
+	FollowedBy      []string `json:"followedBy"`
+	BitTorrent      struct {
+		Info struct {
+			Name string `json:"name"`
+		} `json:"info"`
+	} `json:"bittorrent"`
+}
+
+// List возвращает состояние торрентов с указанными хешами.
+// Если хеши не указаны, возвращаются все торренты.
+func (c *Client) List(hashes []string) ([]downloader.TorrentInfo, error) {
+	downloads, err := c.downloads()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		wanted[strings.ToLower(hash)] = true
+	}
+
+	infos := make([]downloader.TorrentInfo, 0, len(downloads))
+	for hash, d := range downloads {
+		if len(hashes) == 0 || wanted[hash] {
+			infos = append(infos, toTorrentInfo(d))
+		}
+	}
+	return infos, nil
+}
+
+// Get возвращает состояние торрента по хешу
+func (c *Client) Get(hash string) (*downloader.TorrentInfo, error) {
+	d, err := c.find(hash)
+	if err != nil {
+		return nil, err
+	}
+	info := toTorrentInfo(d)
+	return &info, nil
+}
+
+// Pause ставит торрент на паузу
+func (c *Client) Pause(hash string) error {
+	d, err := c.find(hash)
+	if err != nil {
+		return err
+	}
+	return c.call("aria2.pause", []interface{}{d.GID}, nil)
+}
+
+// Resume возобновляет загрузку торрента
+func (c *Client) Resume(hash string) error {
+	d, err := c.find(hash)
+	if err != nil {
+		return err
+	}
+	return c.call("aria2.unpause", []interface{}{d.GID}, nil)
+}
+
+// Remove удаляет торрент из aria2. aria2 не удаляет загруженные файлы сам, поэтому
+// при deleteData бот удаляет их, если папка загрузок доступна ему по тому же пути.
+func (c *Client) Remove(hash string, deleteData bool) error {
+	d, err := c.find(hash)
+	if err != nil {
+		return err
+	}
+
+	var files []struct {
+		Path string `json:"path"`
+	}
+	if deleteData {
+		if err := c.call("aria2.getFiles", []interface{}{d.GID}, &files); err != nil {
+			return err
+		}
+	}
+
+	// Активную загрузку сначала останавливаем, затем удаляем ее результат из списка
+	if d.Status == "active" || d.Status == "waiting" || d.Status == "paused" {
+		if err := c.call("aria2.remove", []interface{}{d.GID}, nil); err != nil {
+			return err
+		}
+	}
+	if err := c.call("aria2.removeDownloadResult", []interface{}{d.GID}, nil); err != nil {
+		logger.Warn("Failed to remove aria2 download result", map[string]interface{}{
+			"gid":   d.GID,
+			"error": err.Error(),
+		})
+	}
+
+	for _, file := range files {
+		if file.Path == "" {
+			continue
+		}
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			logger.Warn("Failed to delete downloaded file", map[string]interface{}{
+				"path":  file.Path,
+				"error": err.Error(),
+			})
+		}
+	}
+	// Папка многофайлового торрента удаляется, только если в ней ничего не осталось
+	if len(files) > 0 && d.BitTorrent.Info.Name != "" {
+		os.Remove(filepath.Join(d.Dir, d.BitTorrent.Info.Name))
+	}
+	return nil
+}
+
+// find возвращает загрузку торрента по хешу
+func (c *Client) find(hash string) (download, error) {
+	downloads, err := c.downloads()
+	if err != nil {
+		return download{}, err
+	}
+	d, ok := downloads[strings.ToLower(hash)]
+	if !ok {
+		return download{}, errors.NewDownloadClientError("Torrent not found in aria2", map[string]interface{}{
+			"hash": hash,
+		})
+	}
+	return d, nil
+}
+
+// downloads возвращает торрент-загрузки aria2 по инфо-хешу. Загрузка метаданных по magnet-ссылке
+// и сама загрузка торрента имеют один хеш; в этом случае остается загрузка торрента.
+func (c *Client) downloads() (map[string]download, error) {
+	var active, waiting, stopped []download
+	if err := c.call("aria2.tellActive", []interface{}{statusKeys}, &active); err != nil {
+		return nil, err
+	}
+	if err := c.call("aria2.tellWaiting", []interface{}{0, listLimit, statusKeys}, &waiting); err != nil {
+		return nil, err
+	}
+	if err := c.call("aria2.tellStopped", []interface{}{0, listLimit, statusKeys}, &stopped); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]download)
+	for _, list := range [][]download{active, waiting, stopped} {
+		for _, d := range list {
+			if d.InfoHash == "" || d.Status == "removed" {
+				continue
+			}
+			hash := strings.ToLower(d.InfoHash)
+			if existing, ok := result[hash]; ok && len(existing.FollowedBy) == 0 {
+				continue
+			}
+			result[hash] = d
+		}
+	}
+	return result, nil
+}
+
+// toTorrentInfo переводит состояние загрузки aria2 в TorrentInfo
+func toTorrentInfo(d download) downloader.TorrentInfo {
+	total := parseInt(d.TotalLength)
+	completed := parseInt(d.CompletedLength)
+	uploaded := parseInt(d.UploadLength)
+	speed := parseInt(d.DownloadSpeed)
+
+	info := downloader.TorrentInfo{
+		Hash:           strings.ToLower(d.InfoHash),
+		Name:           d.BitTorrent.Info.Name,
+		DownloadDir:    d.Dir,
+		Status:         d.Status,
+		ETA:            -1,
+		RateDownload:   speed,
+		RateUpload:     parseInt(d.UploadSpeed),
+		PeersConnected: parseInt(d.Connections),
+		TotalSize:      total,
+		Stopped:        d.Status == "paused",
+	}
+	if total > 0 {
+		info.PercentDone = float64(completed) / float64(total)
+	}
+	if d.Status == "complete" {
+		info.PercentDone = 1
+	}
+	if completed > 0 {
+		info.UploadRatio = float64(uploaded) / float64(completed)
+	}
+	if speed > 0 && total > completed {
+		info.ETA = time.Duration((total-completed)/speed) * time.Second
+	}
+	if d.Status == "error" {
+		info.ErrorString = d.ErrorMessage
+	}
+	return info
+}
+
+// parseInt разбирает число, переданное aria2 строкой; при ошибке возвращает 0
+func parseInt(value string) int64 {
+	n, _ := strconv.ParseInt(value, 10, 64)
+	return n
+}
@@ -0,0 +1,294 @@
+package bencode
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sampleInfoHash — SHA-1 словаря info из testdata/sample.torrent, посчитанный sha1sum
+// по байтам словаря, вырезанным из файла, без участия этого пакета
+const sampleInfoHash = "c365f0c86634937c6d1beb87172a6c86ca4c30a0"
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		data  string
+	}{
+		{"zero", int64(0), "i0e"},
+		{"positive", int64(42), "i42e"},
+		{"negative", int64(-7), "i-7e"},
+		{"empty string", "", "0:"},
+		{"string", "spam", "4:spam"},
+		{"utf-8 string", "Дюна", "8:Дюна"},
+		{"binary string", "\x00\xff:e", "4:\x00\xff:e"},
+		{"empty list", []interface{}{}, "le"},
+		{"list", []interface{}{"spam", int64(1)}, "l4:spami1ee"},
+		{"empty dict", map[string]interface{}{}, "de"},
+		{"dict", map[string]interface{}{"cow": "moo", "spam": "eggs"}, "d3:cow3:moo4:spam4:eggse"},
+		{
+			"nested",
+			map[string]interface{}{"a": []interface{}{map[string]interface{}{"b": int64(1)}, []interface{}{}}},
+			"d1:ald1:bi1eeleee",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := Encode(tt.value)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if string(encoded) != tt.data {
+				t.Errorf("Encode = %q, want %q", encoded, tt.data)
+			}
+
+			decoded, err := Decode([]byte(tt.data))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.value) {
+				t.Errorf("Decode = %#v, want %#v", decoded, tt.value)
+			}
+		})
+	}
+}
+
+func TestEncodeSortsKeys(t *testing.T) {
+	encoded, err := Encode(map[string]interface{}{"zeta": 1, "alpha": 2, "Beta": 3, "a": 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d4:Betai3e1:ai4e5:alphai2e4:zetai1ee"; string(encoded) != want {
+		t.Errorf("Encode = %q, want %q", encoded, want)
+	}
+}
+
+func TestEncodeConvenienceTypes(t *testing.T) {
+	encoded, err := Encode(map[string]interface{}{"n": 5, "b": []byte("xy"), "l": []string{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d1:b2:xy1:ll1:a1:be1:ni5ee"; string(encoded) != want {
+		t.Errorf("Encode = %q, want %q", encoded, want)
+	}
+	if _, err := Encode(3.14); err == nil {
+		t.Error("Encode(float) returned no error")
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"unknown type", "x"},
+		{"truncated string", "5:spam"},
+		{"string without colon", "4spam"},
+		{"negative string length", "-1:a"},
+		{"huge string length", "99999999999999999999:a"},
+		{"unterminated integer", "i42"},
+		{"empty integer", "ie"},
+		{"leading zero integer", "i03e"},
+		{"negative zero", "i-0e"},
+		{"negative leading zero", "i-03e"},
+		{"integer overflow", "i99999999999999999999e"},
+		{"not a number", "i4x2e"},
+		{"unterminated list", "l4:spam"},
+		{"unterminated dict", "d3:cow3:moo"},
+		{"dict without value", "d3:cowe"},
+		{"non-string key", "di1e3:mooe"},
+		{"trailing data", "i1ei2e"},
+		{"too deep list", strings.Repeat("l", maxDepth+1) + strings.Repeat("e", maxDepth+1)},
+		{"too deep dict", strings.Repeat("d1:a", maxDepth+1) + "i1e" + strings.Repeat("e", maxDepth+1)},
+		{"very deep unterminated", strings.Repeat("l", 1<<20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("Decode panicked: %v", r)
+				}
+			}()
+			if value, err := Decode([]byte(tt.data)); err == nil {
+				t.Errorf("Decode(%q) = %#v, want error", tt.data, value)
+			}
+		})
+	}
+}
+
+func TestDecodeNonCanonicalKeys(t *testing.T) {
+	value, err := Decode([]byte("d4:spam4:eggs3:cow3:moo3:cow3:baae"))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	want := map[string]interface{}{"spam": "eggs", "cow": "baa"}
+	if !reflect.DeepEqual(value, want) {
+		t.Errorf("Decode = %#v, want %#v", value, want)
+	}
+}
+
+// TestUnsortedMetainfo проверяет, что торрент с ключами не по порядку вне и внутри info
+// разбирается, а инфо-хеш считается по исходным байтам
+func TestUnsortedMetainfo(t *testing.T) {
+	info := "d4:name4:file6:lengthi5e12:piece lengthi16384e6:pieces20:" + strings.Repeat("x", 20) + "e"
+	data := []byte("d4:info" + info + "8:announce15:http://tracker/7:comment2:hie")
+
+	meta, err := ParseMetainfo(data)
+	if err != nil {
+		t.Fatalf("ParseMetainfo: %v", err)
+	}
+	if meta.Name != "file" || meta.TotalSize() != 5 {
+		t.Errorf("unexpected metainfo %+v", meta)
+	}
+
+	sum := sha1.Sum([]byte(info))
+	if want := hex.EncodeToString(sum[:]); meta.InfoHash != want {
+		t.Errorf("InfoHash = %s, want %s", meta.InfoHash, want)
+	}
+	if hash, _ := InfoHash(data); hash != meta.InfoHash {
+		t.Errorf("InfoHash = %s, Metainfo.InfoHash = %s", hash, meta.InfoHash)
+	}
+
+	// Тот же образец с info в начале словаря вместо конца дает прежний инфо-хеш
+	sample := loadSample(t)
+	raw, err := RawInfo(sample)
+	if err != nil {
+		t.Fatal(err)
+	}
+	infoKey := bytes.Index(sample, []byte("4:info"))
+	reordered := append([]byte("d4:info"), raw...)
+	reordered = append(reordered, sample[1:infoKey]...)
+	reordered = append(reordered, 'e')
+	meta, err = ParseMetainfo(reordered)
+	if err != nil {
+		t.Fatalf("ParseMetainfo of reordered sample: %v", err)
+	}
+	if meta.InfoHash != sampleInfoHash || len(meta.Trackers) != 2 {
+		t.Errorf("reordered sample: InfoHash %s, trackers %v", meta.InfoHash, meta.Trackers)
+	}
+}
+
+func TestDecodeMaxDepth(t *testing.T) {
+	data := strings.Repeat("l", maxDepth) + strings.Repeat("e", maxDepth)
+	if _, err := Decode([]byte(data)); err != nil {
+		t.Errorf("Decode of %d nested lists: %v", maxDepth, err)
+	}
+}
+
+func TestDecodeTruncatedPrefixes(t *testing.T) {
+	data := loadSample(t)
+	for i := 0; i < len(data); i++ {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("Decode of %d-byte prefix panicked: %v", i, r)
+				}
+			}()
+			if _, err := Decode(data[:i]); err == nil {
+				t.Fatalf("Decode of %d-byte prefix returned no error", i)
+			}
+			InfoHash(data[:i])
+			ParseMetainfo(data[:i])
+		}()
+	}
+}
+
+func loadSample(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/sample.torrent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestInfoHashKnownVector(t *testing.T) {
+	data := loadSample(t)
+
+	hash, err := InfoHash(data)
+	if err != nil {
+		t.Fatalf("InfoHash: %v", err)
+	}
+	if hash != sampleInfoHash {
+		t.Errorf("InfoHash = %s, want %s", hash, sampleInfoHash)
+	}
+
+	meta, err := ParseMetainfo(data)
+	if err != nil {
+		t.Fatalf("ParseMetainfo: %v", err)
+	}
+	if meta.InfoHash != sampleInfoHash {
+		t.Errorf("Metainfo.InfoHash = %s, want %s", meta.InfoHash, sampleInfoHash)
+	}
+}
+
+func TestInfoHashUsesOriginalBytes(t *testing.T) {
+	data := loadSample(t)
+	raw, err := RawInfo(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(raw, []byte("d5:filesl")) || raw[len(raw)-1] != 'e' {
+		t.Errorf("RawInfo returned %q...", raw[:20])
+	}
+
+	// Повторное кодирование разобранного словаря дает те же байты
+	value, err := Decode(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := Encode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, raw) {
+		t.Error("re-encoded info dictionary differs from the original bytes")
+	}
+
+	// Поля вне info не влияют на хеш
+	changed := bytes.Replace(data, []byte("uTorrent/2210"), []byte("qBittorrent/4"), 1)
+	if hash, _ := InfoHash(changed); hash != sampleInfoHash {
+		t.Errorf("InfoHash changed with metadata outside info: %s", hash)
+	}
+}
+
+func TestInfoHashErrors(t *testing.T) {
+	tests := map[string]string{
+		"not a dict":      "l4:infoe",
+		"no info":         "d8:announce3:urle",
+		"info not a dict": "d4:info4:spame",
+		"truncated info":  "d4:infod4:name",
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if hash, err := InfoHash([]byte(data)); err == nil {
+				t.Errorf("InfoHash = %s, want error", hash)
+			}
+		})
+	}
+}
+
+func TestParseMetainfo(t *testing.T) {
+	meta, err := ParseMetainfo(loadSample(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.Name != "Сериал (2024) WEB-DL 1080p" || !meta.MultiFile || meta.PieceLength != 32768 {
+		t.Errorf("unexpected metainfo %+v", meta)
+	}
+	if len(meta.Files) != 2 || meta.Files[1].Name() != "Season 1/Субтитры.srt" || meta.TotalSize() != 33768 {
+		t.Errorf("unexpected files %+v", meta.Files)
+	}
+	wantTrackers := []string{"http://tr0.kinozal.example/announce.php", "http://retracker.local/announce"}
+	if !reflect.DeepEqual(meta.Trackers, wantTrackers) {
+		t.Errorf("trackers = %v, want %v", meta.Trackers, wantTrackers)
+	}
+}
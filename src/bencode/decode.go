@@ -0,0 +1,199 @@
+package bencode
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// Decode разбирает bencode-значение. Результат имеет один из типов:
+// int64, string, []interface{} или map[string]interface{}.
+func Decode(data []byte) (interface{}, error) {
+	d := &decoder{data: data}
+	value, err := d.value()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, d.errorf("unexpected data after value")
+	}
+	return value, nil
+}
+
+// InfoHash возвращает SHA-1 хеш (v1) словаря info из метаинформации торрента
+// в шестнадцатеричном виде в нижнем регистре. Хешируются исходные байты словаря,
+// поэтому результат совпадает с хешем, который вычисляют торрент-клиенты.
+func InfoHash(data []byte) (string, error) {
+	raw, err := RawInfo(data)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// RawInfo возвращает исходные байты словаря info из метаинформации торрента
+func RawInfo(data []byte) ([]byte, error) {
+	d := &decoder{data: data}
+	if !d.consume('d') {
+		return nil, d.errorf("metainfo must be a dictionary")
+	}
+	for !d.consume('e') {
+		key, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		start := d.pos
+		value, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		if key == "info" {
+			if _, ok := value.(map[string]interface{}); !ok {
+				return nil, d.errorf("info must be a dictionary")
+			}
+			return d.data[start:d.pos], nil
+		}
+	}
+	return nil, fmt.Errorf("bencode: metainfo has no info dictionary")
+}
+
+// maxDepth ограничивает вложенность списков и словарей, чтобы испорченный файл
+// не исчерпал стек рекурсией
+const maxDepth = 64
+
+// decoder последовательно читает bencode-значения из буфера
+type decoder struct {
+	data  []byte
+	pos   int
+	depth int // текущая вложенность списков и словарей
+}
+
+// value читает очередное значение любого типа
+func (d *decoder) value() (interface{}, error) {
+	if d.pos >= len(d.data) {
+		return nil, d.errorf("unexpected end of data")
+	}
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		return d.integer()
+	case c == 'l':
+		return d.list()
+	case c == 'd':
+		return d.dict()
+	case c >= '0' && c <= '9':
+		return d.string()
+	default:
+		return nil, d.errorf("unexpected character %q", c)
+	}
+}
+
+// integer читает число вида i<число>e
+func (d *decoder) integer() (int64, error) {
+	d.pos++ // 'i'
+	end := bytes.IndexByte(d.data[d.pos:], 'e')
+	if end < 0 {
+		return 0, d.errorf("unterminated integer")
+	}
+	text := string(d.data[d.pos : d.pos+end])
+	// Ведущие нули и "-0" запрещены спецификацией
+	if text == "" || text == "-0" || (len(text) > 1 && text[0] == '0') || (len(text) > 2 && text[:2] == "-0") {
+		return 0, d.errorf("invalid integer %q", text)
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return 0, d.errorf("invalid integer %q", text)
+	}
+	d.pos += end + 1
+	return n, nil
+}
+
+// string читает строку вида <длина>:<байты>
+func (d *decoder) string() (string, error) {
+	colon := bytes.IndexByte(d.data[d.pos:], ':')
+	if colon < 0 {
+		return "", d.errorf("unterminated string length")
+	}
+	length, err := strconv.Atoi(string(d.data[d.pos : d.pos+colon]))
+	if err != nil || length < 0 {
+		return "", d.errorf("invalid string length")
+	}
+	start := d.pos + colon + 1
+	if length > len(d.data)-start {
+		return "", d.errorf("string is longer than data")
+	}
+	d.pos = start + length
+	return string(d.data[start:d.pos]), nil
+}
+
+// enter увеличивает вложенность перед чтением списка или словаря
+func (d *decoder) enter() error {
+	if d.depth >= maxDepth {
+		return d.errorf("nesting is deeper than %d", maxDepth)
+	}
+	d.depth++
+	return nil
+}
+
+// list читает список вида l<значения>e
+func (d *decoder) list() ([]interface{}, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { d.depth-- }()
+	d.pos++ // 'l'
+	list := []interface{}{}
+	for !d.consume('e') {
+		value, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+// dict читает словарь вида d<ключ><значение>...e. Ключи по спецификации идут по возрастанию,
+// но торрент-клиенты принимают и файлы с другим порядком, поэтому он не проверяется;
+// из повторяющихся ключей остается последнее значение. Инфо-хеш от этого не зависит:
+// он считается по исходным байтам словаря info.
+func (d *decoder) dict() (map[string]interface{}, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { d.depth-- }()
+	d.pos++ // 'd'
+	dict := make(map[string]interface{})
+	for !d.consume('e') {
+		if d.pos < len(d.data) && (d.data[d.pos] < '0' || d.data[d.pos] > '9') {
+			return nil, d.errorf("dictionary key must be a string")
+		}
+		key, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		value, err := d.value()
+		if err != nil {
+			return nil, err
+		}
+		dict[key] = value
+	}
+	return dict, nil
+}
+
+// consume пропускает символ c, если он следующий в буфере. В конце данных
+// возвращает false, чтобы циклы чтения списков и словарей завершились ошибкой.
+func (d *decoder) consume(c byte) bool {
+	if d.pos < len(d.data) && d.data[d.pos] == c {
+		d.pos++
+		return true
+	}
+	return false
+}
+
+// errorf возвращает ошибку разбора с позицией в данных
+func (d *decoder) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("bencode: %s at offset %d", fmt.Sprintf(format, args...), d.pos)
+}
@@ -0,0 +1,79 @@
+package bencode
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Encode кодирует значение в bencode. Поддерживаются целые числа, строки, []byte,
+// списки ([]interface{}, []string) и словари (map[string]interface{}).
+// Ключи словарей записываются в отсортированном порядке, как требует спецификация.
+func Encode(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encodeValue(&buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeValue записывает значение в буфер
+func encodeValue(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case int:
+		encodeInt(buf, int64(v))
+	case int64:
+		encodeInt(buf, v)
+	case string:
+		encodeString(buf, v)
+	case []byte:
+		encodeString(buf, string(v))
+	case []string:
+		buf.WriteByte('l')
+		for _, item := range v {
+			encodeString(buf, item)
+		}
+		buf.WriteByte('e')
+	case []interface{}:
+		buf.WriteByte('l')
+		for _, item := range v {
+			if err := encodeValue(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('d')
+		for _, key := range keys {
+			encodeString(buf, key)
+			if err := encodeValue(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('e')
+	default:
+		return fmt.Errorf("bencode: unsupported type %T", value)
+	}
+	return nil
+}
+
+// encodeInt записывает число вида i<число>e
+func encodeInt(buf *bytes.Buffer, n int64) {
+	buf.WriteByte('i')
+	buf.WriteString(strconv.FormatInt(n, 10))
+	buf.WriteByte('e')
+}
+
+// encodeString записывает строку вида <длина>:<байты>
+func encodeString(buf *bytes.Buffer, s string) {
+	buf.WriteString(strconv.Itoa(len(s)))
+	buf.WriteByte(':')
+	buf.WriteString(s)
+}
@@ -0,0 +1,164 @@
+package bencode
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// File — файл торрента. Path задан относительно корневой папки торрента;
+// у однофайлового торрента он состоит из одного имени файла.
+type File struct {
+	Path   []string
+	Length int64
+}
+
+// Name возвращает путь к файлу через "/"
+func (f File) Name() string {
+	return strings.Join(f.Path, "/")
+}
+
+// Metainfo — сведения из .torrent-файла
+type Metainfo struct {
+	Name        string
+	PieceLength int64
+	Files       []File
+	Trackers    []string
+	InfoHash    string // SHA-1 словаря info в нижнем регистре
+	MultiFile   bool   // файлы лежат в папке Name
+}
+
+// TotalSize возвращает суммарный размер файлов торрента
+func (m *Metainfo) TotalSize() int64 {
+	var total int64
+	for _, file := range m.Files {
+		total += file.Length
+	}
+	return total
+}
+
+// LoadMetainfo читает и разбирает .torrent-файл
+func LoadMetainfo(path string) (*Metainfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMetainfo(data)
+}
+
+// ParseMetainfo разбирает метаинформацию торрента и проверяет обязательные поля
+func ParseMetainfo(data []byte) (*Metainfo, error) {
+	value, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("bencode: metainfo must be a dictionary")
+	}
+	info, ok := root["info"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("bencode: metainfo has no info dictionary")
+	}
+
+	meta := &Metainfo{
+		Name:     utf8String(info, "name"),
+		Trackers: trackers(root),
+	}
+	if meta.Name == "" {
+		return nil, fmt.Errorf("bencode: info has no name")
+	}
+
+	meta.PieceLength, _ = info["piece length"].(int64)
+	if meta.PieceLength <= 0 {
+		return nil, fmt.Errorf("bencode: invalid piece length")
+	}
+	pieces, _ := info["pieces"].(string)
+	if len(pieces) == 0 || len(pieces)%20 != 0 {
+		return nil, fmt.Errorf("bencode: invalid pieces")
+	}
+
+	if length, ok := info["length"].(int64); ok {
+		meta.Files = []File{{Path: []string{meta.Name}, Length: length}}
+	} else if files, ok := info["files"].([]interface{}); ok {
+		meta.MultiFile = true
+		for i, item := range files {
+			file, err := parseFile(item)
+			if err != nil {
+				return nil, fmt.Errorf("bencode: file #%d: %w", i+1, err)
+			}
+			meta.Files = append(meta.Files, file)
+		}
+	}
+	if len(meta.Files) == 0 {
+		return nil, fmt.Errorf("bencode: info has neither length nor files")
+	}
+
+	if meta.InfoHash, err = InfoHash(data); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// parseFile разбирает элемент списка files
+func parseFile(item interface{}) (File, error) {
+	dict, ok := item.(map[string]interface{})
+	if !ok {
+		return File{}, fmt.Errorf("must be a dictionary")
+	}
+	length, ok := dict["length"].(int64)
+	if !ok || length < 0 {
+		return File{}, fmt.Errorf("invalid length")
+	}
+
+	key := "path"
+	if _, ok := dict["path.utf-8"]; ok {
+		key = "path.utf-8"
+	}
+	parts, _ := dict[key].([]interface{})
+	var path []string
+	for _, part := range parts {
+		name, ok := part.(string)
+		if !ok {
+			return File{}, fmt.Errorf("invalid path")
+		}
+		path = append(path, name)
+	}
+	if len(path) == 0 {
+		return File{}, fmt.Errorf("empty path")
+	}
+	return File{Path: path, Length: length}, nil
+}
+
+// utf8String возвращает строковое поле словаря, предпочитая вариант с суффиксом .utf-8
+func utf8String(dict map[string]interface{}, key string) string {
+	if value, ok := dict[key+".utf-8"].(string); ok && value != "" {
+		return value
+	}
+	value, _ := dict[key].(string)
+	return value
+}
+
+// trackers возвращает адреса трекеров из announce и announce-list без повторов
+func trackers(root map[string]interface{}) []string {
+	var list []string
+	seen := make(map[string]bool)
+	add := func(value interface{}) {
+		if url, ok := value.(string); ok && url != "" && !seen[url] {
+			seen[url] = true
+			list = append(list, url)
+		}
+	}
+
+	add(root["announce"])
+	if tiers, ok := root["announce-list"].([]interface{}); ok {
+		for _, tier := range tiers {
+			if urls, ok := tier.([]interface{}); ok {
+				for _, url := range urls {
+					add(url)
+				}
+			}
+		}
+	}
+	return list
+}
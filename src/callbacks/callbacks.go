@@ -0,0 +1,259 @@
+package callbacks
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"kinozal-bot/logger"
+	"kinozal-bot/store"
+)
+
+// DefaultTTL — время жизни действия кнопки
+const DefaultTTL = 48 * time.Hour
+
+// flushInterval — период сохранения действий в хранилище
+const flushInterval = 5 * time.Second
+
+// Виды действий inline-кнопок
+const (
+	KindNoop             = "noop"
+	KindPage             = "page"
+	KindDetails          = "details"
+	KindCloseCard        = "close_card"
+	KindStartDownload    = "start_download"
+	KindSelectFolder     = "select_folder"
+	KindStatusRefresh    = "status_refresh"
+	KindStatusPause      = "status_pause"
+	KindStatusResume     = "status_resume"
+	KindStatusRemove     = "status_remove"
+	KindStatusRemoveKeep = "status_remove_keep"
+	KindStatusRemoveData = "status_remove_data"
+	KindStatusCancel     = "status_cancel"
+	KindUnsubscribe      = "unsubscribe"
+	KindUnwatch          = "unwatch"
+	KindRulePreview      = "rule_preview"
+	KindRuleDelete       = "rule_delete"
+	KindHistoryPage      = "history_page"
+	KindRedownload       = "redownload"
+	KindSelectFiles      = "select_files"
+	KindFileToggle       = "file_toggle"
+	KindFilePage         = "file_page"
+	KindFileSelectAll    = "file_select_all"
+	KindFilesDone        = "files_done"
+	KindApproveAdd       = "approve_add"
+	KindRejectAdd        = "reject_add"
+)
+
+// Action — действие, которое выполняется при нажатии на кнопку.
+// Используются только поля, нужные конкретному виду действия.
+type Action struct {
+	Kind     string `json:"kind"`
+	KzID     string `json:"kz_id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Category string `json:"category,omitempty"`
+	Section  string `json:"section,omitempty"` // тип раздачи, определенный по результатам поиска
+	ItemID   int64  `json:"item_id,omitempty"` // ID подписки, сохраненного поиска, правила, набора результатов поиска или строки списка файлов
+	Page     int    `json:"page,omitempty"`
+	Hash     string `json:"hash,omitempty"`    // инфо-хеш торрента в торрент-клиенте
+	All      bool   `json:"all,omitempty"`     // история загрузок всех пользователей или выбор всех файлов
+	Days     int    `json:"days,omitempty"`    // история загрузок за последние дни
+	ChatID   int64  `json:"chat_id,omitempty"` // чат пользователя, запросившего загрузку
+	UserID   int64  `json:"user_id,omitempty"` // пользователь, запросивший загрузку, или владелец страницы истории
+	Magnet   bool   `json:"magnet,omitempty"`  // .torrent-файл скачать не удалось, раздача добавляется по magnet-ссылке
+}
+
+// record — действие с моментом истечения
+type record struct {
+	Action    Action    `json:"action"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Store сопоставляет короткие токены в callback data с действиями кнопок,
+// чтобы пути, названия и другие длинные данные не передавались через Telegram
+// (callback data ограничена 64 байтами).
+type Store struct {
+	db  store.Store
+	ttl time.Duration
+
+	mu      sync.Mutex
+	records map[string]*record
+	index   map[string]string // ключ действия -> токен, чтобы не плодить одинаковые токены
+	dirty   map[string]bool   // токены, изменения которых еще не сохранены
+}
+
+// NewStore создает хранилище и загружает сохраненные действия из базы данных
+func NewStore(db store.Store, ttl time.Duration) *Store {
+	s := &Store{
+		db:      db,
+		ttl:     ttl,
+		records: make(map[string]*record),
+		index:   make(map[string]string),
+		dirty:   make(map[string]bool),
+	}
+
+	if err := s.load(); err != nil {
+		logger.Warn("Failed to load callback store", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return s
+}
+
+// Put сохраняет действие и возвращает токен для callback data.
+// Для одинаковых действий возвращается один и тот же токен.
+func (s *Store) Put(action Action) string {
+	key := actionKey(action)
+	expiresAt := time.Now().Add(s.ttl)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if token, ok := s.index[key]; ok {
+		if rec, exists := s.records[token]; exists {
+			rec.ExpiresAt = expiresAt
+			s.dirty[token] = true
+			return token
+		}
+	}
+
+	token := newToken()
+	s.records[token] = &record{Action: action, ExpiresAt: expiresAt}
+	s.index[key] = token
+	s.dirty[token] = true
+	return token
+}
+
+// Resolve возвращает действие по токену из callback data
+func (s *Store) Resolve(token string) (Action, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[token]
+	if !ok || time.Now().After(rec.ExpiresAt) {
+		return Action{}, false
+	}
+	return rec.Action, true
+}
+
+// Delete удаляет действие, чтобы его кнопка перестала работать.
+// Возвращает false, если действия уже нет, например когда его удалило предыдущее нажатие.
+func (s *Store) Delete(action Action) bool {
+	key := actionKey(action)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.index[key]
+	if !ok {
+		return false
+	}
+	delete(s.index, key)
+	_, exists := s.records[token]
+	delete(s.records, token)
+	s.dirty[token] = true
+	return exists
+}
+
+// Run периодически удаляет устаревшие действия и сохраняет хранилище до закрытия канала stop
+func (s *Store) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			s.Flush()
+			return
+		case <-ticker.C:
+			s.prune()
+			s.Flush()
+		}
+	}
+}
+
+// Flush сохраняет измененные и удаляет устаревшие действия в базе данных
+func (s *Store) Flush() {
+	s.mu.Lock()
+	if len(s.dirty) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	changes := make(map[string]*record, len(s.dirty))
+	for token := range s.dirty {
+		if rec, ok := s.records[token]; ok {
+			saved := *rec
+			changes[token] = &saved
+		} else {
+			changes[token] = nil
+		}
+	}
+	s.dirty = make(map[string]bool)
+	s.mu.Unlock()
+
+	for token, rec := range changes {
+		var err error
+		if rec == nil {
+			err = s.db.Delete(store.BucketCallbacks, token)
+		} else {
+			err = s.db.Put(store.BucketCallbacks, token, rec)
+		}
+		if err != nil {
+			logger.Error("Failed to save callback store", map[string]interface{}{
+				"token": token,
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+// prune удаляет устаревшие действия
+func (s *Store) prune() {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token, rec := range s.records {
+		if now.After(rec.ExpiresAt) {
+			delete(s.records, token)
+			delete(s.index, actionKey(rec.Action))
+			s.dirty[token] = true
+		}
+	}
+}
+
+// load читает сохраненные действия из базы данных
+func (s *Store) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.ForEach(store.BucketCallbacks, func(token string, decode func(interface{}) error) error {
+		rec := &record{}
+		if err := decode(rec); err != nil {
+			return err
+		}
+		s.records[token] = rec
+		s.index[actionKey(rec.Action)] = token
+		return nil
+	})
+}
+
+// actionKey возвращает ключ, по которому совпадающие действия получают один токен
+func actionKey(action Action) string {
+	data, _ := json.Marshal(action)
+	return string(data)
+}
+
+// newToken генерирует короткий случайный токен
+func newToken() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		// crypto/rand не должен отказывать; на всякий случай используем время
+		return base64.RawURLEncoding.EncodeToString([]byte(time.Now().Format("150405.000000")))
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -29,27 +30,123 @@ type Config struct {
 			Search  string
 		}
 	}
-	Transmission struct {
+	DownloadClient string // торрент-клиент, которому передаются загрузки: transmission, qbittorrent, deluge, aria2 или watchdir
+	Transmission   struct {
 		Host string
 		Port int
 		Auth struct {
 			Username string
 			Password string
 		}
+		MinFreeGB float64 // сколько места должно остаться на диске после загрузки, ГБ
+	}
+	TransmissionInstances []TransmissionInstance // экземпляры Transmission; без config/transmission.json — один из TRANS_*
+	TransmissionRoutes    []TransmissionRoute    // выбор экземпляра по категории и пользователю
+	QBittorrent           struct {
+		URL      string // адрес WebUI, например http://localhost:8080
+		Username string
+		Password string
+	}
+	Deluge struct {
+		URL      string // адрес веб-интерфейса, например http://localhost:8112
+		Password string
+	}
+	Aria2 struct {
+		URL    string // адрес JSON-RPC, например http://localhost:6800/jsonrpc
+		Secret string // секрет RPC (--rpc-secret)
 	}
 	Folders struct {
+		Watch      string // папка наблюдения по умолчанию для DOWNLOAD_CLIENT=watchdir
 		Torrents   string
 		Films      string
 		Series     string
 		Audiobooks string
 	}
-	Bot struct {
+	Categories []Category // Папки назначения, из которых пользователь выбирает при загрузке
+	Bot        struct {
 		AdminID      int
-		AllowedUsers []int // В памяти, но хранится в users.json
+		AllowedUsers []int // В памяти, но хранится в базе данных (store.BucketUsers)
+	}
+}
+
+// Category — папка назначения для загрузок с необязательными настройками торрент-клиента
+type Category struct {
+	ID            string   `json:"id"`
+	Label         string   `json:"label"`
+	Emoji         string   `json:"emoji,omitempty"`
+	Path          string   `json:"path"`
+	DownloadLimit int64    `json:"download_limit,omitempty"` // КБ/с, 0 — без ограничения
+	UploadLimit   int64    `json:"upload_limit,omitempty"`   // КБ/с, 0 — без ограничения
+	SeedRatio     float64  `json:"seed_ratio,omitempty"`     // 0 — глобальная настройка клиента
+	Labels        []string `json:"labels,omitempty"`
+	Kinds         []string `json:"kinds,omitempty"`       // типы раздач, для которых категория предлагается по умолчанию; без них используется ID
+	MinFreeGB     float64  `json:"min_free_gb,omitempty"` // запас свободного места в папке, ГБ; 0 — TRANS_MIN_FREE_GB
+	WatchDir      string   `json:"watch_dir,omitempty"`   // папка наблюдения для DOWNLOAD_CLIENT=watchdir; пусто — WATCH_DIR
+}
+
+// Title возвращает название категории для кнопок и сообщений
+func (c Category) Title() string {
+	if c.Emoji == "" {
+		return c.Label
 	}
+	return c.Emoji + " " + c.Label
 }
 
-const UsersFilePath = "config/users.json"
+// MinFreeSpace возвращает в байтах, сколько места должно остаться в папке категории после загрузки
+func (cfg *Config) MinFreeSpace(category Category) int64 {
+	gb := category.MinFreeGB
+	if gb <= 0 {
+		gb = cfg.Transmission.MinFreeGB
+	}
+	return int64(gb * (1 << 30))
+}
+
+// WatchDir возвращает папку наблюдения, в которую кладутся .torrent-файлы категории
+func (cfg *Config) WatchDir(category Category) string {
+	if category.WatchDir != "" {
+		return category.WatchDir
+	}
+	return cfg.Folders.Watch
+}
+
+// Category возвращает категорию по идентификатору
+func (cfg *Config) Category(id string) (Category, bool) {
+	for _, category := range cfg.Categories {
+		if category.ID == id {
+			return category, true
+		}
+	}
+	return Category{}, false
+}
+
+// CategoryForKind возвращает категорию, предлагаемую по умолчанию для типа раздачи
+func (cfg *Config) CategoryForKind(kind string) (Category, bool) {
+	if kind == "" {
+		return Category{}, false
+	}
+	for _, category := range cfg.Categories {
+		if len(category.Kinds) == 0 && category.ID == kind {
+			return category, true
+		}
+		for _, k := range category.Kinds {
+			if k == kind {
+				return category, true
+			}
+		}
+	}
+	return Category{}, false
+}
+
+const CategoriesFilePath = "config/categories.json"
+
+// Торрент-клиенты, которые можно указать в DOWNLOAD_CLIENT
+const (
+	ClientTransmission = "transmission"
+	ClientQBittorrent  = "qbittorrent"
+	ClientDeluge       = "deluge"
+	ClientAria2        = "aria2"
+	ClientWatchDir     = "watchdir"
+)
 
 // LoadConfig загружает конфигурацию из .env
 func LoadConfig() (*Config, error) {
@@ -90,9 +187,45 @@ func LoadConfig() (*Config, error) {
 	cfg.Transmission.Port = port
 	cfg.Transmission.Auth.Username = os.Getenv("TRANS_USER")
 	cfg.Transmission.Auth.Password = os.Getenv("TRANS_PASS")
+	if minFree := os.Getenv("TRANS_MIN_FREE_GB"); minFree != "" {
+		cfg.Transmission.MinFreeGB, err = strconv.ParseFloat(minFree, 64)
+		if err != nil || cfg.Transmission.MinFreeGB < 0 {
+			return nil, errors.New("Invalid TRANS_MIN_FREE_GB")
+		}
+	}
+
+	cfg.DownloadClient = os.Getenv("DOWNLOAD_CLIENT")
+	if cfg.DownloadClient == "" {
+		cfg.DownloadClient = ClientTransmission
+	}
+	switch cfg.DownloadClient {
+	case ClientTransmission, ClientQBittorrent, ClientDeluge, ClientAria2, ClientWatchDir:
+	default:
+		return nil, fmt.Errorf("unknown DOWNLOAD_CLIENT %q", cfg.DownloadClient)
+	}
+
+	cfg.QBittorrent.URL = os.Getenv("QBIT_ADDR")
+	if cfg.QBittorrent.URL == "" {
+		cfg.QBittorrent.URL = "http://localhost:8080"
+	}
+	cfg.QBittorrent.Username = os.Getenv("QBIT_USER")
+	cfg.QBittorrent.Password = os.Getenv("QBIT_PASS")
+
+	cfg.Deluge.URL = os.Getenv("DELUGE_ADDR")
+	if cfg.Deluge.URL == "" {
+		cfg.Deluge.URL = "http://localhost:8112"
+	}
+	cfg.Deluge.Password = os.Getenv("DELUGE_PASS")
+
+	cfg.Aria2.URL = os.Getenv("ARIA2_ADDR")
+	if cfg.Aria2.URL == "" {
+		cfg.Aria2.URL = "http://localhost:6800/jsonrpc"
+	}
+	cfg.Aria2.Secret = os.Getenv("ARIA2_SECRET")
 
 	currentDir, _ := os.Getwd()
 	cfg.Folders.Torrents = filepath.Join(currentDir, "torrents")
+	cfg.Folders.Watch = os.Getenv("WATCH_DIR")
 	cfg.Folders.Films = os.Getenv("FILMS_FOLDER")
 	if cfg.Folders.Films == "" {
 		cfg.Folders.Films = filepath.Join(currentDir, "downloads", "films")
@@ -112,40 +245,70 @@ func LoadConfig() (*Config, error) {
 	}
 	cfg.Bot.AdminID = adminID
 
-	// Загружаем пользователей из файла
-	if err := loadUsersFromFile(cfg); err != nil {
+	// Загружаем категории загрузок; без файла используются папки из переменных окружения
+	if err := loadCategoriesFromFile(cfg); err != nil {
 		return nil, err
 	}
+	// Экземпляры Transmission загружаются после категорий, потому что маршруты ссылаются на них
+	if err := loadTransmissionFromFile(cfg); err != nil {
+		return nil, err
+	}
+
+	// В режиме папок наблюдения каждой категории нужна папка, иначе загрузка в нее невозможна
+	if cfg.DownloadClient == ClientWatchDir {
+		for _, category := range cfg.Categories {
+			if cfg.WatchDir(category) == "" {
+				return nil, fmt.Errorf("category %q has no watch_dir and WATCH_DIR is not set", category.ID)
+			}
+		}
+	}
 
 	return cfg, nil
 }
 
-// loadUsersFromFile загружает список разрешенных пользователей из файла
-func loadUsersFromFile(cfg *Config) error {
-	file, err := os.Open(UsersFilePath)
+// loadCategoriesFromFile загружает список категорий загрузок из файла
+func loadCategoriesFromFile(cfg *Config) error {
+	file, err := os.Open(CategoriesFilePath)
 	if os.IsNotExist(err) {
-		return nil // Если файла нет, просто возвращаем пустой список
+		cfg.Categories = defaultCategories(cfg)
+		return nil
 	} else if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	var users []int
-	if err := json.NewDecoder(file).Decode(&users); err != nil {
-		return err
+	var categories []Category
+	if err := json.NewDecoder(file).Decode(&categories); err != nil {
+		return fmt.Errorf("invalid %s: %w", CategoriesFilePath, err)
 	}
 
-	cfg.Bot.AllowedUsers = users
+	seen := make(map[string]bool, len(categories))
+	for i := range categories {
+		category := &categories[i]
+		if category.ID == "" || category.Path == "" {
+			return fmt.Errorf("invalid %s: category #%d must have id and path", CategoriesFilePath, i+1)
+		}
+		if seen[category.ID] {
+			return fmt.Errorf("invalid %s: duplicate category id %q", CategoriesFilePath, category.ID)
+		}
+		seen[category.ID] = true
+		if category.Label == "" {
+			category.Label = category.ID
+		}
+	}
+	if len(categories) == 0 {
+		return fmt.Errorf("invalid %s: no categories defined", CategoriesFilePath)
+	}
+
+	cfg.Categories = categories
 	return nil
 }
 
-// SaveUsersToFile сохраняет список пользователей в файл
-func SaveUsersToFile(cfg *Config) error {
-	file, err := os.Create(UsersFilePath)
-	if err != nil {
-		return err
+// defaultCategories возвращает категории, соответствующие папкам FILMS_FOLDER, SERIES_FOLDER и AUDIOBOOKS_FOLDER
+func defaultCategories(cfg *Config) []Category {
+	return []Category{
+		{ID: "films", Label: "Фильмы", Emoji: "🎬", Path: cfg.Folders.Films},
+		{ID: "series", Label: "Сериалы", Emoji: "📺", Path: cfg.Folders.Series},
+		{ID: "audiobooks", Label: "Аудиокниги", Emoji: "🎧", Path: cfg.Folders.Audiobooks},
 	}
-	defer file.Close()
-
-	return json.NewEncoder(file).Encode(cfg.Bot.AllowedUsers)
 }
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const TransmissionFilePath = "config/transmission.json"
+
+// DefaultTransmissionInstance — имя единственного экземпляра Transmission, заданного переменными TRANS_*
+const DefaultTransmissionInstance = "default"
+
+// TransmissionInstance — экземпляр Transmission, которому бот передает загрузки
+type TransmissionInstance struct {
+	Name     string `json:"name"`
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"` // 0 — 9091
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Fallback string `json:"fallback,omitempty"` // экземпляр, который получает загрузки, пока этот недоступен
+}
+
+// Address возвращает адрес RPC экземпляра в виде host:port
+func (i TransmissionInstance) Address() string {
+	return fmt.Sprintf("%s:%d", i.Host, i.Port)
+}
+
+// TransmissionRoute направляет загрузки категории и/или пользователя в указанный экземпляр.
+// Пустая категория и нулевой пользователь подходят для любых загрузок.
+type TransmissionRoute struct {
+	Category string `json:"category,omitempty"`
+	UserID   int64  `json:"user_id,omitempty"`
+	Instance string `json:"instance"`
+}
+
+// Matches сообщает, подходит ли маршрут для загрузки пользователя userID в категорию category
+func (r TransmissionRoute) Matches(category string, userID int64) bool {
+	if r.Category != "" && r.Category != category {
+		return false
+	}
+	return r.UserID == 0 || r.UserID == userID
+}
+
+// TransmissionInstance возвращает экземпляр Transmission по имени
+func (cfg *Config) TransmissionInstance(name string) (TransmissionInstance, bool) {
+	for _, instance := range cfg.TransmissionInstances {
+		if instance.Name == name {
+			return instance, true
+		}
+	}
+	return TransmissionInstance{}, false
+}
+
+// TransmissionInstanceFor возвращает экземпляр Transmission для загрузки пользователя userID в категорию category:
+// первый подходящий маршрут, а если такого нет — первый экземпляр из списка
+func (cfg *Config) TransmissionInstanceFor(category string, userID int64) TransmissionInstance {
+	for _, route := range cfg.TransmissionRoutes {
+		if route.Matches(category, userID) {
+			if instance, ok := cfg.TransmissionInstance(route.Instance); ok {
+				return instance
+			}
+		}
+	}
+	return cfg.TransmissionInstances[0]
+}
+
+// loadTransmissionFromFile загружает список экземпляров Transmission и маршруты из файла.
+// Без файла используется один экземпляр из переменных TRANS_*.
+func loadTransmissionFromFile(cfg *Config) error {
+	file, err := os.Open(TransmissionFilePath)
+	if os.IsNotExist(err) {
+		cfg.TransmissionInstances = []TransmissionInstance{{
+			Name:     DefaultTransmissionInstance,
+			Host:     cfg.Transmission.Host,
+			Port:     cfg.Transmission.Port,
+			Username: cfg.Transmission.Auth.Username,
+			Password: cfg.Transmission.Auth.Password,
+		}}
+		cfg.TransmissionRoutes = nil
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var settings struct {
+		Instances []TransmissionInstance `json:"instances"`
+		Routes    []TransmissionRoute    `json:"routes"`
+	}
+	if err := json.NewDecoder(file).Decode(&settings); err != nil {
+		return fmt.Errorf("invalid %s: %w", TransmissionFilePath, err)
+	}
+	if len(settings.Instances) == 0 {
+		return fmt.Errorf("invalid %s: no instances defined", TransmissionFilePath)
+	}
+
+	names := make(map[string]bool, len(settings.Instances))
+	for i := range settings.Instances {
+		instance := &settings.Instances[i]
+		if instance.Name == "" || instance.Host == "" {
+			return fmt.Errorf("invalid %s: instance #%d must have name and host", TransmissionFilePath, i+1)
+		}
+		if names[instance.Name] {
+			return fmt.Errorf("invalid %s: duplicate instance name %q", TransmissionFilePath, instance.Name)
+		}
+		names[instance.Name] = true
+		if instance.Port == 0 {
+			instance.Port = 9091
+		}
+	}
+	for _, instance := range settings.Instances {
+		if instance.Fallback == "" {
+			continue
+		}
+		if instance.Fallback == instance.Name || !names[instance.Fallback] {
+			return fmt.Errorf("invalid %s: instance %q has invalid fallback %q", TransmissionFilePath, instance.Name, instance.Fallback)
+		}
+	}
+
+	for i, route := range settings.Routes {
+		if !names[route.Instance] {
+			return fmt.Errorf("invalid %s: route #%d refers to unknown instance %q", TransmissionFilePath, i+1, route.Instance)
+		}
+		if route.Category != "" {
+			if _, ok := cfg.Category(route.Category); !ok {
+				return fmt.Errorf("invalid %s: route #%d refers to unknown category %q", TransmissionFilePath, i+1, route.Category)
+			}
+		}
+	}
+
+	cfg.TransmissionInstances = settings.Instances
+	cfg.TransmissionRoutes = settings.Routes
+	return nil
+}
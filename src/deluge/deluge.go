@@ -0,0 +1,326 @@
+package deluge
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kinozal-bot/bencode"
+	"kinozal-bot/config"
+	"kinozal-bot/downloader"
+	"kinozal-bot/errors"
+	"kinozal-bot/logger"
+)
+
+// Приоритеты файлов Deluge 2
+const (
+	prioritySkip   = 0
+	priorityNormal = 4
+	priorityHigh   = 7
+)
+
+// Client передает загрузки в Deluge через JSON-RPC веб-интерфейса
+type Client struct {
+	cfg  *config.Config
+	http *http.Client
+
+	requestID int64 // номер последнего запроса, увеличивается атомарно
+
+	mu        sync.Mutex
+	connected bool // выполнен вход и веб-интерфейс подключен к демону
+}
+
+// New создает клиент Deluge по настройкам из конфигурации
+func New(cfg *config.Config) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		cfg: cfg,
+		http: &http.Client{
+			Jar:     jar,
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Name возвращает название клиента для сообщений пользователю
+func (c *Client) Name() string {
+	return "Deluge"
+}
+
+// AddFile добавляет торрент в Deluge в папку категории и возвращает его хеш
+func (c *Client) AddFile(content []byte, category config.Category, files downloader.FileChoice) (string, error) {
+	meta, err := bencode.ParseMetainfo(content)
+	if err != nil {
+		return "", errors.NewDownloadClientError("Invalid torrent file", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	options := addOptions(category)
+	if !files.IsEmpty() {
+		options["file_priorities"] = filePriorities(len(meta.Files), files)
+	}
+
+	var hash *string
+	filedump := base64.StdEncoding.EncodeToString(content)
+	if err := c.call("core.add_torrent_file", []interface{}{meta.InfoHash + ".torrent", filedump, options}, &hash); err != nil {
+		return "", err
+	}
+	// Deluge возвращает null, если торрент уже добавлен
+	if hash == nil {
+		return "", errors.NewDownloadClientError("Deluge did not add the torrent", map[string]interface{}{
+			"hash": meta.InfoHash,
+		})
+	}
+
+	added := strings.ToLower(*hash)
+	c.setLabel(added, category)
+	return added, nil
+}
+
+// AddMagnet добавляет торрент в Deluge по magnet-ссылке и возвращает его хеш
+func (c *Client) AddMagnet(link string, category config.Category) (string, error) {
+	var hash *string
+	if err := c.call("core.add_torrent_magnet", []interface{}{link, addOptions(category)}, &hash); err != nil {
+		return "", err
+	}
+	if hash == nil {
+		return "", errors.NewDownloadClientError("Deluge did not add the magnet link", map[string]interface{}{
+			"magnet": link,
+		})
+	}
+
+	added := strings.ToLower(*hash)
+	c.setLabel(added, category)
+	return added, nil
+}
+
+// FreeSpace возвращает свободное место в папке path по данным Deluge, байт
+func (c *Client) FreeSpace(path string) (int64, error) {
+	var free int64
+	if err := c.call("core.get_free_space", []interface{}{path}, &free); err != nil {
+		return 0, err
+	}
+	return free, nil
+}
+
+// addOptions возвращает параметры добавления торрента с настройками категории
+func addOptions(category config.Category) map[string]interface{} {
+	options := map[string]interface{}{
+		"download_location": category.Path,
+	}
+	if category.DownloadLimit > 0 {
+		options["max_download_speed"] = category.DownloadLimit
+	}
+	if category.UploadLimit > 0 {
+		options["max_upload_speed"] = category.UploadLimit
+	}
+	if category.SeedRatio > 0 {
+		options["stop_at_ratio"] = true
+		options["stop_ratio"] = category.SeedRatio
+	}
+	return options
+}
+
+// filePriorities переводит выбор файлов в список приоритетов Deluge по порядку файлов торрента
+func filePriorities(count int, files downloader.FileChoice) []int {
+	priorities := make([]int, count)
+	for i := range priorities {
+		priorities[i] = priorityNormal
+	}
+	for _, index := range files.High {
+		if index >= 0 && int(index) < count {
+			priorities[index] = priorityHigh
+		}
+	}
+	for _, index := range files.Unwanted {
+		if index >= 0 && int(index) < count {
+			priorities[index] = prioritySkip
+		}
+	}
+	return priorities
+}
+
+// setLabel назначает торренту метку через плагин Label. Deluge поддерживает одну метку
+// на торрент, поэтому используется первая метка категории. Ошибки только записываются в журнал:
+// без включенного плагина торрент все равно загружается.
+func (c *Client) setLabel(hash string, category config.Category) {
+	if len(category.Labels) == 0 {
+		return
+	}
+	// Плагин принимает метки только в нижнем регистре
+	label := strings.ToLower(category.Labels[0])
+
+	var labels []string
+	if err := c.call("label.get_labels", []interface{}{}, &labels); err != nil {
+		logger.Warn("Failed to get Deluge labels", map[string]interface{}{
+			"hash":  hash,
+			"error": err.Error(),
+		})
+		return
+	}
+	exists := false
+	for _, existing := range labels {
+		if existing == label {
+			exists = true
+			break
+		}
+	}
+	if !exists {
+		if err := c.call("label.add", []interface{}{label}, nil); err != nil {
+			logger.Warn("Failed to create Deluge label", map[string]interface{}{
+				"label": label,
+				"error": err.Error(),
+			})
+			return
+		}
+	}
+	if err := c.call("label.set_torrent", []interface{}{hash, label}, nil); err != nil {
+		logger.Warn("Failed to set Deluge label", map[string]interface{}{
+			"hash":  hash,
+			"label": label,
+			"error": err.Error(),
+		})
+	}
+}
+
+// rpcError — ошибка, которую вернул метод JSON-RPC
+type rpcError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// call вызывает метод JSON-RPC и разбирает результат в result. При первом вызове и после
+// истечения сессии выполняется вход и подключение веб-интерфейса к демону.
+func (c *Client) call(method string, params []interface{}, result interface{}) error {
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := c.ensureConnected(); err != nil {
+			return err
+		}
+
+		err := c.rawCall(method, params, result)
+		if rpcErr, ok := err.(*rpcError); ok && rpcErr.Code == 1 {
+			// Код 1 — "Not authenticated": сессия истекла
+			c.mu.Lock()
+			c.connected = false
+			c.mu.Unlock()
+			continue
+		}
+		if err, ok := err.(*rpcError); ok {
+			return errors.NewDownloadClientError("Deluge rejected the request", map[string]interface{}{
+				"method": method,
+				"error":  err.Message,
+			})
+		}
+		return err
+	}
+	return errors.NewDownloadClientError("Deluge rejected the session", map[string]interface{}{
+		"method": method,
+	})
+}
+
+// ensureConnected выполняет вход и подключает веб-интерфейс к первому демону, если он не подключен
+func (c *Client) ensureConnected() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected {
+		return nil
+	}
+
+	var ok bool
+	if err := c.rawCall("auth.login", []interface{}{c.cfg.Deluge.Password}, &ok); err != nil {
+		return errors.NewDownloadClientError("Failed to log in to Deluge", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	if !ok {
+		return errors.NewDownloadClientError("Deluge login failed: wrong password", nil)
+	}
+
+	var connected bool
+	if err := c.rawCall("web.connected", []interface{}{}, &connected); err != nil {
+		return errors.NewDownloadClientError("Failed to check Deluge daemon connection", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	if !connected {
+		// Каждый хост — список [id, адрес, порт, ...]
+		var hosts [][]interface{}
+		if err := c.rawCall("web.get_hosts", []interface{}{}, &hosts); err != nil || len(hosts) == 0 {
+			return errors.NewDownloadClientError("Deluge web UI has no daemon to connect to", nil)
+		}
+		hostID, _ := hosts[0][0].(string)
+		if err := c.rawCall("web.connect", []interface{}{hostID}, nil); err != nil {
+			return errors.NewDownloadClientError("Failed to connect Deluge web UI to daemon", map[string]interface{}{
+				"host":  hostID,
+				"error": err.Error(),
+			})
+		}
+	}
+
+	c.connected = true
+	return nil
+}
+
+// rawCall отправляет запрос JSON-RPC без проверки сессии
+func (c *Client) rawCall(method string, params []interface{}, result interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"method": method,
+		"params": params,
+		"id":     atomic.AddInt64(&c.requestID, 1),
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoint := strings.TrimRight(c.cfg.Deluge.URL, "/") + "/json"
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errors.NewDownloadClientError("Failed to connect to Deluge", map[string]interface{}{
+			"method": method,
+			"error":  err.Error(),
+		})
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.NewDownloadClientError("Unexpected response from Deluge", map[string]interface{}{
+			"method": method,
+			"status": resp.StatusCode,
+		})
+	}
+
+	var answer struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return errors.NewDownloadClientError("Invalid response from Deluge", map[string]interface{}{
+			"method": method,
+			"error":  err.Error(),
+		})
+	}
+	if answer.Error != nil {
+		return answer.Error
+	}
+	if result == nil || len(answer.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(answer.Result, result)
+}
@@ -0,0 +1,505 @@
+package deluge
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"kinozal-bot/bencode"
+	"kinozal-bot/config"
+	"kinozal-bot/downloader"
+)
+
+const testPassword = "deluge"
+
+// rpcRequest — запрос JSON-RPC, полученный фейковым сервером
+type rpcRequest struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+	ID     int64             `json:"id"`
+}
+
+// param разбирает параметр запроса с номером i в value
+func (r rpcRequest) param(t *testing.T, i int, value interface{}) {
+	t.Helper()
+	if i >= len(r.Params) {
+		t.Fatalf("%s: expected at least %d params, got %d", r.Method, i+1, len(r.Params))
+	}
+	if err := json.Unmarshal(r.Params[i], value); err != nil {
+		t.Fatalf("%s: param #%d: %v", r.Method, i, err)
+	}
+}
+
+// fakeDeluge имитирует JSON-RPC веб-интерфейса Deluge 2: сессию через cookie _session_id,
+// подключение к демону, добавление торрентов, плагин Label и управление торрентами
+type fakeDeluge struct {
+	t *testing.T
+
+	mu        sync.Mutex
+	session   string // действующая сессия; пустая — вход не выполнен или сессия истекла
+	logins    int
+	connected bool
+	labels    []string
+	torrents  map[string]map[string]interface{}
+	requests  []rpcRequest
+}
+
+func newFakeDeluge(t *testing.T) (*fakeDeluge, *Client) {
+	fake := &fakeDeluge{t: t, torrents: make(map[string]map[string]interface{})}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{}
+	cfg.Deluge.URL = server.URL + "/"
+	cfg.Deluge.Password = testPassword
+	return fake, New(cfg)
+}
+
+// expire завершает сессию, как это делает Deluge по истечении времени
+func (f *fakeDeluge) expire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.session = ""
+}
+
+// methods возвращает имена вызванных методов по порядку
+func (f *fakeDeluge) methods() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	methods := make([]string, len(f.requests))
+	for i, req := range f.requests {
+		methods[i] = req.Method
+	}
+	return methods
+}
+
+// last возвращает последний запрос метода method
+func (f *fakeDeluge) last(method string) rpcRequest {
+	f.t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := len(f.requests) - 1; i >= 0; i-- {
+		if f.requests[i].Method == method {
+			return f.requests[i]
+		}
+	}
+	f.t.Fatalf("method %s was not called", method)
+	return rpcRequest{}
+}
+
+func (f *fakeDeluge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/json" {
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		http.NotFound(w, r)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+		f.t.Errorf("unexpected Content-Type %q", ct)
+	}
+
+	var req rpcRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		f.t.Errorf("invalid JSON-RPC body: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, req)
+
+	reply := func(result interface{}, rpcErr map[string]interface{}) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id":     req.ID,
+			"result": result,
+			"error":  rpcErr,
+		})
+	}
+
+	if req.Method == "auth.login" {
+		var password string
+		json.Unmarshal(req.Params[0], &password)
+		if password != testPassword {
+			reply(false, nil)
+			return
+		}
+		f.logins++
+		f.session = fmt.Sprintf("session-%d", f.logins)
+		http.SetCookie(w, &http.Cookie{Name: "_session_id", Value: f.session, Path: "/"})
+		reply(true, nil)
+		return
+	}
+
+	cookie, err := r.Cookie("_session_id")
+	if err != nil || f.session == "" || cookie.Value != f.session {
+		reply(nil, map[string]interface{}{"message": "Not authenticated", "code": 1})
+		return
+	}
+
+	switch req.Method {
+	case "web.connected":
+		reply(f.connected, nil)
+	case "web.get_hosts":
+		reply([][]interface{}{{"host-1", "127.0.0.1", 58846, "localclient"}}, nil)
+	case "web.connect":
+		f.connected = true
+		reply(nil, nil)
+	case "core.add_torrent_file":
+		var filedump string
+		json.Unmarshal(req.Params[1], &filedump)
+		content, _ := base64.StdEncoding.DecodeString(filedump)
+		hash, err := bencode.InfoHash(content)
+		if err != nil {
+			reply(nil, map[string]interface{}{"message": err.Error(), "code": 4})
+			return
+		}
+		if _, exists := f.torrents[hash]; exists {
+			reply(nil, nil)
+			return
+		}
+		f.torrents[hash] = map[string]interface{}{"hash": hash, "state": "Downloading"}
+		// Deluge возвращает хеш в том регистре, в котором его хранит, — клиент приводит его к нижнему
+		reply(strings.ToUpper(hash), nil)
+	case "label.get_labels":
+		reply(f.labels, nil)
+	case "label.add":
+		var label string
+		json.Unmarshal(req.Params[0], &label)
+		f.labels = append(f.labels, label)
+		reply(nil, nil)
+	case "label.set_torrent":
+		reply(nil, nil)
+	case "core.get_torrents_status":
+		var filter struct {
+			ID []string `json:"id"`
+		}
+		json.Unmarshal(req.Params[0], &filter)
+		result := make(map[string]interface{})
+		for hash, t := range f.torrents {
+			if len(filter.ID) == 0 || contains(filter.ID, hash) {
+				result[hash] = t
+			}
+		}
+		reply(result, nil)
+	case "core.pause_torrent", "core.resume_torrent":
+		var hashes []string
+		json.Unmarshal(req.Params[0], &hashes)
+		state := "Paused"
+		if req.Method == "core.resume_torrent" {
+			state = "Downloading"
+		}
+		for _, hash := range hashes {
+			if t, ok := f.torrents[hash]; ok {
+				t["state"] = state
+			}
+		}
+		reply(nil, nil)
+	case "core.remove_torrent":
+		var hash string
+		json.Unmarshal(req.Params[0], &hash)
+		_, ok := f.torrents[hash]
+		delete(f.torrents, hash)
+		reply(ok, nil)
+	default:
+		reply(nil, map[string]interface{}{"message": "Unknown method " + req.Method, "code": 2})
+	}
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// testTorrent возвращает многофайловый торрент из трех файлов и его метаинформацию
+func testTorrent(t *testing.T) ([]byte, *bencode.Metainfo) {
+	t.Helper()
+	content, err := bencode.Encode(map[string]interface{}{
+		"announce": "http://tracker.example/announce",
+		"info": map[string]interface{}{
+			"name":         "Сериал S01",
+			"piece length": 16384,
+			"pieces":       strings.Repeat("x", 20),
+			"files": []interface{}{
+				map[string]interface{}{"length": 100, "path": []string{"e01.mkv"}},
+				map[string]interface{}{"length": 200, "path": []string{"e02.mkv"}},
+				map[string]interface{}{"length": 300, "path": []string{"e03.mkv"}},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta, err := bencode.ParseMetainfo(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content, meta
+}
+
+func TestAddFileLogsInAndSendsOptions(t *testing.T) {
+	fake, client := newFakeDeluge(t)
+	content, meta := testTorrent(t)
+	category := config.Category{
+		ID:            "series",
+		Path:          "/downloads/series",
+		DownloadLimit: 500,
+		UploadLimit:   100,
+		SeedRatio:     1.5,
+		Labels:        []string{"Series", "tv"},
+	}
+
+	hash, err := client.AddFile(content, category, downloader.FileChoice{Unwanted: []int64{1}, High: []int64{0}})
+	if err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if hash != meta.InfoHash {
+		t.Errorf("hash = %q, want %q", hash, meta.InfoHash)
+	}
+
+	wantMethods := []string{
+		"auth.login", "web.connected", "web.get_hosts", "web.connect",
+		"core.add_torrent_file", "label.get_labels", "label.add", "label.set_torrent",
+	}
+	if got := fake.methods(); !reflect.DeepEqual(got, wantMethods) {
+		t.Errorf("methods = %v, want %v", got, wantMethods)
+	}
+
+	var hostID string
+	fake.last("web.connect").param(t, 0, &hostID)
+	if hostID != "host-1" {
+		t.Errorf("web.connect host = %q, want host-1", hostID)
+	}
+
+	add := fake.last("core.add_torrent_file")
+	var filename, filedump string
+	var options map[string]interface{}
+	add.param(t, 0, &filename)
+	add.param(t, 1, &filedump)
+	add.param(t, 2, &options)
+	if filename != meta.InfoHash+".torrent" {
+		t.Errorf("filename = %q", filename)
+	}
+	if filedump != base64.StdEncoding.EncodeToString(content) {
+		t.Error("filedump does not match the torrent content")
+	}
+	wantOptions := map[string]interface{}{
+		"download_location":  "/downloads/series",
+		"max_download_speed": float64(500),
+		"max_upload_speed":   float64(100),
+		"stop_at_ratio":      true,
+		"stop_ratio":         1.5,
+		"file_priorities":    []interface{}{float64(priorityHigh), float64(prioritySkip), float64(priorityNormal)},
+	}
+	if !reflect.DeepEqual(options, wantOptions) {
+		t.Errorf("options = %v, want %v", options, wantOptions)
+	}
+
+	var label string
+	fake.last("label.add").param(t, 0, &label)
+	if label != "series" {
+		t.Errorf("label.add = %q, want lowercase first label", label)
+	}
+	var labelHash string
+	set := fake.last("label.set_torrent")
+	set.param(t, 0, &labelHash)
+	set.param(t, 1, &label)
+	if labelHash != meta.InfoHash || label != "series" {
+		t.Errorf("label.set_torrent(%q, %q)", labelHash, label)
+	}
+}
+
+func TestAddFileWithoutOptionalSettings(t *testing.T) {
+	fake, client := newFakeDeluge(t)
+	content, _ := testTorrent(t)
+
+	if _, err := client.AddFile(content, config.Category{ID: "films", Path: "/downloads/films"}, downloader.FileChoice{}); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+
+	var options map[string]interface{}
+	fake.last("core.add_torrent_file").param(t, 2, &options)
+	if !reflect.DeepEqual(options, map[string]interface{}{"download_location": "/downloads/films"}) {
+		t.Errorf("options = %v, want only download_location", options)
+	}
+	for _, method := range fake.methods() {
+		if strings.HasPrefix(method, "label.") {
+			t.Errorf("unexpected %s for a category without labels", method)
+		}
+	}
+}
+
+func TestAddFileExistingLabelIsReused(t *testing.T) {
+	fake, client := newFakeDeluge(t)
+	fake.labels = []string{"films"}
+	content, _ := testTorrent(t)
+
+	if _, err := client.AddFile(content, config.Category{ID: "films", Path: "/films", Labels: []string{"Films"}}, downloader.FileChoice{}); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if contains(fake.methods(), "label.add") {
+		t.Error("label.add called for an existing label")
+	}
+}
+
+func TestAddFileDuplicate(t *testing.T) {
+	_, client := newFakeDeluge(t)
+	content, _ := testTorrent(t)
+	category := config.Category{ID: "films", Path: "/films"}
+
+	if _, err := client.AddFile(content, category, downloader.FileChoice{}); err != nil {
+		t.Fatalf("first AddFile: %v", err)
+	}
+	if _, err := client.AddFile(content, category, downloader.FileChoice{}); err == nil {
+		t.Error("second AddFile succeeded, want error for a torrent Deluge did not add")
+	}
+}
+
+func TestListRequestsStatusFields(t *testing.T) {
+	fake, client := newFakeDeluge(t)
+	fake.torrents["abc"] = map[string]interface{}{
+		"hash":                  "ABC",
+		"name":                  "Фильм",
+		"save_path":             "/downloads/films",
+		"state":                 "Paused",
+		"progress":              50.0,
+		"eta":                   120,
+		"download_payload_rate": 1000,
+		"upload_payload_rate":   10,
+		"num_peers":             3,
+		"num_seeds":             2,
+		"total_wanted":          4096,
+		"ratio":                 0.25,
+		"time_added":            1700000000,
+	}
+	fake.torrents["def"] = map[string]interface{}{"state": "Seeding", "progress": 100.0}
+
+	infos, err := client.List([]string{"abc"})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+
+	req := fake.last("core.get_torrents_status")
+	var filter map[string][]string
+	var keys []string
+	req.param(t, 0, &filter)
+	req.param(t, 1, &keys)
+	if !reflect.DeepEqual(filter, map[string][]string{"id": {"abc"}}) {
+		t.Errorf("filter = %v", filter)
+	}
+	if !reflect.DeepEqual(keys, statusKeys) {
+		t.Errorf("keys = %v, want %v", keys, statusKeys)
+	}
+
+	if len(infos) != 1 {
+		t.Fatalf("got %d torrents, want 1", len(infos))
+	}
+	info := infos[0]
+	if info.Hash != "abc" || info.Name != "Фильм" || info.DownloadDir != "/downloads/films" {
+		t.Errorf("unexpected info %+v", info)
+	}
+	if !info.Stopped || info.PercentDone != 0.5 || info.PeersConnected != 5 || info.TotalSize != 4096 {
+		t.Errorf("unexpected state %+v", info)
+	}
+	if info.ETA.Seconds() != 120 || info.AddedDate.Unix() != 1700000000 {
+		t.Errorf("unexpected times: eta %v, added %v", info.ETA, info.AddedDate)
+	}
+
+	all, err := client.List(nil)
+	if err != nil {
+		t.Fatalf("List(nil): %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("List(nil) returned %d torrents, want 2", len(all))
+	}
+	filter = nil
+	fake.last("core.get_torrents_status").param(t, 0, &filter)
+	if len(filter) != 0 {
+		t.Errorf("List(nil) filter = %v, want empty", filter)
+	}
+}
+
+func TestPauseResumeRemove(t *testing.T) {
+	fake, client := newFakeDeluge(t)
+	fake.torrents["abc"] = map[string]interface{}{"hash": "abc", "state": "Downloading"}
+
+	if err := client.Pause("abc"); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	var hashes []string
+	fake.last("core.pause_torrent").param(t, 0, &hashes)
+	if !reflect.DeepEqual(hashes, []string{"abc"}) {
+		t.Errorf("pause_torrent hashes = %v", hashes)
+	}
+
+	if err := client.Resume("abc"); err != nil {
+		t.Fatalf("Resume: %v", err)
+	}
+	fake.last("core.resume_torrent").param(t, 0, &hashes)
+	if !reflect.DeepEqual(hashes, []string{"abc"}) {
+		t.Errorf("resume_torrent hashes = %v", hashes)
+	}
+
+	if err := client.Remove("abc", true); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	remove := fake.last("core.remove_torrent")
+	var hash string
+	var deleteData bool
+	remove.param(t, 0, &hash)
+	remove.param(t, 1, &deleteData)
+	if hash != "abc" || !deleteData {
+		t.Errorf("remove_torrent(%q, %v)", hash, deleteData)
+	}
+
+	if err := client.Remove("abc", false); err == nil {
+		t.Error("Remove of a missing torrent succeeded")
+	}
+}
+
+func TestReloginOnExpiredSession(t *testing.T) {
+	fake, client := newFakeDeluge(t)
+	fake.torrents["abc"] = map[string]interface{}{"hash": "abc", "state": "Downloading"}
+
+	if err := client.Pause("abc"); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	fake.expire()
+	if err := client.Resume("abc"); err != nil {
+		t.Fatalf("Resume after expired session: %v", err)
+	}
+
+	if fake.logins != 2 {
+		t.Errorf("logins = %d, want 2", fake.logins)
+	}
+	methods := fake.methods()
+	tail := methods[len(methods)-4:]
+	want := []string{"core.resume_torrent", "auth.login", "web.connected", "core.resume_torrent"}
+	if !reflect.DeepEqual(tail, want) {
+		t.Errorf("methods after expiry = %v, want %v", tail, want)
+	}
+	if fake.torrents["abc"]["state"] != "Downloading" {
+		t.Error("torrent was not resumed")
+	}
+}
+
+func TestWrongPassword(t *testing.T) {
+	fake, client := newFakeDeluge(t)
+	client.cfg.Deluge.Password = "wrong"
+
+	if err := client.Pause("abc"); err == nil {
+		t.Fatal("Pause succeeded with a wrong password")
+	}
+	if contains(fake.methods(), "core.pause_torrent") {
+		t.Error("core.pause_torrent called without a session")
+	}
+}
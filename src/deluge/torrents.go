@@ -0,0 +1,130 @@
+package deluge
+
+import (
+	"strings"
+	"time"
+
+	"kinozal-bot/downloader"
+	"kinozal-bot/errors"
+)
+
+// statusKeys — поля, запрашиваемые у Deluge для TorrentInfo
+var statusKeys = []string{
+	"hash", "name", "save_path", "state", "progress", "eta",
+	"download_payload_rate", "upload_payload_rate", "num_peers", "num_seeds",
+	"total_wanted", "ratio", "time_added", "completed_time", "message",
+}
+
+// torrent — состояние торрента из ответа core.get_torrents_status
+type torrent struct {
+	Hash          string  `json:"hash"`
+	Name          string  `json:"name"`
+	SavePath      string  `json:"save_path"`
+	State         string  `json:"state"`
+	Progress      float64 `json:"progress"` // проценты, 0–100
+	ETA           float64 `json:"eta"`      // секунды; 0 — время неизвестно
+	DownloadRate  float64 `json:"download_payload_rate"`
+	UploadRate    float64 `json:"upload_payload_rate"`
+	NumPeers      int64   `json:"num_peers"`
+	NumSeeds      int64   `json:"num_seeds"`
+	TotalWanted   int64   `json:"total_wanted"` // размер выбранных файлов
+	Ratio         float64 `json:"ratio"`
+	TimeAdded     float64 `json:"time_added"`
+	CompletedTime float64 `json:"completed_time"`
+	Message       string  `json:"message"`
+}
+
+// List возвращает состояние торрентов с указанными хешами.
+// Если хеши не указаны, возвращаются все торренты.
+func (c *Client) List(hashes []string) ([]downloader.TorrentInfo, error) {
+	filter := map[string]interface{}{}
+	if len(hashes) > 0 {
+		filter["id"] = hashes
+	}
+
+	var torrents map[string]torrent
+	if err := c.call("core.get_torrents_status", []interface{}{filter, statusKeys}, &torrents); err != nil {
+		return nil, err
+	}
+
+	infos := make([]downloader.TorrentInfo, 0, len(torrents))
+	for hash, t := range torrents {
+		if t.Hash == "" {
+			t.Hash = hash
+		}
+		infos = append(infos, toTorrentInfo(t))
+	}
+	return infos, nil
+}
+
+// Get возвращает состояние торрента по хешу
+func (c *Client) Get(hash string) (*downloader.TorrentInfo, error) {
+	infos, err := c.List([]string{hash})
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, errors.NewDownloadClientError("Torrent not found in Deluge", map[string]interface{}{
+			"hash": hash,
+		})
+	}
+	return &infos[0], nil
+}
+
+// Pause ставит торрент на паузу
+func (c *Client) Pause(hash string) error {
+	return c.call("core.pause_torrent", []interface{}{[]string{hash}}, nil)
+}
+
+// Resume возобновляет загрузку торрента
+func (c *Client) Resume(hash string) error {
+	return c.call("core.resume_torrent", []interface{}{[]string{hash}}, nil)
+}
+
+// Remove удаляет торрент из Deluge, при deleteData — вместе с загруженными файлами
+func (c *Client) Remove(hash string, deleteData bool) error {
+	var removed bool
+	if err := c.call("core.remove_torrent", []interface{}{hash, deleteData}, &removed); err != nil {
+		return err
+	}
+	if !removed {
+		return errors.NewDownloadClientError("Deluge did not remove the torrent", map[string]interface{}{
+			"hash": hash,
+		})
+	}
+	return nil
+}
+
+// toTorrentInfo переводит состояние торрента Deluge в TorrentInfo
+func toTorrentInfo(t torrent) downloader.TorrentInfo {
+	info := downloader.TorrentInfo{
+		Hash:           strings.ToLower(t.Hash),
+		Name:           t.Name,
+		DownloadDir:    t.SavePath,
+		Status:         t.State,
+		PercentDone:    t.Progress / 100,
+		ETA:            -1,
+		RateDownload:   int64(t.DownloadRate),
+		RateUpload:     int64(t.UploadRate),
+		PeersConnected: t.NumPeers + t.NumSeeds,
+		TotalSize:      t.TotalWanted,
+		UploadRatio:    t.Ratio,
+		Stopped:        t.State == "Paused",
+	}
+	if t.ETA > 0 {
+		info.ETA = time.Duration(t.ETA) * time.Second
+	}
+	if t.TimeAdded > 0 {
+		info.AddedDate = time.Unix(int64(t.TimeAdded), 0)
+	}
+	if t.CompletedTime > 0 {
+		info.DoneDate = time.Unix(int64(t.CompletedTime), 0)
+	}
+	if t.State == "Error" {
+		info.ErrorString = t.Message
+		if info.ErrorString == "" {
+			info.ErrorString = t.State
+		}
+	}
+	return info
+}
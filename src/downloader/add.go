@@ -0,0 +1,141 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+
+	"kinozal-bot/bencode"
+	"kinozal-bot/config"
+	"kinozal-bot/errors"
+	"kinozal-bot/fileutils"
+	"kinozal-bot/logger"
+	"kinozal-bot/torrent"
+)
+
+// AddTorrentFile добавляет .torrent-файл в клиент в папку категории и возвращает хеш торрента.
+// Если торрент уже есть в клиенте, он не добавляется повторно и возвращается *DuplicateError.
+// Если после загрузки на диске останется меньше настроенного запаса, возвращается *SpaceError,
+// а .torrent-файл сохраняется для повторной попытки.
+func AddTorrentFile(client DownloadClient, cfg *config.Config, torrentPath string, category config.Category, options AddOptions, name string, chatID int64, messenger Messenger) (string, error) {
+	content, err := os.ReadFile(torrentPath)
+	if err != nil {
+		return "", errors.NewDownloadClientError("Failed to open torrent file", map[string]interface{}{
+			"torrent_path": torrentPath,
+			"error":        err.Error(),
+		})
+	}
+
+	// Вычисляем инфо-хеш локально, чтобы не добавить торрент, который уже есть в клиенте
+	meta, err := bencode.ParseMetainfo(content)
+	if err != nil {
+		return "", errors.NewDownloadClientError("Invalid torrent file", map[string]interface{}{
+			"torrent_path": torrentPath,
+			"error":        err.Error(),
+		})
+	}
+	hash := meta.InfoHash
+	if err := checkDuplicate(client, hash); err != nil {
+		cleanupTorrentFile(torrentPath)
+		return hash, err
+	}
+
+	if !options.IgnoreFreeSpace {
+		if err := checkSpace(client, cfg, category, options.Files.Size(meta)); err != nil {
+			return hash, err
+		}
+	}
+
+	added, err := client.AddFile(content, category, options.Files)
+	if err != nil {
+		return "", err
+	}
+	if added == "" {
+		added = hash
+	}
+
+	// Удаляем торрент-файл после добавления
+	cleanupTorrentFile(torrentPath)
+
+	notifyAdded(client, messenger, chatID, name, category.Path)
+	return added, nil
+}
+
+// AddMagnet добавляет торрент в клиент по magnet-ссылке и возвращает его хеш.
+// Используется, когда .torrent-файл недоступен (например, исчерпан лимит скачиваний на Kinozal).
+// Если торрент уже есть в клиенте, он не добавляется повторно и возвращается *DuplicateError.
+func AddMagnet(client DownloadClient, link string, category config.Category, name string, chatID int64, messenger Messenger) (string, error) {
+	hash := torrent.MagnetHash(link)
+	if err := checkDuplicate(client, hash); err != nil {
+		return hash, err
+	}
+
+	added, err := client.AddMagnet(link, category)
+	if err != nil {
+		return "", err
+	}
+	if added == "" {
+		added = hash
+	}
+
+	notifyAdded(client, messenger, chatID, name, category.Path)
+	return added, nil
+}
+
+// checkDuplicate ищет в клиенте торрент с указанным хешем. Ошибка запроса не мешает
+// добавлению: при недоступном клиенте добавление все равно завершится понятной ошибкой.
+func checkDuplicate(client DownloadClient, hash string) error {
+	if hash == "" {
+		return nil
+	}
+	existing, err := client.List([]string{hash})
+	if err != nil || len(existing) == 0 {
+		return nil
+	}
+	return &DuplicateError{Torrent: existing[0]}
+}
+
+// checkSpace проверяет, что после загрузки size байт в папке категории останется настроенный запас.
+// Если клиент не сообщает свободное место, проверка пропускается.
+func checkSpace(client DownloadClient, cfg *config.Config, category config.Category, size int64) error {
+	free, err := client.FreeSpace(category.Path)
+	if err != nil {
+		logger.Warn("Skipping free space check", map[string]interface{}{
+			"path":  category.Path,
+			"error": err.Error(),
+		})
+		return nil
+	}
+
+	reserve := cfg.MinFreeSpace(category)
+	if free-size < reserve {
+		return &SpaceError{Path: category.Path, Free: free, Required: size, Reserve: reserve}
+	}
+	return nil
+}
+
+// cleanupTorrentFile удаляет .torrent-файл, который больше не нужен
+func cleanupTorrentFile(torrentPath string) {
+	if err := fileutils.CleanupTorrentFile(torrentPath); err != nil {
+		logger.Error("Failed to cleanup torrent file", map[string]interface{}{
+			"torrent_path": torrentPath,
+			"error":        err.Error(),
+		})
+	}
+}
+
+// notifyAdded сообщает пользователю об успешном добавлении торрента
+func notifyAdded(client DownloadClient, messenger Messenger, chatID int64, name, downloadPath string) {
+	message := fmt.Sprintf("Торрент %s добавлен в %s и будет загружен в папку \"%s\".", name, client.Name(), downloadPath)
+	if err := messenger.SendMessage(chatID, message); err != nil {
+		logger.Error("Failed to send message to Telegram", map[string]interface{}{
+			"chat_id": chatID,
+			"error":   err.Error(),
+		})
+	}
+
+	logger.Info("Torrent added to download client", map[string]interface{}{
+		"client":       client.Name(),
+		"torrent_name": name,
+		"download_dir": downloadPath,
+	})
+}
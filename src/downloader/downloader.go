@@ -0,0 +1,108 @@
+package downloader
+
+import (
+	"time"
+
+	"kinozal-bot/bencode"
+	"kinozal-bot/config"
+)
+
+// DownloadClient — торрент-клиент, которому бот передает загрузки.
+// Торренты идентифицируются инфо-хешем в нижнем регистре.
+type DownloadClient interface {
+	// Name возвращает название клиента для сообщений пользователю
+	Name() string
+	// AddFile добавляет торрент из содержимого .torrent-файла в папку категории и возвращает его хеш
+	AddFile(content []byte, category config.Category, files FileChoice) (string, error)
+	// AddMagnet добавляет торрент по magnet-ссылке в папку категории и возвращает его хеш
+	AddMagnet(link string, category config.Category) (string, error)
+	// List возвращает состояние торрентов с указанными хешами; без хешей — всех торрентов
+	List(hashes []string) ([]TorrentInfo, error)
+	// Get возвращает состояние торрента по хешу
+	Get(hash string) (*TorrentInfo, error)
+	// Pause ставит торрент на паузу
+	Pause(hash string) error
+	// Resume возобновляет загрузку торрента
+	Resume(hash string) error
+	// Remove удаляет торрент, при deleteData — вместе с загруженными файлами
+	Remove(hash string, deleteData bool) error
+	// FreeSpace возвращает свободное место в папке path, байт
+	FreeSpace(path string) (int64, error)
+}
+
+// UserRouter — клиент, который выбирает, куда добавить загрузку, с учетом пользователя
+type UserRouter interface {
+	ForUser(userID int64) DownloadClient
+}
+
+// ForUser возвращает клиент для загрузок пользователя userID. Клиенты без маршрутизации
+// по пользователям возвращаются без изменений.
+func ForUser(client DownloadClient, userID int64) DownloadClient {
+	if router, ok := client.(UserRouter); ok {
+		return router.ForUser(userID)
+	}
+	return client
+}
+
+// Messenger отправляет пользователю уведомление о добавленной загрузке
+type Messenger interface {
+	SendMessage(chatID int64, message string) error
+}
+
+// TorrentInfo — состояние торрента в клиенте
+type TorrentInfo struct {
+	Hash           string
+	Name           string
+	DownloadDir    string
+	Status         string
+	PercentDone    float64
+	ETA            time.Duration // отрицательное значение — время неизвестно
+	RateDownload   int64         // байт/с
+	RateUpload     int64         // байт/с
+	PeersConnected int64
+	TotalSize      int64 // байт
+	UploadRatio    float64
+	AddedDate      time.Time
+	DoneDate       time.Time
+	ErrorString    string
+	Stopped        bool
+}
+
+// IsComplete сообщает, загружен ли торрент полностью
+func (t TorrentInfo) IsComplete() bool {
+	return t.PercentDone >= 1
+}
+
+// FileChoice — выбор файлов многофайлового торрента. Индексы соответствуют порядку
+// файлов в метаинформации; файлы, не указанные ни в одном списке, загружаются
+// с обычным приоритетом. Нулевое значение означает загрузку всех файлов.
+type FileChoice struct {
+	Unwanted []int64 // файлы, которые не нужно загружать
+	High     []int64 // файлы с высоким приоритетом
+}
+
+// Size возвращает суммарный размер файлов торрента, которые будут загружены
+func (c FileChoice) Size(meta *bencode.Metainfo) int64 {
+	unwanted := make(map[int64]bool, len(c.Unwanted))
+	for _, index := range c.Unwanted {
+		unwanted[index] = true
+	}
+	var size int64
+	for index, file := range meta.Files {
+		if !unwanted[int64(index)] {
+			size += file.Length
+		}
+	}
+	return size
+}
+
+// IsEmpty сообщает, что выбраны все файлы с обычным приоритетом
+func (c FileChoice) IsEmpty() bool {
+	return len(c.Unwanted) == 0 && len(c.High) == 0
+}
+
+// AddOptions — дополнительные параметры добавления .torrent-файла
+type AddOptions struct {
+	Files           FileChoice
+	IgnoreFreeSpace bool // добавить, даже если на диске останется меньше настроенного запаса
+}
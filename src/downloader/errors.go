@@ -0,0 +1,54 @@
+package downloader
+
+import (
+	"fmt"
+
+	"kinozal-bot/fileutils"
+)
+
+// ErrUnsupported возвращается операциями, которые торрент-клиент не поддерживает,
+// например запросом состояния торрентов у папки наблюдения
+var ErrUnsupported = fmt.Errorf("operation is not supported by the download client")
+
+// DuplicateError возвращается, если торрент с тем же инфо-хешем уже есть в клиенте
+type DuplicateError struct {
+	Torrent TorrentInfo
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("torrent %s is already in the download client (%s)", e.Torrent.Hash, e.Torrent.DownloadDir)
+}
+
+// IsDuplicate сообщает, что торрент не добавлен, потому что уже есть в клиенте
+func IsDuplicate(err error) (*DuplicateError, bool) {
+	duplicate, ok := err.(*DuplicateError)
+	return duplicate, ok
+}
+
+// SpaceError возвращается, если после загрузки на диске останется меньше настроенного запаса
+type SpaceError struct {
+	Path     string
+	Free     int64 // свободно сейчас, байт
+	Required int64 // размер выбранных файлов торрента, байт
+	Reserve  int64 // сколько должно остаться после загрузки, байт
+}
+
+func (e *SpaceError) Error() string {
+	return fmt.Sprintf("not enough free space in %s: %d bytes free, %d required, %d reserved", e.Path, e.Free, e.Required, e.Reserve)
+}
+
+// Message описывает нехватку места для пользователя
+func (e *SpaceError) Message() string {
+	text := fmt.Sprintf("⚠️ Недостаточно места в папке %s: свободно %s, раздаче нужно %s",
+		e.Path, fileutils.FormatSize(e.Free), fileutils.FormatSize(e.Required))
+	if e.Reserve > 0 {
+		text += fmt.Sprintf(", а на диске должно остаться не меньше %s", fileutils.FormatSize(e.Reserve))
+	}
+	return text + "."
+}
+
+// IsSpaceError сообщает, что торрент не добавлен из-за нехватки места на диске
+func IsSpaceError(err error) (*SpaceError, bool) {
+	spaceErr, ok := err.(*SpaceError)
+	return spaceErr, ok
+}
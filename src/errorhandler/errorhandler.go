@@ -29,6 +29,9 @@ func (eh *ErrorHandler) Handle(err error, chatID int64) {
 	case *errors.TransmissionError:
 		userMessage = "Ошибка в работе с Transmission. Проверьте настройки."
 		logFields["details"] = e.Details
+	case *errors.DownloadClientError:
+		userMessage = "Ошибка в работе с торрент-клиентом. Проверьте настройки."
+		logFields["details"] = e.Details
 	default:
 		userMessage = "Неизвестная ошибка. Попробуйте позже."
 	}
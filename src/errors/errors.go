@@ -33,6 +33,16 @@ func (e *TransmissionError) Error() string {
 	return fmt.Sprintf("TransmissionError: %s", e.Message)
 }
 
+// DownloadClientError represents errors related to a download client
+type DownloadClientError struct {
+	Message string
+	Details map[string]interface{}
+}
+
+func (e *DownloadClientError) Error() string {
+	return fmt.Sprintf("DownloadClientError: %s", e.Message)
+}
+
 // Helper functions to create errors
 func NewBotError(message, code string, details map[string]interface{}) *BotError {
 	return &BotError{
@@ -54,4 +64,11 @@ func NewTransmissionError(message string, details map[string]interface{}) *Trans
 		Message: message,
 		Details: details,
 	}
-}
\ No newline at end of file
+}
+
+func NewDownloadClientError(message string, details map[string]interface{}) *DownloadClientError {
+	return &DownloadClientError{
+		Message: message,
+		Details: details,
+	}
+}
@@ -0,0 +1,351 @@
+package fileselect
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"kinozal-bot/bencode"
+	"kinozal-bot/callbacks"
+	"kinozal-bot/downloader"
+	"kinozal-bot/fileutils"
+	"kinozal-bot/logger"
+	"kinozal-bot/store"
+	"kinozal-bot/transmission"
+)
+
+// pageSize — количество строк списка файлов на одной странице
+const pageSize = 10
+
+// maxLabel — максимальная длина названия файла или папки на кнопке
+const maxLabel = 40
+
+// Состояния файла в списке. Нажатие на файл переключает их по кругу.
+const (
+	StateNormal = 0 // загрузить
+	StateHigh   = 1 // загрузить в первую очередь
+	StateSkip   = 2 // не загружать
+)
+
+// stateIcons — значки состояний на кнопках
+var stateIcons = map[int]string{
+	StateNormal: "✅",
+	StateHigh:   "⬆️",
+	StateSkip:   "⬜",
+}
+
+// Selection — выбор файлов раздачи, сделанный пользователем до выбора папки
+type Selection struct {
+	ChatID    int64       `json:"chat_id"`
+	KzID      string      `json:"kz_id"`
+	States    map[int]int `json:"states"` // индекс файла в метаинформации -> состояние; отсутствует — StateNormal
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// Choice переводит выбор в параметры добавления торрента в торрент-клиент
+func (s Selection) Choice() downloader.FileChoice {
+	var choice downloader.FileChoice
+	indexes := make([]int, 0, len(s.States))
+	for index := range s.States {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	for _, index := range indexes {
+		switch s.States[index] {
+		case StateSkip:
+			choice.Unwanted = append(choice.Unwanted, int64(index))
+		case StateHigh:
+			choice.High = append(choice.High, int64(index))
+		}
+	}
+	return choice
+}
+
+// row — строка списка: папка или файл
+type row struct {
+	Depth int
+	Name  string
+	Dir   bool
+	Files []int // индексы файлов, которые переключает строка
+	Size  int64
+}
+
+// Picker показывает список файлов торрента с переключателями и хранит сделанный выбор
+type Picker struct {
+	bot   transmission.BotInterface
+	db    store.Store
+	store *callbacks.Store
+}
+
+// New создает список выбора файлов
+func New(bot transmission.BotInterface, db store.Store, store *callbacks.Store) *Picker {
+	return &Picker{
+		bot:   bot,
+		db:    db,
+		store: store,
+	}
+}
+
+// Offer сообщает, стоит ли предлагать выбор файлов для торрента
+func Offer(meta *bencode.Metainfo) bool {
+	return meta != nil && meta.MultiFile && len(meta.Files) > 1
+}
+
+// Get возвращает выбор файлов раздачи kzID в чате chatID
+func (p *Picker) Get(chatID int64, kzID string) Selection {
+	selection := Selection{ChatID: chatID, KzID: kzID}
+	if _, err := p.db.Get(store.BucketSelections, selectionKey(chatID, kzID), &selection); err != nil {
+		logger.Warn("Failed to read file selection", map[string]interface{}{
+			"kz_id": kzID,
+			"error": err.Error(),
+		})
+	}
+	if selection.States == nil {
+		selection.States = make(map[int]int)
+	}
+	return selection
+}
+
+// Clear удаляет выбор файлов, например после добавления торрента
+func (p *Picker) Clear(chatID int64, kzID string) {
+	if err := p.db.Delete(store.BucketSelections, selectionKey(chatID, kzID)); err != nil {
+		logger.Warn("Failed to clear file selection", map[string]interface{}{
+			"kz_id": kzID,
+			"error": err.Error(),
+		})
+	}
+}
+
+// Summary описывает выбор одной строкой, например "Выбрано файлов: 3 из 10 (4.2 ГБ)"
+func Summary(meta *bencode.Metainfo, selection Selection) string {
+	count := 0
+	var size int64
+	for index, file := range meta.Files {
+		if selection.States[index] != StateSkip {
+			count++
+			size += file.Length
+		}
+	}
+	return fmt.Sprintf("Выбрано файлов: %d из %d (%s)", count, len(meta.Files), fileutils.FormatSize(size))
+}
+
+// HandleCallback открывает список файлов и обрабатывает переключение файлов, страниц
+// и выбор всех файлов, редактируя сообщение со списком
+func (p *Picker) HandleCallback(callback *tgbotapi.CallbackQuery, action callbacks.Action) {
+	answer := func(text string) {
+		if _, err := p.bot.AnswerCallbackQuery(tgbotapi.NewCallback(callback.ID, text)); err != nil {
+			logger.Warn("Failed to answer callback query", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	chatID := callback.Message.Chat.ID
+	meta, err := bencode.LoadMetainfo(torrentPath(action.KzID))
+	if err != nil {
+		answer("Файл торрента не найден. Начните загрузку заново.")
+		return
+	}
+	rows := buildRows(meta)
+	selection := p.Get(chatID, action.KzID)
+
+	switch action.Kind {
+	case callbacks.KindFileToggle:
+		if action.ItemID < 0 || int(action.ItemID) >= len(rows) {
+			answer("Список файлов изменился. Откройте его заново.")
+			return
+		}
+		toggle(selection, rows[action.ItemID])
+	case callbacks.KindFileSelectAll:
+		for index := range meta.Files {
+			if action.All {
+				delete(selection.States, index)
+			} else {
+				selection.States[index] = StateSkip
+			}
+		}
+	}
+	if action.Kind != callbacks.KindFilePage && action.Kind != callbacks.KindSelectFiles {
+		selection.UpdatedAt = time.Now()
+		if err := p.db.Put(store.BucketSelections, selectionKey(chatID, action.KzID), selection); err != nil {
+			logger.Error("Failed to save file selection", map[string]interface{}{
+				"kz_id": action.KzID,
+				"error": err.Error(),
+			})
+			answer("Не удалось сохранить выбор")
+			return
+		}
+	}
+	answer("")
+
+	text, keyboard := p.render(meta, rows, selection, action)
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, callback.Message.MessageID, text, keyboard)
+	if _, err := p.bot.Send(edit); err != nil {
+		logger.Warn("Failed to edit file list", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// render формирует страницу списка файлов
+func (p *Picker) render(meta *bencode.Metainfo, rows []row, selection Selection, action callbacks.Action) (string, tgbotapi.InlineKeyboardMarkup) {
+	pages := (len(rows) + pageSize - 1) / pageSize
+	page := action.Page
+	if page >= pages {
+		page = pages - 1
+	}
+	if page < 0 {
+		page = 0
+	}
+
+	// Все кнопки несут данные исходного действия, чтобы "Готово" вернуло к выбору папки
+	next := func(kind string, update func(*callbacks.Action)) string {
+		a := callbacks.Action{
+			Kind:     kind,
+			KzID:     action.KzID,
+			Name:     action.Name,
+			Section:  action.Section,
+			Category: action.Category,
+			Page:     page,
+		}
+		if update != nil {
+			update(&a)
+		}
+		return p.store.Put(a)
+	}
+
+	text := fmt.Sprintf("🗂 %s\n%s\n\n✅ — скачать, ⬆️ — скачать в первую очередь, ⬜ — пропустить.\nНажмите на файл или папку, чтобы переключить.",
+		meta.Name, Summary(meta, selection))
+
+	var keyboardRows [][]tgbotapi.InlineKeyboardButton
+	end := (page + 1) * pageSize
+	if end > len(rows) {
+		end = len(rows)
+	}
+	for i := page * pageSize; i < end; i++ {
+		r := rows[i]
+		label := fmt.Sprintf("%s%s %s", strings.Repeat("· ", r.Depth), rowIcon(selection, r), truncate(r.Name))
+		if r.Dir {
+			label += "/"
+		}
+		label += " — " + fileutils.FormatSize(r.Size)
+		index := int64(i)
+		keyboardRows = append(keyboardRows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(label, next(callbacks.KindFileToggle, func(a *callbacks.Action) { a.ItemID = index })),
+		))
+	}
+
+	if pages > 1 {
+		var navRow []tgbotapi.InlineKeyboardButton
+		if page > 0 {
+			navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData("◀️", next(callbacks.KindFilePage, func(a *callbacks.Action) { a.Page = page - 1 })))
+		}
+		navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d/%d", page+1, pages), p.store.Put(callbacks.Action{Kind: callbacks.KindNoop})))
+		if page < pages-1 {
+			navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData("▶️", next(callbacks.KindFilePage, func(a *callbacks.Action) { a.Page = page + 1 })))
+		}
+		keyboardRows = append(keyboardRows, navRow)
+	}
+
+	keyboardRows = append(keyboardRows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("Все", next(callbacks.KindFileSelectAll, func(a *callbacks.Action) { a.All = true })),
+		tgbotapi.NewInlineKeyboardButtonData("Ничего", next(callbacks.KindFileSelectAll, nil)),
+		tgbotapi.NewInlineKeyboardButtonData("✅ Готово", next(callbacks.KindFilesDone, nil)),
+	))
+	return text, tgbotapi.NewInlineKeyboardMarkup(keyboardRows...)
+}
+
+// buildRows строит плоский список папок и файлов в порядке дерева
+func buildRows(meta *bencode.Metainfo) []row {
+	indexes := make([]int, len(meta.Files))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		return meta.Files[indexes[i]].Name() < meta.Files[indexes[j]].Name()
+	})
+
+	var rows []row
+	dirRows := make(map[string]int) // путь папки -> номер строки
+	for _, index := range indexes {
+		file := meta.Files[index]
+		dirs := file.Path[:len(file.Path)-1]
+		for depth := range dirs {
+			key := strings.Join(dirs[:depth+1], "/")
+			n, ok := dirRows[key]
+			if !ok {
+				n = len(rows)
+				dirRows[key] = n
+				rows = append(rows, row{Depth: depth, Name: dirs[depth], Dir: true})
+			}
+			rows[n].Files = append(rows[n].Files, index)
+			rows[n].Size += file.Length
+		}
+		rows = append(rows, row{
+			Depth: len(dirs),
+			Name:  file.Path[len(file.Path)-1],
+			Files: []int{index},
+			Size:  file.Length,
+		})
+	}
+	return rows
+}
+
+// toggle переключает состояние строки: файлы папки получают следующее состояние,
+// если у всех оно одинаковое, иначе все становятся обычными
+func toggle(selection Selection, r row) {
+	state, uniform := commonState(selection, r)
+	next := StateNormal
+	if uniform {
+		next = (state + 1) % 3
+	}
+	for _, index := range r.Files {
+		if next == StateNormal {
+			delete(selection.States, index)
+		} else {
+			selection.States[index] = next
+		}
+	}
+}
+
+// commonState возвращает состояние файлов строки и признак того, что оно у всех одинаковое
+func commonState(selection Selection, r row) (int, bool) {
+	state := selection.States[r.Files[0]]
+	for _, index := range r.Files[1:] {
+		if selection.States[index] != state {
+			return state, false
+		}
+	}
+	return state, true
+}
+
+// rowIcon возвращает значок состояния строки; у папки со смешанным выбором — "➖"
+func rowIcon(selection Selection, r row) string {
+	state, uniform := commonState(selection, r)
+	if !uniform {
+		return "➖"
+	}
+	return stateIcons[state]
+}
+
+// truncate сокращает длинные названия, чтобы кнопка помещалась на экране
+func truncate(name string) string {
+	runes := []rune(name)
+	if len(runes) <= maxLabel {
+		return name
+	}
+	return string(runes[:maxLabel-1]) + "…"
+}
+
+// selectionKey возвращает ключ выбора файлов в хранилище
+func selectionKey(chatID int64, kzID string) string {
+	return strconv.FormatInt(chatID, 10) + ":" + kzID
+}
+
+// torrentPath возвращает путь к скачанному .torrent-файлу раздачи
+func torrentPath(kzID string) string {
+	return fmt.Sprintf("torrents/%s.torrent", kzID)
+}
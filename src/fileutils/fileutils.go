@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"kinozal-bot/errors"
 	"kinozal-bot/logger"
@@ -78,4 +80,46 @@ func GetFileSize(filePath string) (int64, error) {
 		)
 	}
 	return fileInfo.Size(), nil
-}
\ No newline at end of file
+}
+
+// FormatSize returns a human-readable representation of a size in bytes
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d Б", bytes)
+	}
+	units := []string{"КБ", "МБ", "ГБ", "ТБ", "ПБ"}
+	value := float64(bytes) / unit
+	i := 0
+	for value >= unit && i < len(units)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
+
+// sizeUnits maps size units used on Kinozal (Russian and English) to their multipliers
+var sizeUnits = map[string]float64{
+	"б": 1, "b": 1,
+	"кб": 1 << 10, "kb": 1 << 10,
+	"мб": 1 << 20, "mb": 1 << 20,
+	"гб": 1 << 30, "gb": 1 << 30,
+	"тб": 1 << 40, "tb": 1 << 40,
+}
+
+// ParseSize parses a human-readable size such as "14.57 ГБ" or "700 MB" into bytes
+func ParseSize(text string) (int64, bool) {
+	fields := strings.Fields(strings.ReplaceAll(text, ",", "."))
+	if len(fields) != 2 {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, false
+	}
+	multiplier, ok := sizeUnits[strings.ToLower(fields[1])]
+	if !ok {
+		return 0, false
+	}
+	return int64(value * multiplier), true
+}
@@ -10,6 +10,7 @@ require (
 	github.com/hekmon/transmissionrpc v1.1.0
 	github.com/joho/godotenv v1.5.1
 	github.com/sirupsen/logrus v1.9.3
+	go.etcd.io/bbolt v1.3.11
 	golang.org/x/text v0.20.0
 )
 
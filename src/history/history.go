@@ -0,0 +1,337 @@
+package history
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"kinozal-bot/callbacks"
+	"kinozal-bot/config"
+	"kinozal-bot/downloader"
+	"kinozal-bot/fileutils"
+	"kinozal-bot/logger"
+	"kinozal-bot/store"
+	"kinozal-bot/transmission"
+)
+
+// pageSize — количество записей на одной странице /history
+const pageSize = 5
+
+// Источники загрузок
+const (
+	SourceManual       = "manual"       // пользователь выбрал папку вручную
+	SourceSubscription = "subscription" // подписка заменила обновленную раздачу
+	SourceRule         = "rule"         // сработало правило автоматической загрузки
+)
+
+// Entry — запись о раздаче, успешно добавленной в торрент-клиент
+type Entry struct {
+	ID       int64     `json:"id"`
+	UserID   int64     `json:"user_id"`
+	ChatID   int64     `json:"chat_id"`
+	KzID     string    `json:"kz_id"`
+	Title    string    `json:"title"`
+	Size     int64     `json:"size"` // байт; 0, если размер неизвестен
+	Category string    `json:"category"`
+	Folder   string    `json:"folder"`
+	Hash     string    `json:"hash"`
+	Source   string    `json:"source"`
+	AddedAt  time.Time `json:"added_at"`
+}
+
+// Filter — условия отбора записей для /history
+type Filter struct {
+	All  bool // записи всех пользователей (только для администратора)
+	Days int  // только за последние Days дней; 0 — без ограничения
+}
+
+// History хранит историю загрузок в базе данных и показывает ее пользователям
+type History struct {
+	bot    transmission.BotInterface
+	cfg    *config.Config
+	client downloader.DownloadClient
+	db     store.Store
+	store  *callbacks.Store
+}
+
+// New создает историю загрузок
+func New(bot transmission.BotInterface, cfg *config.Config, client downloader.DownloadClient, db store.Store, store *callbacks.Store) *History {
+	return &History{
+		bot:    bot,
+		cfg:    cfg,
+		client: client,
+		db:     db,
+		store:  store,
+	}
+}
+
+// Record сохраняет запись о загрузке. Если размер неизвестен, он запрашивается у торрент-клиента.
+func (h *History) Record(entry Entry) {
+	if entry.Size == 0 && entry.Hash != "" {
+		if infos, err := h.client.List([]string{entry.Hash}); err == nil && len(infos) > 0 {
+			entry.Size = infos[0].TotalSize
+		}
+	}
+	if entry.AddedAt.IsZero() {
+		entry.AddedAt = time.Now()
+	}
+
+	id, err := h.db.NextID(store.BucketHistory)
+	if err == nil {
+		entry.ID = id
+		err = h.db.Put(store.BucketHistory, store.IDKey(id), entry)
+	}
+	if err != nil {
+		logger.Error("Failed to record download history", map[string]interface{}{
+			"kz_id": entry.KzID,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	logger.Info("Download recorded", map[string]interface{}{
+		"id":      entry.ID,
+		"kz_id":   entry.KzID,
+		"user_id": entry.UserID,
+		"source":  entry.Source,
+	})
+}
+
+// Get возвращает запись по ID
+func (h *History) Get(id int64) (Entry, bool) {
+	var entry Entry
+	found, err := h.db.Get(store.BucketHistory, store.IDKey(id), &entry)
+	if err != nil {
+		logger.Error("Failed to read download history", map[string]interface{}{
+			"id":    id,
+			"error": err.Error(),
+		})
+	}
+	return entry, found && err == nil
+}
+
+// ByRelease возвращает все загрузки раздачи kzID, начиная с последней
+func (h *History) ByRelease(kzID string) []Entry {
+	return h.find(func(entry Entry) bool {
+		return entry.KzID == kzID
+	})
+}
+
+// ByHash возвращает все загрузки торрента с инфо-хешем hash, начиная с последней
+func (h *History) ByHash(hash string) []Entry {
+	if hash == "" {
+		return nil
+	}
+	return h.find(func(entry Entry) bool {
+		return strings.EqualFold(entry.Hash, hash)
+	})
+}
+
+// List возвращает записи, подходящие под фильтр, начиная с последней
+func (h *History) List(userID int64, filter Filter) []Entry {
+	var since time.Time
+	if filter.Days > 0 {
+		since = time.Now().AddDate(0, 0, -filter.Days)
+	}
+	return h.find(func(entry Entry) bool {
+		if !filter.All && entry.UserID != userID {
+			return false
+		}
+		return since.IsZero() || entry.AddedAt.After(since)
+	})
+}
+
+// find возвращает записи, для которых match вернула true, начиная с последней
+func (h *History) find(match func(Entry) bool) []Entry {
+	var entries []Entry
+	err := h.db.ForEach(store.BucketHistory, func(key string, decode func(interface{}) error) error {
+		var entry Entry
+		if err := decode(&entry); err != nil {
+			return err
+		}
+		if match(entry) {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("Failed to read download history", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	// Ключи упорядочены по возрастанию ID, показываем сначала новые
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries
+}
+
+// ParseFilter разбирает аргументы /history: "all" и количество дней ("7" или "7d")
+func ParseFilter(args string) (Filter, error) {
+	var filter Filter
+	for _, field := range strings.Fields(strings.ToLower(args)) {
+		switch {
+		case field == "all" || field == "все":
+			filter.All = true
+		case field == "mine" || field == "мои":
+			filter.All = false
+		default:
+			days, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSuffix(field, "d"), "д"))
+			if err != nil || days <= 0 {
+				return Filter{}, fmt.Errorf("непонятный аргумент %q", field)
+			}
+			filter.Days = days
+		}
+	}
+	return filter, nil
+}
+
+// HandleHistory обрабатывает команду /history [mine|all] [дней]
+func (h *History) HandleHistory(chatID, userID int64, args string) {
+	filter, err := ParseFilter(args)
+	if err != nil {
+		h.bot.SendMessage(chatID, fmt.Sprintf("❌ %s. Например: /history, /history 7 или /history all 30", err.Error()))
+		return
+	}
+	if filter.All && userID != int64(h.cfg.Bot.AdminID) {
+		h.bot.SendMessage(chatID, "Историю всех пользователей может смотреть только администратор.")
+		return
+	}
+
+	text, keyboard := h.render(userID, filter, 0)
+	msg := tgbotapi.NewMessage(chatID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+	if _, err := h.bot.Send(msg); err != nil {
+		logger.Error("Failed to send download history", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// HandleCallback переключает страницу истории, редактируя исходное сообщение.
+// Страница строится для владельца истории из action.UserID, а не для нажавшего кнопку:
+// в групповом чате чужую историю может листать только сам владелец или администратор.
+func (h *History) HandleCallback(callback *tgbotapi.CallbackQuery, action callbacks.Action) {
+	answer := func(text string) {
+		if _, err := h.bot.AnswerCallbackQuery(tgbotapi.NewCallback(callback.ID, text)); err != nil {
+			logger.Warn("Failed to answer callback query", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	isAdmin := callback.From.ID == int64(h.cfg.Bot.AdminID)
+	if action.UserID == 0 {
+		answer("Кнопка устарела. Повторите /history.")
+		return
+	}
+	if action.UserID != callback.From.ID && !isAdmin {
+		answer("Это не ваша история")
+		return
+	}
+	filter := Filter{All: action.All, Days: action.Days}
+	if filter.All && !isAdmin {
+		answer("Историю всех пользователей может смотреть только администратор")
+		return
+	}
+	answer("")
+
+	text, keyboard := h.render(action.UserID, filter, action.Page)
+	var edit tgbotapi.EditMessageTextConfig
+	if keyboard != nil {
+		edit = tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, text, *keyboard)
+	} else {
+		edit = tgbotapi.NewEditMessageText(callback.Message.Chat.ID, callback.Message.MessageID, text)
+	}
+	if _, err := h.bot.Send(edit); err != nil {
+		logger.Warn("Failed to edit download history", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// render формирует страницу истории с кнопками повторной загрузки и навигации
+func (h *History) render(userID int64, filter Filter, page int) (string, *tgbotapi.InlineKeyboardMarkup) {
+	entries := h.List(userID, filter)
+	if len(entries) == 0 {
+		return "История загрузок пуста.", nil
+	}
+
+	pages := (len(entries) + pageSize - 1) / pageSize
+	if page < 0 {
+		page = 0
+	}
+	if page >= pages {
+		page = pages - 1
+	}
+	start := page * pageSize
+	end := start + pageSize
+	if end > len(entries) {
+		end = len(entries)
+	}
+
+	var b strings.Builder
+	b.WriteString("📜 История загрузок")
+	if filter.All {
+		b.WriteString(" всех пользователей")
+	}
+	if filter.Days > 0 {
+		b.WriteString(fmt.Sprintf(" за %d дн.", filter.Days))
+	}
+	b.WriteString(fmt.Sprintf(" (%d):\n\n", len(entries)))
+
+	var redownloadRow []tgbotapi.InlineKeyboardButton
+	for i, entry := range entries[start:end] {
+		number := start + i + 1
+		b.WriteString(fmt.Sprintf("%d. %s\n", number, entry.Title))
+
+		details := []string{entry.AddedAt.Format("02.01.2006 15:04")}
+		if entry.Size > 0 {
+			details = append(details, fileutils.FormatSize(entry.Size))
+		}
+		if category, ok := h.cfg.Category(entry.Category); ok {
+			details = append(details, category.Title())
+		} else if entry.Folder != "" {
+			details = append(details, entry.Folder)
+		}
+		if filter.All {
+			details = append(details, fmt.Sprintf("👤 %d", entry.UserID))
+		}
+		b.WriteString("   " + strings.Join(details, " · ") + "\n")
+
+		redownloadRow = append(redownloadRow, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🔁 %d", number), h.store.Put(callbacks.Action{
+			Kind:   callbacks.KindRedownload,
+			ItemID: entry.ID,
+		})))
+	}
+
+	keyboardRows := [][]tgbotapi.InlineKeyboardButton{redownloadRow}
+	if pages > 1 {
+		pageAction := func(target int) string {
+			return h.store.Put(callbacks.Action{
+				Kind:   callbacks.KindHistoryPage,
+				UserID: userID,
+				Page:   target,
+				All:    filter.All,
+				Days:   filter.Days,
+			})
+		}
+		var navRow []tgbotapi.InlineKeyboardButton
+		if page > 0 {
+			navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData("◀️", pageAction(page-1)))
+		}
+		navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d/%d", page+1, pages), h.store.Put(callbacks.Action{Kind: callbacks.KindNoop})))
+		if page < pages-1 {
+			navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData("▶️", pageAction(page+1)))
+		}
+		keyboardRows = append(keyboardRows, navRow)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(keyboardRows...)
+	return b.String(), &keyboard
+}
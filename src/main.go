@@ -5,29 +5,49 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
-	"sync"
 	"syscall"
 	"time"
-	"net/http"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"kinozal-bot/aria2"
+	"kinozal-bot/bencode"
+	"kinozal-bot/callbacks"
 	"kinozal-bot/config"
+	"kinozal-bot/deluge"
+	"kinozal-bot/downloader"
 	"kinozal-bot/errorhandler"
+	"kinozal-bot/fileselect"
+	"kinozal-bot/fileutils"
+	"kinozal-bot/history"
 	"kinozal-bot/logger"
 	"kinozal-bot/menu"
 	"kinozal-bot/middleware"
+	"kinozal-bot/qbittorrent"
+	"kinozal-bot/rules"
+	"kinozal-bot/search"
+	"kinozal-bot/status"
+	"kinozal-bot/store"
+	"kinozal-bot/subscriptions"
 	"kinozal-bot/torrent"
+	"kinozal-bot/tracker"
 	"kinozal-bot/transmission"
 	"kinozal-bot/usermanagement"
+	"kinozal-bot/watchdir"
+	"kinozal-bot/watchlist"
 )
 
 // Rate limiting for user requests
-var (
-	userLastRequest = make(map[int64]time.Time)
-	userRequestMutex = sync.RWMutex{}
-	requestCooldown = 10 * time.Second // 10 seconds cooldown between requests
-)
+const requestCooldown = 10 * time.Second // 10 seconds cooldown between requests
+
+// lastSearchKey — ключ раздела sessions со временем последнего поиска пользователя
+func lastSearchKey(userID int64) string {
+	return "last_search:" + strconv.FormatInt(userID, 10)
+}
+
+// Search results cache for pagination
+var searchCache = search.NewCache()
 
 // TelegramBotWrapper реализует интерфейс transmission.BotInterface
 type TelegramBotWrapper struct {
@@ -60,6 +80,17 @@ func main() {
 
 	logger.Info("Starting bot", nil)
 
+	// Состояние бота хранится во встроенной базе данных
+	db, err := store.Open(store.DefaultPath)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	defer db.Close()
+
+	if err := loadUsers(db, cfg); err != nil {
+		log.Fatalf("Failed to load users: %v", err)
+	}
+
 	bot, err := tgbotapi.NewBotAPI(cfg.Telegram.Token)
 	if err != nil {
 		logger.Error("Failed to create Telegram bot instance", map[string]interface{}{
@@ -74,6 +105,15 @@ func main() {
 	})
 
 	eh := &errorhandler.ErrorHandler{Bot: bot}
+
+	// Общая сессия Kinozal для всех пользователей бота
+	kzSession, err := torrent.NewKinozalSession(cfg, db)
+	if err != nil {
+		logger.Error("Failed to create Kinozal session", map[string]interface{}{
+			"error": err.Error(),
+		})
+		log.Fatalf("Failed to create Kinozal session: %v", err)
+	}
 	mw := &middleware.AccessMiddleware{Bot: bot, Cfg: cfg}
 
 	// Устанавливаем команды для текущего чата
@@ -92,11 +132,20 @@ func main() {
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
+	stop := make(chan struct{})
+
+	// Действия inline-кнопок хранятся на сервере, в callback data передается только токен
+	callbackStore := callbacks.NewStore(db, callbacks.DefaultTTL)
+	go callbackStore.Run(stop)
+
 	go func() {
 		for sig := range sigs {
 			logger.Info("Shutting down bot", map[string]interface{}{
 				"signal": sig.String(),
 			})
+			close(stop)
+			callbackStore.Flush()
+			db.Close()
 			bot.StopReceivingUpdates()
 			os.Exit(0)
 		}
@@ -104,6 +153,55 @@ func main() {
 
 	wrappedBot := &TelegramBotWrapper{Bot: bot}
 
+	// Торрент-клиент, которому передаются загрузки
+	downloadClient := newDownloadClient(cfg)
+	logger.Info("Download client selected", map[string]interface{}{
+		"client": downloadClient.Name(),
+	})
+
+	// Проверка доступности экземпляров Transmission, если их несколько
+	var transmissionMonitor *transmission.Monitor
+	if router, ok := downloadClient.(*transmission.Router); ok {
+		transmissionMonitor = transmission.NewMonitor(wrappedBot, cfg, router)
+		go transmissionMonitor.Run(stop)
+	}
+
+	// История загрузок для /history и предупреждений о повторных загрузках
+	downloadHistory := history.New(wrappedBot, cfg, downloadClient, db, callbackStore)
+
+	// Выбор файлов многофайловых торрентов перед выбором папки
+	filePicker := fileselect.New(wrappedBot, db, callbackStore)
+
+	// Отслеживание прогресса загрузок в торрент-клиенте
+	downloadTracker := tracker.New(wrappedBot, cfg, downloadClient, db)
+	go downloadTracker.Run(stop)
+
+	// Подписки на обновления сериалов
+	subscriptionManager := subscriptions.New(wrappedBot, cfg, downloadClient, kzSession, downloadTracker, downloadHistory, db)
+	go subscriptionManager.Run(stop)
+
+	// Сохраненные поиски с уведомлениями о новых раздачах
+	watchList := watchlist.New(wrappedBot, cfg, kzSession, db, callbackStore)
+	go watchList.Run(stop)
+
+	// Правила автоматической загрузки
+	rulesEngine := rules.New(wrappedBot, cfg, downloadClient, kzSession, downloadTracker, downloadHistory, db, callbackStore)
+	go rulesEngine.Run(stop)
+
+	deps := &callbackDeps{
+		bot:           wrappedBot,
+		cfg:           cfg,
+		client:        downloadClient,
+		kzSession:     kzSession,
+		tracker:       downloadTracker,
+		history:       downloadHistory,
+		filePicker:    filePicker,
+		subscriptions: subscriptionManager,
+		watchList:     watchList,
+		rules:         rulesEngine,
+		callbackStore: callbackStore,
+	}
+
 	for update := range updates {
 		if update.Message != nil {
 			logger.Info("Message received", map[string]interface{}{
@@ -121,11 +219,30 @@ func main() {
 			case "help":
 				menu.HandleHelp(bot, cfg, eh, update)
 			case "find":
-				handleFind(bot, cfg, eh, update)
+				handleFind(bot, kzSession, callbackStore, db, eh, update)
+			case "status":
+				status.HandleStatus(wrappedBot, downloadClient, callbackStore, update.Message.Chat.ID)
+			case "subscribe":
+				subscriptionManager.HandleSubscribe(update.Message.Chat.ID, update.Message.From.ID, update.Message.CommandArguments())
+			case "subscriptions":
+				subscriptionManager.HandleList(update.Message.Chat.ID, update.Message.From.ID, callbackStore)
+			case "watch":
+				watchList.HandleWatch(update.Message.Chat.ID, update.Message.From.ID, update.Message.CommandArguments())
+			case "watchlist":
+				watchList.HandleList(update.Message.Chat.ID, update.Message.From.ID)
+			case "rule":
+				rulesEngine.HandleRule(update.Message.Chat.ID, update.Message.From.ID, update.Message.CommandArguments())
+			case "rules":
+				rulesEngine.HandleList(update.Message.Chat.ID, update.Message.From.ID)
+			case "history":
+				downloadHistory.HandleHistory(update.Message.Chat.ID, update.Message.From.ID, update.Message.CommandArguments())
+			case "health":
+				handleHealth(wrappedBot, cfg, transmissionMonitor, update.Message.Chat.ID)
 			case "adduser", "removeuser", "listusers":
 				usermanagement.HandleUserCommands(
 					bot,
 					cfg,
+					db,
 					update.Message.Chat.ID,
 					update.Message.Command(),
 					update.Message.CommandArguments(),
@@ -136,26 +253,97 @@ func main() {
 		}
 	
 		if update.CallbackQuery != nil {
-			handleCallback(wrappedBot, cfg, update.CallbackQuery)
+			handleCallback(deps, update.CallbackQuery)
+		}
+	}
+}
+
+// newDownloadClient создает торрент-клиент, выбранный в DOWNLOAD_CLIENT
+func newDownloadClient(cfg *config.Config) downloader.DownloadClient {
+	switch cfg.DownloadClient {
+	case config.ClientQBittorrent:
+		return qbittorrent.New(cfg)
+	case config.ClientDeluge:
+		return deluge.New(cfg)
+	case config.ClientAria2:
+		return aria2.New(cfg)
+	case config.ClientWatchDir:
+		return watchdir.New(cfg)
+	default:
+		// Несколько экземпляров Transmission из config/transmission.json распределяются маршрутизатором
+		if len(cfg.TransmissionInstances) > 1 {
+			return transmission.NewRouter(cfg)
 		}
+		return transmission.New(cfg.TransmissionInstances[0])
 	}
 }
 
-func handleFind(bot *tgbotapi.BotAPI, cfg *config.Config, eh *errorhandler.ErrorHandler, update tgbotapi.Update) {
+// handleHealth отправляет администратору отчет о доступности экземпляров Transmission
+func handleHealth(bot transmission.BotInterface, cfg *config.Config, monitor *transmission.Monitor, chatID int64) {
+	if chatID != int64(cfg.Bot.AdminID) {
+		bot.SendMessage(chatID, "У вас нет прав для выполнения этой команды.")
+		return
+	}
+	if monitor == nil {
+		bot.SendMessage(chatID, "Проверка доступна, если в config/transmission.json настроено несколько экземпляров Transmission.")
+		return
+	}
+	monitor.HandleHealth(chatID)
+}
+
+// loadUsers заполняет список разрешенных пользователей из базы данных и записывает
+// в нее администратора из BOT_ADMIN_ID
+func loadUsers(db store.Store, cfg *config.Config) error {
+	admin := store.User{ID: int64(cfg.Bot.AdminID), Role: store.RoleAdmin}
+	if found, err := db.Get(store.BucketUsers, store.IDKey(admin.ID), &admin); err != nil {
+		return err
+	} else if !found || admin.Role != store.RoleAdmin {
+		if admin.AddedAt.IsZero() {
+			admin.AddedAt = time.Now()
+		}
+		admin.Role = store.RoleAdmin
+		if err := db.Put(store.BucketUsers, store.IDKey(admin.ID), admin); err != nil {
+			return err
+		}
+	}
+
+	users, err := store.Users(db)
+	if err != nil {
+		return err
+	}
+	cfg.Bot.AllowedUsers = nil
+	for _, user := range users {
+		if user.Role == store.RoleUser {
+			cfg.Bot.AllowedUsers = append(cfg.Bot.AllowedUsers, int(user.ID))
+		}
+	}
+	return nil
+}
+
+func handleFind(bot *tgbotapi.BotAPI, kzSession *torrent.KinozalSession, callbackStore *callbacks.Store, db store.Store, eh *errorhandler.ErrorHandler, update tgbotapi.Update) {
 	chatID := update.Message.Chat.ID
 	userID := update.Message.From.ID
-	query := update.Message.CommandArguments()
+	query, filters, err := torrent.ParseSearchQuery(update.Message.CommandArguments())
+	if err != nil {
+		bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("❌ Ошибка в фильтрах: %s", err.Error())))
+		return
+	}
 
-	if query == "" {
-		bot.Send(tgbotapi.NewMessage(chatID, "Пожалуйста, укажите поисковый запрос. Например: /find Матрица"))
+	if query == "" && filters.IsEmpty() {
+		bot.Send(tgbotapi.NewMessage(chatID, "Пожалуйста, укажите поисковый запрос. Например: /find Матрица или /find Дюна cat:films year:2021 q:2160p"))
 		return
 	}
 
 	// Check rate limiting
-	userRequestMutex.RLock()
-	lastRequest, exists := userLastRequest[int64(userID)]
-	userRequestMutex.RUnlock()
-	
+	var lastRequest time.Time
+	exists, err := db.Get(store.BucketSessions, lastSearchKey(userID), &lastRequest)
+	if err != nil {
+		logger.Warn("Failed to read last search time", map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+	}
+
 	if exists {
 		timeSinceLastRequest := time.Since(lastRequest)
 		if timeSinceLastRequest < requestCooldown {
@@ -166,9 +354,12 @@ func handleFind(bot *tgbotapi.BotAPI, cfg *config.Config, eh *errorhandler.Error
 	}
 
 	// Update last request time
-	userRequestMutex.Lock()
-	userLastRequest[int64(userID)] = time.Now()
-	userRequestMutex.Unlock()
+	if err := db.Put(store.BucketSessions, lastSearchKey(userID), time.Now()); err != nil {
+		logger.Warn("Failed to save last search time", map[string]interface{}{
+			"user_id": userID,
+			"error":   err.Error(),
+		})
+	}
 
 	// Notify user that search is starting
 	searchingMsg := tgbotapi.NewMessage(chatID, "🔍 Выполняется поиск, пожалуйста подождите...")
@@ -179,8 +370,7 @@ func handleFind(bot *tgbotapi.BotAPI, cfg *config.Config, eh *errorhandler.Error
 		})
 	}
 
-	client, _, err := torrent.LoginKinozal(cfg)
-	if err != nil {
+	if err := kzSession.EnsureLoggedIn(); err != nil {
 		// Delete searching message and send error
 		if sentMsg.MessageID != 0 {
 			deleteMsg := tgbotapi.NewDeleteMessage(chatID, sentMsg.MessageID)
@@ -191,7 +381,7 @@ func handleFind(bot *tgbotapi.BotAPI, cfg *config.Config, eh *errorhandler.Error
 		return
 	}
 
-	results, err := torrent.SearchTorrents(cfg, client, query)
+	results, err := torrent.SearchTorrents(kzSession, query, filters)
 	if err != nil {
 		// Delete searching message and send error
 		if sentMsg.MessageID != 0 {
@@ -220,25 +410,14 @@ func handleFind(bot *tgbotapi.BotAPI, cfg *config.Config, eh *errorhandler.Error
 		return
 	}
 
-	sendSearchResults(bot, chatID, results)
+	sendSearchResults(bot, callbackStore, chatID, strings.TrimSpace(query+" "+filters.String()), results)
 }
 
-func sendSearchResults(bot *tgbotapi.BotAPI, chatID int64, results []torrent.SearchResult) {
-	topResults := results
-	if len(results) > 7 {
-		topResults = results[:7]
-	}
+func sendSearchResults(bot *tgbotapi.BotAPI, callbackStore *callbacks.Store, chatID int64, query string, results []torrent.SearchResult) {
+	// Сохраняем полный набор результатов для постраничной навигации
+	cached := searchCache.Put(chatID, query, results)
 
-	var keyboardRows [][]tgbotapi.InlineKeyboardButton
-
-	messageText := "🔍 Найденные результаты:\n\n"
-	for _, result := range topResults {
-		messageText += fmt.Sprintf("🎬 %s\nSeeders: %d | Size: %s\n\n", result.Title, result.Seeders, result.Size)
-		button := tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("⬇ Скачать: %s", result.Title), fmt.Sprintf("startdownload_%s", result.ID))
-		keyboardRows = append(keyboardRows, tgbotapi.NewInlineKeyboardRow(button))
-	}
-
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(keyboardRows...)
+	messageText, keyboard := search.RenderPage(cached, 0, callbackStore)
 
 	msg := tgbotapi.NewMessage(chatID, messageText)
 	msg.ReplyMarkup = keyboard
@@ -250,118 +429,612 @@ func sendSearchResults(bot *tgbotapi.BotAPI, chatID int64, results []torrent.Sea
 	}
 }
 
-func handleCallback(bot transmission.BotInterface, cfg *config.Config, callback *tgbotapi.CallbackQuery) {
-	data := callback.Data
-	chatID := callback.Message.Chat.ID
+// callbackDeps — общие зависимости обработчиков нажатий inline-кнопок
+type callbackDeps struct {
+	bot           transmission.BotInterface
+	cfg           *config.Config
+	client        downloader.DownloadClient
+	kzSession     *torrent.KinozalSession
+	tracker       *tracker.Tracker
+	history       *history.History
+	filePicker    *fileselect.Picker
+	subscriptions *subscriptions.Manager
+	watchList     *watchlist.Watchlist
+	rules         *rules.Engine
+	callbackStore *callbacks.Store
+}
 
+// handleCallback находит действие нажатой кнопки и передает его обработчику
+func handleCallback(d *callbackDeps, callback *tgbotapi.CallbackQuery) {
+	bot := d.bot
+	action, ok := d.callbackStore.Resolve(callback.Data)
 	logger.Debug("Received callback data", map[string]interface{}{
-		"data": data,
+		"data":  callback.Data,
+		"kind":  action.Kind,
+		"found": ok,
 	})
 
-	if strings.HasPrefix(data, "startdownload_") {
-		kzID := strings.TrimPrefix(data, "startdownload_")
-		logger.Debug("Download button pressed", map[string]interface{}{
-			"kzID": kzID,
-		})
-	
-		if kzID == "" {
-			logger.Error("Invalid callback data: missing kzID", nil)
-			bot.SendMessage(chatID, "Ошибка: не указан ID раздачи.")
-			return
+	if !ok {
+		answerCallback(bot, callback, "Кнопка устарела. Повторите поиск.")
+		return
+	}
+
+	switch action.Kind {
+	case callbacks.KindNoop:
+		answerCallback(bot, callback, "")
+	case callbacks.KindPage:
+		handlePageCallback(bot, d.callbackStore, callback, action)
+	case callbacks.KindDetails:
+		handleDetailsCallback(bot, d.kzSession, d.callbackStore, callback, action)
+	case callbacks.KindCloseCard:
+		// Карточка отправляется отдельным сообщением под списком результатов, поэтому "Назад" просто удаляет ее
+		answerCallback(bot, callback, "")
+		if _, err := bot.Send(tgbotapi.NewDeleteMessage(callback.Message.Chat.ID, callback.Message.MessageID)); err != nil {
+			logger.Warn("Failed to delete details card", map[string]interface{}{
+				"error": err.Error(),
+			})
 		}
-	
-		kzName := fmt.Sprintf("Раздача-%s", kzID)
-		logger.Debug("Parsed callback data", map[string]interface{}{
-			"kzID":   kzID,
-			"kzName": kzName,
+	case callbacks.KindStartDownload:
+		answerCallback(bot, callback, "")
+		handleStartDownload(d, callback, action)
+	case callbacks.KindSelectFolder:
+		answerCallback(bot, callback, "")
+		handleSelectFolder(d, callback, action)
+	case callbacks.KindApproveAdd, callbacks.KindRejectAdd:
+		handleApproval(d, callback, action)
+	case callbacks.KindSelectFiles, callbacks.KindFileToggle, callbacks.KindFilePage, callbacks.KindFileSelectAll:
+		d.filePicker.HandleCallback(callback, action)
+	case callbacks.KindFilesDone:
+		handleFilesDone(d, callback, action)
+	case callbacks.KindStatusRefresh, callbacks.KindStatusPause, callbacks.KindStatusResume,
+		callbacks.KindStatusRemove, callbacks.KindStatusRemoveKeep, callbacks.KindStatusRemoveData, callbacks.KindStatusCancel:
+		status.HandleCallback(bot, d.cfg, d.client, d.tracker, d.callbackStore, callback, action)
+	case callbacks.KindUnsubscribe:
+		d.subscriptions.HandleCallback(callback, action)
+	case callbacks.KindUnwatch:
+		d.watchList.HandleCallback(callback, action)
+	case callbacks.KindRulePreview, callbacks.KindRuleDelete:
+		d.rules.HandleCallback(callback, action)
+	case callbacks.KindHistoryPage:
+		d.history.HandleCallback(callback, action)
+	case callbacks.KindRedownload:
+		handleRedownload(d, callback, action)
+	default:
+		logger.Warn("Unknown callback action", map[string]interface{}{
+			"kind": action.Kind,
 		})
-	
-		// Создаем HTTP клиент
-		httpClient := &http.Client{}
-		torrentPath, err := torrent.DownloadTorrent(cfg, httpClient, kzID)
-		if err != nil {
-			logger.Error("Failed to download torrent", map[string]interface{}{
-				"error":      err.Error(),
-				"torrent_id": kzID,
-			})
+		answerCallback(bot, callback, "Неизвестное действие")
+	}
+}
+
+// answerCallback отвечает на нажатие кнопки, убирая индикатор загрузки
+func answerCallback(bot transmission.BotInterface, callback *tgbotapi.CallbackQuery, text string) {
+	if _, err := bot.AnswerCallbackQuery(tgbotapi.NewCallback(callback.ID, text)); err != nil {
+		logger.Warn("Failed to answer callback query", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// handleRedownload повторно запускает загрузку раздачи из истории, предлагая прежнюю папку
+func handleRedownload(d *callbackDeps, callback *tgbotapi.CallbackQuery, action callbacks.Action) {
+	bot := d.bot
+	entry, ok := d.history.Get(action.ItemID)
+	if !ok {
+		answerCallback(bot, callback, "Запись истории не найдена")
+		return
+	}
+	if entry.UserID != callback.From.ID && callback.From.ID != int64(d.cfg.Bot.AdminID) {
+		answerCallback(bot, callback, "Это не ваша загрузка")
+		return
+	}
+	answerCallback(bot, callback, "")
+
+	handleStartDownload(d, callback, callbacks.Action{
+		Kind:     callbacks.KindStartDownload,
+		KzID:     entry.KzID,
+		Name:     entry.Title,
+		Category: entry.Category,
+	})
+}
+
+// handleStartDownload скачивает .torrent-файл раздачи и предлагает выбрать папку для загрузки
+func handleStartDownload(d *callbackDeps, callback *tgbotapi.CallbackQuery, action callbacks.Action) {
+	bot, cfg := d.bot, d.cfg
+	chatID := callback.Message.Chat.ID
+	kzID := action.KzID
+	if kzID == "" {
+		logger.Error("Invalid callback action: missing kzID", nil)
+		bot.SendMessage(chatID, "Ошибка: не указан ID раздачи.")
+		return
+	}
+
+	kzName := action.Name
+	if kzName == "" {
+		kzName = fmt.Sprintf("Раздача-%s", kzID)
+	}
+	logger.Debug("Download button pressed", map[string]interface{}{
+		"kzID":   kzID,
+		"kzName": kzName,
+	})
+
+	// Предупреждаем, если раздачу уже скачивали, чтобы не качать один сезон несколько раз
+	if previous := d.history.ByRelease(kzID); len(previous) > 0 {
+		last := previous[0]
+		bot.SendMessage(chatID, fmt.Sprintf("⚠️ Эта раздача уже скачивалась %d раз(а), последний раз %s в папку %s.",
+			len(previous), last.AddedAt.Format("02.01.2006 15:04"), last.Folder))
+	}
+
+	// Выбор файлов, сделанный при прошлой попытке скачать эту раздачу, больше не действует
+	d.filePicker.Clear(chatID, kzID)
+
+	// Содержимое раздачи показывается перед выбором папки, если .torrent-файл удалось скачать
+	var preview string
+	var offerFiles bool
+	torrentPath, err := torrent.DownloadTorrent(d.kzSession, kzID)
+	if err != nil {
+		logger.Error("Failed to download torrent", map[string]interface{}{
+			"error":      err.Error(),
+			"torrent_id": kzID,
+		})
+
+		// Проверяем, что раздачу можно добавить по magnet-ссылке
+		if _, hashErr := fetchMagnetLink(d.kzSession, kzID, kzName); hashErr != nil {
 			bot.SendMessage(chatID, fmt.Sprintf("Ошибка загрузки торрента: %s", err.Error()))
 			return
 		}
-	
+
+		// Файл, оставшийся от прошлой попытки, может не совпадать с текущей раздачей,
+		// поэтому решение добавить по magnet-ссылке передается дальше в действии кнопок
+		action.Magnet = true
+		if err == torrent.ErrDownloadLimit {
+			bot.SendMessage(chatID, "⚠️ Исчерпан суточный лимит скачивания .torrent-файлов на Kinozal. Раздача будет добавлена по magnet-ссылке.")
+		} else {
+			bot.SendMessage(chatID, "⚠️ Не удалось скачать .torrent-файл. Раздача будет добавлена по magnet-ссылке.")
+		}
+	} else {
 		logger.Info("Torrent downloaded successfully", map[string]interface{}{
 			"torrent_path": torrentPath,
 			"kzID":         kzID,
 		})
-	
-		// Формирование списка папок для выбора
-		var keyboardRows [][]tgbotapi.InlineKeyboardButton
-		for _, folder := range []struct {
-			Name string
-			Path string
-		}{
-			{"Фильмы", cfg.Folders.Films},
-			{"Сериалы", cfg.Folders.Series},
-			{"Аудиокниги", cfg.Folders.Audiobooks},
-		} {
-			if folder.Path == "" {
-				logger.Warn("Skipping empty folder path", map[string]interface{}{
-					"folder_name": folder.Name,
-				})
-				continue
+		if meta, err := bencode.LoadMetainfo(torrentPath); err == nil {
+			preview = torrent.RenderContents(meta) + "\n"
+			// В папку наблюдения выбор файлов передать нельзя
+			offerFiles = fileselect.Offer(meta) && cfg.DownloadClient != config.ClientWatchDir
+		}
+	}
+
+	action.Name = kzName
+	prompt, keyboardRows := folderKeyboard(cfg, downloader.ForUser(d.client, callback.From.ID), d.callbackStore, action, offerFiles)
+	if len(keyboardRows) == 0 {
+		bot.SendMessage(chatID, "Нет доступных папок для загрузки.")
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, preview+prompt)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboardRows...)
+	if _, err := bot.Send(msg); err != nil {
+		logger.Error("Failed to send folder selection buttons", map[string]interface{}{
+			"error": err.Error(),
+		})
+		bot.SendMessage(chatID, "Произошла ошибка при отображении списка папок.")
+	}
+}
+
+// handleFilesDone возвращает сообщение со списком файлов к выбору папки
+func handleFilesDone(d *callbackDeps, callback *tgbotapi.CallbackQuery, action callbacks.Action) {
+	bot := d.bot
+	chatID := callback.Message.Chat.ID
+	meta, err := bencode.LoadMetainfo(fmt.Sprintf("torrents/%s.torrent", action.KzID))
+	if err != nil {
+		answerCallback(bot, callback, "Файл торрента не найден. Начните загрузку заново.")
+		return
+	}
+	answerCallback(bot, callback, "")
+
+	prompt, keyboardRows := folderKeyboard(d.cfg, downloader.ForUser(d.client, callback.From.ID), d.callbackStore, action, true)
+	text := fmt.Sprintf("📦 %s\n%s\n\n%s", meta.Name, fileselect.Summary(meta, d.filePicker.Get(chatID, action.KzID)), prompt)
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, callback.Message.MessageID, text, tgbotapi.NewInlineKeyboardMarkup(keyboardRows...))
+	if _, err := bot.Send(edit); err != nil {
+		logger.Warn("Failed to show folder selection", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// folderKeyboard формирует приглашение и кнопки выбора папки. Если offerFiles, добавляется
+// кнопка выбора файлов многофайлового торрента.
+func folderKeyboard(cfg *config.Config, client downloader.DownloadClient, callbackStore *callbacks.Store, action callbacks.Action, offerFiles bool) (string, [][]tgbotapi.InlineKeyboardButton) {
+	selectAction := func(category config.Category) string {
+		return callbackStore.Put(callbacks.Action{
+			Kind:     callbacks.KindSelectFolder,
+			KzID:     action.KzID,
+			Name:     action.Name,
+			Category: category.ID,
+			Magnet:   action.Magnet,
+		})
+	}
+
+	// label добавляет к названию папки свободное место на диске. Место запрашивается
+	// у торрент-клиента один раз на путь; если запрос не удался, показывается только название.
+	freeSpace := make(map[string]string)
+	label := func(category config.Category) string {
+		free, ok := freeSpace[category.Path]
+		if !ok {
+			if bytes, err := client.FreeSpace(category.Path); err == nil {
+				free = " · " + fileutils.FormatSize(bytes)
 			}
-			button := tgbotapi.NewInlineKeyboardButtonData(folder.Name, fmt.Sprintf("selectfolder_%s_%s_%s", kzID, kzName, folder.Path))
-			keyboardRows = append(keyboardRows, tgbotapi.NewInlineKeyboardRow(button))
+			freeSpace[category.Path] = free
 		}
-	
-		if len(keyboardRows) == 0 {
-			bot.SendMessage(chatID, "Нет доступных папок для загрузки.")
-			return
+		return category.Title() + free
+	}
+
+	// Категория, определенная по разделу Kinozal и названию, показывается первой отдельной кнопкой
+	var keyboardRows [][]tgbotapi.InlineKeyboardButton
+	prompt := "Выберите папку для загрузки:"
+	suggested, hasSuggestion := cfg.CategoryForKind(action.Section)
+	if action.Category != "" {
+		// При повторной загрузке из истории предлагаем прежнюю папку
+		suggested, hasSuggestion = cfg.Category(action.Category)
+	}
+	if hasSuggestion {
+		prompt = fmt.Sprintf("Похоже, это %s. Подтвердите папку или выберите другую:", suggested.Title())
+		keyboardRows = append(keyboardRows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✅ "+label(suggested), selectAction(suggested)),
+		))
+	}
+
+	// Остальные категории, по две кнопки в ряд
+	var row []tgbotapi.InlineKeyboardButton
+	for _, category := range cfg.Categories {
+		if hasSuggestion && category.ID == suggested.ID {
+			continue
 		}
-	
-		msg := tgbotapi.NewMessage(chatID, "Выберите папку для загрузки:")
-		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboardRows...)
-		if _, err := bot.Send(msg); err != nil {
-			logger.Error("Failed to send folder selection buttons", map[string]interface{}{
-				"error": err.Error(),
-			})
-			bot.SendMessage(chatID, "Произошла ошибка при отображении списка папок.")
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(label(category), selectAction(category)))
+		if len(row) == 2 {
+			keyboardRows = append(keyboardRows, row)
+			row = nil
 		}
 	}
-	if strings.HasPrefix(data, "selectfolder_") {
-		logger.Debug("Folder selection detected", map[string]interface{}{
-			"data": data,
+	if len(row) > 0 {
+		keyboardRows = append(keyboardRows, row)
+	}
+
+	if offerFiles && len(keyboardRows) > 0 {
+		keyboardRows = append(keyboardRows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🗂 Выбрать файлы", callbackStore.Put(callbacks.Action{
+				Kind:     callbacks.KindSelectFiles,
+				KzID:     action.KzID,
+				Name:     action.Name,
+				Section:  action.Section,
+				Category: action.Category,
+			})),
+		))
+	}
+	return prompt, keyboardRows
+}
+
+// handleSelectFolder добавляет раздачу в торрент-клиент в выбранную папку и начинает отслеживать загрузку
+func handleSelectFolder(d *callbackDeps, callback *tgbotapi.CallbackQuery, action callbacks.Action) {
+	chatID := callback.Message.Chat.ID
+
+	logger.Debug("Category selected", map[string]interface{}{
+		"kzID":     action.KzID,
+		"kzName":   action.Name,
+		"category": action.Category,
+	})
+
+	if action.KzID == "" {
+		logger.Error("Invalid callback action for folder selection: missing kzID", nil)
+		d.bot.SendMessage(chatID, "Ошибка: Неверные данные для выбора папки.")
+		return
+	}
+
+	action.ChatID = chatID
+	action.UserID = callback.From.ID
+	addRelease(d, action, false)
+}
+
+// addRelease добавляет раздачу action.KzID в папку категории action.Category от имени пользователя
+// action.UserID. Если на диске не хватает места и force не указан, загрузка откладывается
+// до подтверждения администратором.
+func addRelease(d *callbackDeps, action callbacks.Action, force bool) {
+	bot, cfg := d.bot, d.cfg
+	chatID := action.ChatID
+	kzID := action.KzID
+	kzName := action.Name
+	// Экземпляр торрент-клиента выбирается по маршрутам пользователя, запросившего загрузку
+	client := downloader.ForUser(d.client, action.UserID)
+
+	category, ok := cfg.Category(action.Category)
+	if !ok {
+		logger.Warn("Selected category no longer exists", map[string]interface{}{
+			"category": action.Category,
 		})
-	
-		parts := strings.Split(data, "_")
-		if len(parts) < 4 {
-			logger.Error("Invalid callback data for folder selection", map[string]interface{}{
-				"data": data,
+		bot.SendMessage(chatID, "Ошибка: выбранная категория больше не существует. Начните загрузку заново.")
+		return
+	}
+	folderPath := category.Path
+
+	torrentPath := fmt.Sprintf("torrents/%s.torrent", kzID)
+
+	// track начинает отслеживать добавленную раздачу и записывает ее в историю
+	track := func(hash string) {
+		d.tracker.Track(tracker.Download{
+			Hash:   hash,
+			Name:   kzName,
+			KzID:   kzID,
+			Folder: folderPath,
+			ChatID: chatID,
+			UserID: action.UserID,
+		})
+		d.history.Record(history.Entry{
+			UserID:   action.UserID,
+			ChatID:   chatID,
+			KzID:     kzID,
+			Title:    kzName,
+			Category: category.ID,
+			Folder:   folderPath,
+			Hash:     hash,
+			Source:   history.SourceManual,
+		})
+	}
+
+	// Если .torrent-файл не удалось скачать при выборе раздачи или его уже нет на диске,
+	// добавляем раздачу по magnet-ссылке. Размер раздачи до получения метаданных неизвестен,
+	// поэтому место на диске не проверяется.
+	useMagnet := action.Magnet
+	if _, err := os.Stat(torrentPath); os.IsNotExist(err) {
+		useMagnet = true
+	}
+	if useMagnet {
+		magnetLink, err := fetchMagnetLink(d.kzSession, kzID, kzName)
+		if err != nil {
+			bot.SendMessage(chatID, "Ошибка: не удалось получить magnet-ссылку для раздачи.")
+			return
+		}
+		warnPreviousDownloads(bot, d.history, chatID, kzID, torrent.MagnetHash(magnetLink), folderPath)
+		hash, err := downloader.AddMagnet(client, magnetLink, category, kzName, chatID, bot)
+		if duplicate, ok := downloader.IsDuplicate(err); ok {
+			bot.SendMessage(chatID, tracker.RenderDuplicate(duplicate.Torrent))
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to add magnet link to download client", map[string]interface{}{
+				"error":       err.Error(),
+				"kzID":        kzID,
+				"folder_path": folderPath,
 			})
-			bot.SendMessage(chatID, "Ошибка: Неверные данные для выбора папки.")
+			bot.SendMessage(chatID, fmt.Sprintf("Ошибка добавления в %s: %s", client.Name(), err.Error()))
 			return
 		}
-	
-		kzID := parts[1]
-		kzName := parts[2]
-		folderPath := strings.Join(parts[3:], "_")
-	
-		logger.Debug("Parsed folder selection data", map[string]interface{}{
-			"kzID":       kzID,
-			"kzName":     kzName,
-			"folderPath": folderPath,
+		track(hash)
+		return
+	}
+
+	if !force {
+		if content, err := os.ReadFile(torrentPath); err == nil {
+			hash, _ := bencode.InfoHash(content)
+			warnPreviousDownloads(bot, d.history, chatID, kzID, hash, folderPath)
+		}
+	}
+	selection := d.filePicker.Get(chatID, kzID)
+	hash, err := downloader.AddTorrentFile(client, cfg, torrentPath, category, downloader.AddOptions{
+		Files:           selection.Choice(),
+		IgnoreFreeSpace: force,
+	}, kzName, chatID, bot)
+	if spaceErr, ok := downloader.IsSpaceError(err); ok {
+		// Выбор файлов и .torrent-файл сохраняются до решения администратора
+		requestApproval(bot, cfg, d.callbackStore, action, spaceErr)
+		return
+	}
+	d.filePicker.Clear(chatID, kzID)
+	if duplicate, ok := downloader.IsDuplicate(err); ok {
+		bot.SendMessage(chatID, tracker.RenderDuplicate(duplicate.Torrent))
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to add torrent to download client", map[string]interface{}{
+			"error":        err.Error(),
+			"torrent_path": torrentPath,
+			"folder_path":  folderPath,
 		})
-	
-		torrentPath := fmt.Sprintf("torrents/%s.torrent", kzID)
-		if err := transmission.AddToTransmission(torrentPath, folderPath, kzName, chatID, bot); err != nil {
-			logger.Error("Failed to add torrent to Transmission", map[string]interface{}{
-				"error":        err.Error(),
-				"torrent_path": torrentPath,
-				"folder_path":  folderPath,
-			})
-			bot.SendMessage(chatID, fmt.Sprintf("Ошибка добавления в Transmission: %s", err.Error()))
+		bot.SendMessage(chatID, fmt.Sprintf("Ошибка добавления в %s: %s", client.Name(), err.Error()))
+		return
+	}
+
+	bot.SendMessage(chatID, fmt.Sprintf("Торрент %s добавлен в папку %s.", kzName, folderPath))
+	track(hash)
+}
+
+// requestApproval просит администратора разрешить загрузку, после которой на диске
+// останется меньше настроенного запаса. Администратор подтверждает свои загрузки сам.
+func requestApproval(bot transmission.BotInterface, cfg *config.Config, callbackStore *callbacks.Store, action callbacks.Action, spaceErr *downloader.SpaceError) {
+	logger.Warn("Download needs admin approval: not enough free space", map[string]interface{}{
+		"kzID":     action.KzID,
+		"user_id":  action.UserID,
+		"path":     spaceErr.Path,
+		"free":     spaceErr.Free,
+		"required": spaceErr.Required,
+	})
+
+	approve := action
+	approve.Kind = callbacks.KindApproveAdd
+	reject := action
+	reject.Kind = callbacks.KindRejectAdd
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("✅ Добавить", callbackStore.Put(approve)),
+		tgbotapi.NewInlineKeyboardButtonData("❌ Отмена", callbackStore.Put(reject)),
+	))
+
+	adminChatID := int64(cfg.Bot.AdminID)
+	text := spaceErr.Message() + "\nВсе равно добавить?"
+	if action.UserID != adminChatID {
+		bot.SendMessage(action.ChatID, spaceErr.Message()+"\nЗапрос отправлен администратору.")
+		text = fmt.Sprintf("🙋 Пользователь %d хочет скачать «%s».\n%s\nРазрешить?", action.UserID, action.Name, spaceErr.Message())
+	}
+
+	msg := tgbotapi.NewMessage(adminChatID, text)
+	msg.ReplyMarkup = keyboard
+	if _, err := bot.Send(msg); err != nil {
+		logger.Error("Failed to send approval request", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// handleApproval обрабатывает решение администратора по загрузке, которой не хватает места
+func handleApproval(d *callbackDeps, callback *tgbotapi.CallbackQuery, action callbacks.Action) {
+	bot := d.bot
+	if callback.From.ID != int64(d.cfg.Bot.AdminID) {
+		answerCallback(bot, callback, "Решение принимает администратор")
+		return
+	}
+
+	// Решение принимается один раз: удаляем обе кнопки запроса, чтобы повторное нажатие
+	// не добавило раздачу еще раз
+	sibling := action
+	sibling.Kind = callbacks.KindRejectAdd
+	if action.Kind == callbacks.KindRejectAdd {
+		sibling.Kind = callbacks.KindApproveAdd
+	}
+	decided := d.callbackStore.Delete(action)
+	d.callbackStore.Delete(sibling)
+	if !decided {
+		answerCallback(bot, callback, "Решение уже принято")
+		return
+	}
+	answerCallback(bot, callback, "")
+
+	approved := action.Kind == callbacks.KindApproveAdd
+	verdict := "❌ Отклонено"
+	if approved {
+		verdict = "✅ Разрешено"
+	}
+	edit := tgbotapi.NewEditMessageTextAndMarkup(callback.Message.Chat.ID, callback.Message.MessageID, callback.Message.Text+"\n\n"+verdict,
+		tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}})
+	if _, err := bot.Send(edit); err != nil {
+		logger.Warn("Failed to update approval request", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	if approved {
+		addRelease(d, action, true)
+		return
+	}
+
+	d.filePicker.Clear(action.ChatID, action.KzID)
+	fileutils.CleanupTorrentFile(fmt.Sprintf("torrents/%s.torrent", action.KzID))
+	if action.ChatID != callback.Message.Chat.ID {
+		bot.SendMessage(action.ChatID, fmt.Sprintf("Администратор отклонил загрузку «%s»: на диске недостаточно места.", action.Name))
+	}
+}
+
+// warnPreviousDownloads предупреждает, если эта раздача или торрент с тем же инфо-хешем
+// уже скачивались в другую папку: загрузка в новую папку создаст вторую копию данных
+func warnPreviousDownloads(bot transmission.BotInterface, downloadHistory *history.History, chatID int64, kzID, hash, folderPath string) {
+	seen := map[string]bool{folderPath: true}
+	var folders []string
+	for _, entry := range append(downloadHistory.ByRelease(kzID), downloadHistory.ByHash(hash)...) {
+		if entry.Folder == "" || seen[entry.Folder] {
+			continue
+		}
+		seen[entry.Folder] = true
+		folders = append(folders, entry.Folder)
+	}
+	if len(folders) == 0 {
+		return
+	}
+	bot.SendMessage(chatID, fmt.Sprintf("⚠️ Раньше эта раздача скачивалась в другую папку: %s. Загрузка в %s создаст еще одну копию.",
+		strings.Join(folders, ", "), folderPath))
+}
+
+// handlePageCallback переключает страницу результатов поиска, редактируя исходное сообщение.
+// Кнопки старого сообщения не листают результаты более нового поиска того же чата.
+func handlePageCallback(bot transmission.BotInterface, callbackStore *callbacks.Store, callback *tgbotapi.CallbackQuery, action callbacks.Action) {
+	chatID := callback.Message.Chat.ID
+	page := action.Page
+
+	results, ok := searchCache.Get(chatID, action.ItemID)
+	if !ok {
+		answerCallback(bot, callback, "Результаты поиска устарели. Повторите /find.")
+		return
+	}
+
+	messageText, keyboard := search.RenderPage(results, page, callbackStore)
+	edit := tgbotapi.NewEditMessageTextAndMarkup(chatID, callback.Message.MessageID, messageText, keyboard)
+	if _, err := bot.Send(edit); err != nil {
+		logger.Error("Failed to edit search results page", map[string]interface{}{
+			"error": err.Error(),
+			"page":  page,
+		})
+	}
+	answerCallback(bot, callback, "")
+}
+
+// handleDetailsCallback показывает карточку раздачи
+func handleDetailsCallback(bot transmission.BotInterface, kzSession *torrent.KinozalSession, callbackStore *callbacks.Store, callback *tgbotapi.CallbackQuery, action callbacks.Action) {
+	chatID := callback.Message.Chat.ID
+	kzID := action.KzID
+
+	answerCallback(bot, callback, "")
+
+	if kzID == "" {
+		logger.Error("Invalid callback action: missing kzID", nil)
+		bot.SendMessage(chatID, "Ошибка: не указан ID раздачи.")
+		return
+	}
+
+	details, err := torrent.GetDetails(kzSession, kzID)
+	if err != nil {
+		logger.Error("Failed to get torrent details", map[string]interface{}{
+			"error":      err.Error(),
+			"torrent_id": kzID,
+		})
+		bot.SendMessage(chatID, "❌ Не удалось получить описание раздачи. Попробуйте позже.")
+		return
+	}
+
+	title := details.Title
+	if title == "" {
+		title = action.Name
+	}
+	keyboard := search.DetailsKeyboard(kzID, title, action.Section, callbackStore)
+
+	if details.PosterURL != "" {
+		photo := tgbotapi.NewPhoto(chatID, tgbotapi.FileURL(details.PosterURL))
+		photo.Caption = search.RenderDetails(details, search.CaptionLimit)
+		photo.ReplyMarkup = keyboard
+		_, err := bot.Send(photo)
+		if err == nil {
 			return
 		}
-	
-		bot.SendMessage(chatID, fmt.Sprintf("Торрент %s добавлен в папку %s.", kzName, folderPath))
+		logger.Warn("Failed to send details card with poster, falling back to text", map[string]interface{}{
+			"error":  err.Error(),
+			"poster": details.PosterURL,
+		})
 	}
-}
\ No newline at end of file
+
+	msg := tgbotapi.NewMessage(chatID, search.RenderDetails(details, search.MessageLimit))
+	msg.ReplyMarkup = keyboard
+	if _, err := bot.Send(msg); err != nil {
+		logger.Error("Failed to send details card", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// fetchMagnetLink получает инфо-хеш раздачи и формирует magnet-ссылку
+func fetchMagnetLink(kzSession *torrent.KinozalSession, kzID, kzName string) (string, error) {
+	hash, err := torrent.GetInfoHash(kzSession, kzID)
+	if err != nil {
+		logger.Error("Failed to get info hash", map[string]interface{}{
+			"error":      err.Error(),
+			"torrent_id": kzID,
+		})
+		return "", err
+	}
+
+	return torrent.MagnetLink(hash, kzName), nil
+}
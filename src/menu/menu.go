@@ -7,6 +7,7 @@ import (
 	"kinozal-bot/config"
 	"kinozal-bot/errorhandler"
 	"kinozal-bot/logger"
+	"kinozal-bot/store"
 	"kinozal-bot/usermanagement"
 )
 
@@ -16,6 +17,14 @@ func SetupBotCommands(bot *tgbotapi.BotAPI, cfg *config.Config, chatID int64) er
 		{Command: "start", Description: "Запустить бота и получить информацию"},
 		{Command: "help", Description: "Показать справку по использованию"},
 		{Command: "find", Description: "Найти торрент (например: /find Матрица)"},
+		{Command: "status", Description: "Показать торренты в торрент-клиенте"},
+		{Command: "subscribe", Description: "Подписаться на новые серии (ID раздачи или запрос)"},
+		{Command: "subscriptions", Description: "Показать подписки на сериалы"},
+		{Command: "watch", Description: "Сообщать о новых раздачах по запросу"},
+		{Command: "watchlist", Description: "Показать сохраненные поиски"},
+		{Command: "rule", Description: "Создать правило автозагрузки"},
+		{Command: "rules", Description: "Показать правила автозагрузки"},
+		{Command: "history", Description: "История загрузок (например: /history 7)"},
 	}
 
 	// Если пользователь — администратор, добавляем команды управления пользователями
@@ -24,6 +33,7 @@ func SetupBotCommands(bot *tgbotapi.BotAPI, cfg *config.Config, chatID int64) er
 			tgbotapi.BotCommand{Command: "adduser", Description: "Добавить пользователя в список разрешенных"},
 			tgbotapi.BotCommand{Command: "removeuser", Description: "Удалить пользователя из списка разрешенных"},
 			tgbotapi.BotCommand{Command: "listusers", Description: "Показать список разрешенных пользователей"},
+			tgbotapi.BotCommand{Command: "health", Description: "Показать состояние экземпляров Transmission"},
 		)
 	}
 
@@ -51,6 +61,10 @@ func HandleStart(bot *tgbotapi.BotAPI, cfg *config.Config, eh *errorhandler.Erro
 
 *Мои возможности:*
 🔍 Найдите раздачи: /find \<поисковый запрос\>
+📊 Следите за загрузками: /status
+🔔 Подпишитесь на новые серии: /subscribe \<ID раздачи или запрос\>
+👀 Ждите новые раздачи: /watch \<запрос с фильтрами\>
+🤖 Скачивайте автоматически: /rule \<правило\>
 🆘 Получите справку: /help
 
 `, escapeMarkdownV2(username))
@@ -60,7 +74,8 @@ func HandleStart(bot *tgbotapi.BotAPI, cfg *config.Config, eh *errorhandler.Erro
 		message += `👤 *Администрирование:*
 ▫️ /adduser \<ID\> \- добавить пользователя
 ▫️ /removeuser \<ID\> \- удалить пользователя
-▫️ /listusers \- показать список пользователей\.
+▫️ /listusers \- показать список пользователей
+▫️ /health \- состояние экземпляров Transmission\.
 `
 	}
 
@@ -90,6 +105,32 @@ func HandleHelp(bot *tgbotapi.BotAPI, cfg *config.Config, eh *errorhandler.Error
 
 🔍 *Поиск торрентов*
 /find - поиск торрентов по названию (например: /find Матрица)
+
+🎛 *Фильтры поиска* (можно комбинировать):
+cat: - раздел (films, series, cartoons, music, tv, audiobooks, games)
+q: - качество (sd, dvd, hd, 720p, 1080p, bluray, remux, 4k, 2160p)
+year: - год выпуска (например: year:2021)
+period: - когда добавлено (today, yesterday, 3days, week, month)
+Пример: /find Дюна cat:films year:2021 q:2160p
+
+📊 *Загрузки*
+/status - список торрентов в торрент-клиенте с кнопками паузы, возобновления и удаления
+
+🔔 *Подписки на сериалы*
+/subscribe <ID, ссылка или запрос> - следить за обновлениями раздачи и докачивать новые серии
+/subscriptions - список подписок с кнопками отписки
+
+👀 *Список наблюдения*
+/watch <запрос с фильтрами> - сообщать о новых раздачах по запросу (например: /watch Дюна q:2160p)
+/watchlist - сохраненные поиски с кнопками удаления
+
+🤖 *Правила автозагрузки*
+/rule <запрос с фильтрами> [re:<regex>] [size:4-20] [seeders:10] to:<категория> [mode:dry] - скачивать подходящие раздачи автоматически
+/rules - список правил с кнопками проверки и удаления
+
+📜 *История загрузок*
+/history [дней] - ваши загрузки с кнопками повторной загрузки (например: /history 7)
+/history all [дней] - загрузки всех пользователей (только для администратора)
 `
 
 	// Добавляем админские команды в справку, если пользователь — администратор
@@ -97,7 +138,8 @@ func HandleHelp(bot *tgbotapi.BotAPI, cfg *config.Config, eh *errorhandler.Error
 		helpMessage += `👤 *Администрирование:*
 /adduser <ID> - добавить пользователя
 /removeuser <ID> - удалить пользователя
-/listusers - показать список пользователей.
+/listusers - показать список пользователей
+/health - состояние экземпляров Transmission.
 `
 	}
 
@@ -106,12 +148,13 @@ func HandleHelp(bot *tgbotapi.BotAPI, cfg *config.Config, eh *errorhandler.Error
 	bot.Send(msg)
 }
 
-func HandleUserCommands(bot *tgbotapi.BotAPI, cfg *config.Config, eh *errorhandler.ErrorHandler, update tgbotapi.Update) {
+func HandleUserCommands(bot *tgbotapi.BotAPI, cfg *config.Config, db store.Store, eh *errorhandler.ErrorHandler, update tgbotapi.Update) {
 	switch update.Message.Command() {
 	case "adduser", "removeuser", "listusers":
 		usermanagement.HandleUserCommands(
 			bot,
 			cfg,
+			db,
 			update.Message.Chat.ID,
 			update.Message.Command(),
 			update.Message.CommandArguments(),
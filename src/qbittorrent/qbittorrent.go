@@ -0,0 +1,346 @@
+package qbittorrent
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kinozal-bot/bencode"
+	"kinozal-bot/config"
+	"kinozal-bot/downloader"
+	"kinozal-bot/errors"
+	"kinozal-bot/logger"
+)
+
+// Приоритеты файлов в qBittorrent WebUI API
+const (
+	priorityIgnore = 0
+	priorityHigh   = 6
+)
+
+// metadataWait — сколько ждать появления файлов добавленного торрента, чтобы выставить их приоритеты
+const metadataWait = 10 * time.Second
+
+// metadataPoll — как часто проверяется, появились ли файлы добавленного торрента
+const metadataPoll = 500 * time.Millisecond
+
+// Client передает загрузки в qBittorrent через WebUI API v2
+type Client struct {
+	cfg  *config.Config
+	http *http.Client
+
+	mu       sync.Mutex
+	loggedIn bool
+}
+
+// New создает клиент qBittorrent по настройкам из конфигурации
+func New(cfg *config.Config) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{
+		cfg: cfg,
+		http: &http.Client{
+			Jar:     jar,
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Name возвращает название клиента для сообщений пользователю
+func (c *Client) Name() string {
+	return "qBittorrent"
+}
+
+// AddFile добавляет торрент в qBittorrent в папку категории и возвращает его хеш.
+// qBittorrent не сообщает хеш добавленного торрента, поэтому он вычисляется из метаинформации.
+func (c *Client) AddFile(content []byte, category config.Category, files downloader.FileChoice) (string, error) {
+	hash, err := bencode.InfoHash(content)
+	if err != nil {
+		return "", errors.NewDownloadClientError("Invalid torrent file", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("torrents", hash+".torrent")
+	if err != nil {
+		return "", err
+	}
+	if _, err := part.Write(content); err != nil {
+		return "", err
+	}
+	// Торрент с выбором файлов добавляется на паузе, чтобы ненужные файлы не начали загружаться
+	fields := addFields(category)
+	if !files.IsEmpty() {
+		fields.Set("paused", "true")
+		fields.Set("stopped", "true")
+	}
+	for key := range fields {
+		if err := form.WriteField(key, fields.Get(key)); err != nil {
+			return "", err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	if err := c.add(&body, form.FormDataContentType()); err != nil {
+		return "", err
+	}
+
+	// Приоритеты выставляются в фоне: торрент появляется в qBittorrent не сразу, а ожидание
+	// задержало бы обработку сообщений бота и проверки правил и подписок
+	if !files.IsEmpty() {
+		go c.applyFileChoice(hash, files)
+	}
+	return hash, nil
+}
+
+// AddMagnet добавляет торрент в qBittorrent по magnet-ссылке. Хеш берется из ссылки вызывающей стороной.
+func (c *Client) AddMagnet(link string, category config.Category) (string, error) {
+	fields := addFields(category)
+	fields.Set("urls", link)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for key := range fields {
+		if err := form.WriteField(key, fields.Get(key)); err != nil {
+			return "", err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return "", err
+	}
+
+	if err := c.add(&body, form.FormDataContentType()); err != nil {
+		return "", err
+	}
+	return "", nil
+}
+
+// FreeSpace возвращает свободное место по данным qBittorrent, байт.
+// qBittorrent сообщает свободное место только на диске папки загрузок по умолчанию.
+func (c *Client) FreeSpace(path string) (int64, error) {
+	var state struct {
+		ServerState struct {
+			FreeSpaceOnDisk int64 `json:"free_space_on_disk"`
+		} `json:"server_state"`
+	}
+	if err := c.getJSON("/api/v2/sync/maindata", nil, &state); err != nil {
+		return 0, err
+	}
+	return state.ServerState.FreeSpaceOnDisk, nil
+}
+
+// addFields возвращает поля запроса torrents/add с настройками категории
+func addFields(category config.Category) url.Values {
+	fields := url.Values{}
+	fields.Set("savepath", category.Path)
+	if category.DownloadLimit > 0 {
+		fields.Set("dlLimit", strconv.FormatInt(category.DownloadLimit*1024, 10))
+	}
+	if category.UploadLimit > 0 {
+		fields.Set("upLimit", strconv.FormatInt(category.UploadLimit*1024, 10))
+	}
+	if category.SeedRatio > 0 {
+		fields.Set("ratioLimit", strconv.FormatFloat(category.SeedRatio, 'f', -1, 64))
+	}
+	// Метки категории становятся тегами qBittorrent
+	if len(category.Labels) > 0 {
+		fields.Set("tags", strings.Join(category.Labels, ","))
+	}
+	return fields
+}
+
+// add отправляет запрос torrents/add
+func (c *Client) add(body *bytes.Buffer, contentType string) error {
+	data := body.Bytes()
+	answer, err := c.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", c.endpoint("/api/v2/torrents/add"), bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(answer)) == "Fails." {
+		return errors.NewDownloadClientError("qBittorrent rejected the torrent", nil)
+	}
+	return nil
+}
+
+// applyFileChoice выставляет приоритеты файлов добавленного на паузе торрента и запускает его.
+// Торрент появляется в qBittorrent не сразу после ответа на torrents/add, поэтому список его
+// файлов запрашивается, пока не станет непустым. Если файлы так и не появились, торрент
+// остается на паузе, чтобы не скачать лишнего.
+func (c *Client) applyFileChoice(hash string, files downloader.FileChoice) {
+	deadline := time.Now().Add(metadataWait)
+	for {
+		var list []struct {
+			Index int64 `json:"index"`
+		}
+		if err := c.getJSON("/api/v2/torrents/files", url.Values{"hash": {hash}}, &list); err == nil && len(list) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			logger.Warn("Torrent files did not appear in qBittorrent, torrent left paused", map[string]interface{}{
+				"hash": hash,
+			})
+			return
+		}
+		time.Sleep(metadataPoll)
+	}
+
+	setPriority := func(indexes []int64, priority int) {
+		if len(indexes) == 0 {
+			return
+		}
+		ids := make([]string, len(indexes))
+		for i, index := range indexes {
+			ids[i] = strconv.FormatInt(index, 10)
+		}
+		err := c.postForm("/api/v2/torrents/filePrio", url.Values{
+			"hash":     {hash},
+			"id":       {strings.Join(ids, "|")},
+			"priority": {strconv.Itoa(priority)},
+		})
+		if err != nil {
+			logger.Warn("Failed to set file priorities in qBittorrent", map[string]interface{}{
+				"hash":  hash,
+				"error": err.Error(),
+			})
+		}
+	}
+	setPriority(files.Unwanted, priorityIgnore)
+	setPriority(files.High, priorityHigh)
+
+	if err := c.Resume(hash); err != nil {
+		logger.Warn("Failed to start torrent after setting file priorities", map[string]interface{}{
+			"hash":  hash,
+			"error": err.Error(),
+		})
+	}
+}
+
+// endpoint возвращает полный адрес метода WebUI API
+func (c *Client) endpoint(path string) string {
+	return strings.TrimRight(c.cfg.QBittorrent.URL, "/") + path
+}
+
+// login получает cookie сессии WebUI
+func (c *Client) login() error {
+	form := url.Values{
+		"username": {c.cfg.QBittorrent.Username},
+		"password": {c.cfg.QBittorrent.Password},
+	}
+	req, err := http.NewRequest("POST", c.endpoint("/api/v2/auth/login"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", c.cfg.QBittorrent.URL)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errors.NewDownloadClientError("Failed to connect to qBittorrent", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	defer resp.Body.Close()
+	answer, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(answer)) != "Ok." {
+		return errors.NewDownloadClientError("qBittorrent login failed", map[string]interface{}{
+			"status": resp.StatusCode,
+			"answer": strings.TrimSpace(string(answer)),
+		})
+	}
+	return nil
+}
+
+// do выполняет запрос к WebUI API и возвращает тело ответа. При первом запросе и
+// после истечения сессии (403) выполняется вход, и запрос повторяется.
+func (c *Client) do(build func() (*http.Request, error)) ([]byte, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		c.mu.Lock()
+		if !c.loggedIn {
+			if err := c.login(); err != nil {
+				c.mu.Unlock()
+				return nil, err
+			}
+			c.loggedIn = true
+		}
+		c.mu.Unlock()
+
+		req, err := build()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Referer", c.cfg.QBittorrent.URL)
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, errors.NewDownloadClientError("Failed to connect to qBittorrent", map[string]interface{}{
+				"url":   req.URL.Path,
+				"error": err.Error(),
+			})
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return body, nil
+		case http.StatusForbidden:
+			c.mu.Lock()
+			c.loggedIn = false
+			c.mu.Unlock()
+			continue
+		default:
+			return nil, &statusError{path: req.URL.Path, status: resp.StatusCode, body: strings.TrimSpace(string(body))}
+		}
+	}
+	return nil, errors.NewDownloadClientError("qBittorrent rejected the session", nil)
+}
+
+// postForm отправляет POST-запрос с полями формы
+func (c *Client) postForm(path string, form url.Values) error {
+	_, err := c.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", c.endpoint(path), strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	return err
+}
+
+// statusError — ответ WebUI API с неожиданным HTTP-статусом
+type statusError struct {
+	path   string
+	status int
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("qBittorrent %s returned HTTP %d: %s", e.path, e.status, e.body)
+}
+
+// isNotFound сообщает, что метода API нет в этой версии qBittorrent
+func isNotFound(err error) bool {
+	statusErr, ok := err.(*statusError)
+	return ok && statusErr.status == http.StatusNotFound
+}
@@ -0,0 +1,165 @@
+package qbittorrent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"kinozal-bot/downloader"
+	"kinozal-bot/errors"
+)
+
+// unknownETA — значение eta, которым qBittorrent обозначает неизвестное время
+const unknownETA = 8640000
+
+// torrent — элемент ответа torrents/info
+type torrent struct {
+	Hash         string  `json:"hash"`
+	Name         string  `json:"name"`
+	SavePath     string  `json:"save_path"`
+	State        string  `json:"state"`
+	Progress     float64 `json:"progress"`
+	ETA          int64   `json:"eta"`
+	DlSpeed      int64   `json:"dlspeed"`
+	UpSpeed      int64   `json:"upspeed"`
+	NumSeeds     int64   `json:"num_seeds"`
+	NumLeechs    int64   `json:"num_leechs"`
+	Size         int64   `json:"size"` // размер выбранных файлов
+	Ratio        float64 `json:"ratio"`
+	AddedOn      int64   `json:"added_on"`
+	CompletionOn int64   `json:"completion_on"`
+}
+
+// List возвращает состояние торрентов с указанными хешами.
+// Если хеши не указаны, возвращаются все торренты.
+func (c *Client) List(hashes []string) ([]downloader.TorrentInfo, error) {
+	var query url.Values
+	if len(hashes) > 0 {
+		query = url.Values{"hashes": {strings.Join(hashes, "|")}}
+	}
+
+	var torrents []torrent
+	if err := c.getJSON("/api/v2/torrents/info", query, &torrents); err != nil {
+		return nil, err
+	}
+
+	infos := make([]downloader.TorrentInfo, 0, len(torrents))
+	for _, t := range torrents {
+		infos = append(infos, toTorrentInfo(t))
+	}
+	return infos, nil
+}
+
+// Get возвращает состояние торрента по хешу
+func (c *Client) Get(hash string) (*downloader.TorrentInfo, error) {
+	infos, err := c.List([]string{hash})
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 {
+		return nil, errors.NewDownloadClientError("Torrent not found in qBittorrent", map[string]interface{}{
+			"hash": hash,
+		})
+	}
+	return &infos[0], nil
+}
+
+// Pause ставит торрент на паузу. В qBittorrent 5 метод pause переименован в stop.
+func (c *Client) Pause(hash string) error {
+	return c.torrentAction(hash, "/api/v2/torrents/pause", "/api/v2/torrents/stop")
+}
+
+// Resume возобновляет загрузку торрента. В qBittorrent 5 метод resume переименован в start.
+func (c *Client) Resume(hash string) error {
+	return c.torrentAction(hash, "/api/v2/torrents/resume", "/api/v2/torrents/start")
+}
+
+// Remove удаляет торрент из qBittorrent, при deleteData — вместе с загруженными файлами
+func (c *Client) Remove(hash string, deleteData bool) error {
+	err := c.postForm("/api/v2/torrents/delete", url.Values{
+		"hashes":      {hash},
+		"deleteFiles": {strconv.FormatBool(deleteData)},
+	})
+	if err != nil {
+		return errors.NewDownloadClientError("Failed to remove torrent", map[string]interface{}{
+			"hash":        hash,
+			"delete_data": deleteData,
+			"error":       err.Error(),
+		})
+	}
+	return nil
+}
+
+// torrentAction вызывает метод управления торрентом, а если его нет в этой версии qBittorrent — его новое название
+func (c *Client) torrentAction(hash, path, renamed string) error {
+	form := url.Values{"hashes": {hash}}
+	err := c.postForm(path, form)
+	if isNotFound(err) {
+		err = c.postForm(renamed, form)
+	}
+	if err != nil {
+		return errors.NewDownloadClientError("Failed to control torrent", map[string]interface{}{
+			"hash":   hash,
+			"method": path,
+			"error":  err.Error(),
+		})
+	}
+	return nil
+}
+
+// getJSON выполняет GET-запрос и разбирает ответ в формате JSON
+func (c *Client) getJSON(path string, query url.Values, result interface{}) error {
+	body, err := c.do(func() (*http.Request, error) {
+		address := c.endpoint(path)
+		if len(query) > 0 {
+			address += "?" + query.Encode()
+		}
+		return http.NewRequest("GET", address, nil)
+	})
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, result); err != nil {
+		return errors.NewDownloadClientError("Invalid response from qBittorrent", map[string]interface{}{
+			"url":   path,
+			"error": err.Error(),
+		})
+	}
+	return nil
+}
+
+// toTorrentInfo переводит элемент ответа torrents/info в TorrentInfo
+func toTorrentInfo(t torrent) downloader.TorrentInfo {
+	info := downloader.TorrentInfo{
+		Hash:           strings.ToLower(t.Hash),
+		Name:           t.Name,
+		DownloadDir:    t.SavePath,
+		Status:         t.State,
+		PercentDone:    t.Progress,
+		ETA:            -1,
+		RateDownload:   t.DlSpeed,
+		RateUpload:     t.UpSpeed,
+		PeersConnected: t.NumSeeds + t.NumLeechs,
+		TotalSize:      t.Size,
+		UploadRatio:    t.Ratio,
+	}
+	if t.ETA >= 0 && t.ETA < unknownETA {
+		info.ETA = time.Duration(t.ETA) * time.Second
+	}
+	if t.AddedOn > 0 {
+		info.AddedDate = time.Unix(t.AddedOn, 0)
+	}
+	if t.CompletionOn > 0 {
+		info.DoneDate = time.Unix(t.CompletionOn, 0)
+	}
+	switch t.State {
+	case "error", "missingFiles":
+		info.ErrorString = t.State
+	case "pausedDL", "pausedUP", "stoppedDL", "stoppedUP":
+		info.Stopped = true
+	}
+	return info
+}
@@ -0,0 +1,544 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"kinozal-bot/callbacks"
+	"kinozal-bot/config"
+	"kinozal-bot/downloader"
+	"kinozal-bot/fileutils"
+	"kinozal-bot/history"
+	"kinozal-bot/logger"
+	"kinozal-bot/store"
+	"kinozal-bot/torrent"
+	"kinozal-bot/tracker"
+	"kinozal-bot/transmission"
+)
+
+// checkInterval — период проверки правил
+const checkInterval = 1 * time.Hour
+
+// maxPerRun — сколько раздач одно правило может скачать за одну проверку,
+// чтобы слишком широкое правило не заполнило диск
+const maxPerRun = 3
+
+// maxPerUser — сколько правил может быть у одного пользователя
+const maxPerUser = 20
+
+// maxFired — сколько ID раздач, на которые сработало правило, хранится для исключения повторов
+const maxFired = 500
+
+// maxPreview — сколько раздач показывается при предварительной проверке правила
+const maxPreview = 10
+
+// Engine хранит правила автоматической загрузки и периодически применяет их к результатам поиска
+type Engine struct {
+	bot       transmission.BotInterface
+	cfg       *config.Config
+	client    downloader.DownloadClient
+	session   *torrent.KinozalSession
+	downloads *tracker.Tracker
+	history   *history.History
+	db        store.Store
+	store     *callbacks.Store
+
+	mu     sync.Mutex
+	items  []*Rule
+	nextID int64
+}
+
+// New создает движок правил и загружает сохраненные правила
+func New(bot transmission.BotInterface, cfg *config.Config, client downloader.DownloadClient, session *torrent.KinozalSession, downloads *tracker.Tracker, hist *history.History, db store.Store, store *callbacks.Store) *Engine {
+	e := &Engine{
+		bot:       bot,
+		cfg:       cfg,
+		client:    client,
+		session:   session,
+		downloads: downloads,
+		history:   hist,
+		db:        db,
+		store:     store,
+		nextID:    1,
+	}
+
+	if err := e.load(); err != nil {
+		logger.Warn("Failed to load rules", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return e
+}
+
+// HandleRule обрабатывает команду /rule <описание правила>
+func (e *Engine) HandleRule(chatID, userID int64, args string) {
+	if strings.TrimSpace(args) == "" {
+		e.bot.SendMessage(chatID, "Укажите правило. Например: /rule Дюна cat:films q:1080p size:4-20 seeders:10 to:films\nДобавьте mode:dry, чтобы только получать уведомления без загрузки.")
+		return
+	}
+
+	rule, err := ParseRule(args, e.cfg)
+	if err != nil {
+		e.bot.SendMessage(chatID, fmt.Sprintf("❌ Ошибка в правиле: %s", err.Error()))
+		return
+	}
+	rule.UserID = userID
+	rule.ChatID = chatID
+	rule.CreatedAt = time.Now()
+
+	e.mu.Lock()
+	count := 0
+	for _, item := range e.items {
+		if item.UserID == userID {
+			count++
+		}
+	}
+	if count >= maxPerUser {
+		e.mu.Unlock()
+		e.bot.SendMessage(chatID, fmt.Sprintf("❌ Можно создать не более %d правил. Удалите лишние через /rules.", maxPerUser))
+		return
+	}
+	rule.ID = e.nextID
+	e.nextID++
+	e.items = append(e.items, rule)
+	e.mu.Unlock()
+	e.save()
+
+	logger.Info("Rule added", map[string]interface{}{
+		"id":      rule.ID,
+		"user_id": userID,
+		"rule":    rule.String(),
+	})
+
+	text := fmt.Sprintf("🤖 Правило #%d сохранено: %s\nПроверка выполняется раз в час.", rule.ID, rule.String())
+	if rule.DryRun {
+		text += " В режиме mode:dry бот только сообщает о подходящих раздачах."
+	}
+	msg := tgbotapi.NewMessage(chatID, text)
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🧪 Проверить сейчас", e.store.Put(callbacks.Action{Kind: callbacks.KindRulePreview, ItemID: rule.ID})),
+	))
+	e.bot.Send(msg)
+}
+
+// HandleList обрабатывает команду /rules: показывает правила пользователя с кнопками проверки и удаления
+func (e *Engine) HandleList(chatID, userID int64) {
+	e.mu.Lock()
+	var own []Rule
+	for _, item := range e.items {
+		if item.UserID == userID {
+			own = append(own, *item)
+		}
+	}
+	e.mu.Unlock()
+
+	if len(own) == 0 {
+		e.bot.SendMessage(chatID, "У вас нет правил. Создайте правило: /rule <запрос с фильтрами> to:<категория>")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("🤖 Правила автозагрузки:\n\n")
+	var keyboardRows [][]tgbotapi.InlineKeyboardButton
+	for i, rule := range own {
+		b.WriteString(fmt.Sprintf("%d. %s\n   сработало: %d\n", i+1, rule.String(), len(rule.Fired)))
+		keyboardRows = append(keyboardRows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🧪 %d", i+1), e.store.Put(callbacks.Action{Kind: callbacks.KindRulePreview, ItemID: rule.ID})),
+			tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑 %d", i+1), e.store.Put(callbacks.Action{Kind: callbacks.KindRuleDelete, ItemID: rule.ID})),
+		))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, b.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboardRows...)
+	if _, err := e.bot.Send(msg); err != nil {
+		logger.Error("Failed to send rules list", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// HandleCallback обрабатывает кнопки проверки и удаления правила
+func (e *Engine) HandleCallback(callback *tgbotapi.CallbackQuery, action callbacks.Action) {
+	answer := func(text string) {
+		if _, err := e.bot.AnswerCallbackQuery(tgbotapi.NewCallback(callback.ID, text)); err != nil {
+			logger.Warn("Failed to answer callback query", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	e.mu.Lock()
+	var rule *Rule
+	index := -1
+	for i, item := range e.items {
+		if item.ID == action.ItemID {
+			rule, index = item, i
+			break
+		}
+	}
+	if rule == nil {
+		e.mu.Unlock()
+		answer("Правило уже удалено")
+		return
+	}
+	if rule.UserID != callback.From.ID && callback.From.ID != int64(e.cfg.Bot.AdminID) {
+		e.mu.Unlock()
+		answer("Это не ваше правило")
+		return
+	}
+	if action.Kind == callbacks.KindRuleDelete {
+		e.items = append(e.items[:index], e.items[index+1:]...)
+	}
+	e.mu.Unlock()
+
+	chatID := callback.Message.Chat.ID
+	switch action.Kind {
+	case callbacks.KindRuleDelete:
+		e.save()
+		logger.Info("Rule removed", map[string]interface{}{
+			"id":      rule.ID,
+			"user_id": callback.From.ID,
+		})
+		e.bot.SendMessage(chatID, fmt.Sprintf("🗑 Правило «%s» удалено.", rule.String()))
+		answer("Удалено")
+	case callbacks.KindRulePreview:
+		answer("Проверяю…")
+		e.preview(chatID, rule)
+	}
+}
+
+// preview показывает, на какие раздачи правило сработало бы сейчас, ничего не скачивая
+func (e *Engine) preview(chatID int64, rule *Rule) {
+	if err := e.session.EnsureLoggedIn(); err != nil {
+		e.bot.SendMessage(chatID, "❌ Ошибка при входе на Kinozal. Попробуйте позже.")
+		return
+	}
+
+	matches, err := e.evaluate(rule)
+	if err != nil {
+		e.bot.SendMessage(chatID, "❌ Ошибка поиска на Kinozal. Попробуйте позже.")
+		return
+	}
+	if len(matches) == 0 {
+		e.bot.SendMessage(chatID, fmt.Sprintf("🧪 Правило «%s» сейчас ни на что не сработает.", rule.String()))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🧪 Правило «%s» сработает на:\n\n", rule.String()))
+	for i, result := range matches {
+		if i == maxPreview {
+			b.WriteString(fmt.Sprintf("… и еще %d\n", len(matches)-maxPreview))
+			break
+		}
+		marker := ""
+		if i >= maxPerRun {
+			marker = " (в следующий раз)"
+		}
+		b.WriteString(fmt.Sprintf("%d. %s%s\nSeeders: %d | Size: %s\n\n", i+1, result.Title, marker, result.Seeders, result.Size))
+	}
+	e.bot.SendMessage(chatID, b.String())
+}
+
+// Run периодически применяет правила до закрытия канала stop
+func (e *Engine) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			e.checkAll(stop)
+		}
+	}
+}
+
+// checkAll применяет все правила по очереди
+func (e *Engine) checkAll(stop <-chan struct{}) {
+	e.mu.Lock()
+	items := make([]*Rule, len(e.items))
+	copy(items, e.items)
+	e.mu.Unlock()
+
+	if len(items) == 0 {
+		return
+	}
+
+	if err := e.session.EnsureLoggedIn(); err != nil {
+		logger.Warn("Skipping rules check: Kinozal login failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Частоту запросов к Kinozal ограничивает сессия
+	for _, rule := range items {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		e.check(rule)
+	}
+	e.save()
+}
+
+// check выполняет поиск правила и срабатывает на подходящие раздачи
+func (e *Engine) check(rule *Rule) {
+	matches, err := e.evaluate(rule)
+	if err != nil {
+		logger.Warn("Rule search failed", map[string]interface{}{
+			"id":    rule.ID,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	e.mu.Lock()
+	rule.CheckedAt = time.Now()
+	e.mu.Unlock()
+
+	for i, result := range matches {
+		if i == maxPerRun {
+			break
+		}
+		e.fire(rule, result)
+	}
+}
+
+// evaluate выполняет поиск правила и возвращает подходящие раздачи, на которые оно еще не срабатывало
+func (e *Engine) evaluate(rule *Rule) ([]torrent.SearchResult, error) {
+	query, filters, err := torrent.ParseSearchQuery(rule.Query)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := torrent.SearchTorrents(e.session, query, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var matches []torrent.SearchResult
+	for _, result := range results {
+		if rule.HasFired(result.ID) || e.downloads.HasRelease(result.ID) {
+			continue
+		}
+		if !rule.Match(result) {
+			continue
+		}
+		// Раздачу уже скачивали вручную или по другому правилу, и она могла уйти из трекера
+		if len(e.history.ByRelease(result.ID)) > 0 {
+			rule.addFired(result.ID)
+			continue
+		}
+		matches = append(matches, result)
+	}
+	return matches, nil
+}
+
+// fire отмечает срабатывание правила и скачивает раздачу или, в режиме mode:dry, только сообщает о ней
+func (e *Engine) fire(rule *Rule, result torrent.SearchResult) {
+	logger.Info("Rule fired", map[string]interface{}{
+		"id":         rule.ID,
+		"torrent_id": result.ID,
+		"title":      result.Title,
+		"dry_run":    rule.DryRun,
+	})
+
+	if rule.DryRun {
+		e.markFired(rule, result.ID)
+
+		msg := tgbotapi.NewMessage(rule.ChatID, fmt.Sprintf("🧪 Правило «%s» сработало бы на раздачу:\n%s\nSeeders: %d | Size: %s", rule.String(), result.Title, result.Seeders, result.Size))
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("Открыть карточку", e.store.Put(callbacks.Action{
+				Kind:    callbacks.KindDetails,
+				KzID:    result.ID,
+				Name:    result.Title,
+				Section: torrent.Classify(result),
+			})),
+		))
+		e.bot.Send(msg)
+		return
+	}
+
+	category, ok := e.cfg.Category(rule.Category)
+	if !ok {
+		logger.Warn("Rule refers to unknown category", map[string]interface{}{
+			"id":       rule.ID,
+			"category": rule.Category,
+		})
+		e.bot.SendMessage(rule.ChatID, fmt.Sprintf("⚠️ Правило «%s» ссылается на несуществующую категорию. Пересоздайте его.", rule.String()))
+		return
+	}
+
+	// После сообщения о нехватке места правило повторяет попытку молча, пока место не освободится
+	e.mu.Lock()
+	retry := rule.SpaceReported(result.ID)
+	e.mu.Unlock()
+	if !retry {
+		e.bot.SendMessage(rule.ChatID, fmt.Sprintf("🤖 Сработало правило «%s»: %s", rule.String(), result.Title))
+	}
+	err := e.download(rule, result, category)
+	if duplicate, ok := downloader.IsDuplicate(err); ok {
+		e.bot.SendMessage(rule.ChatID, tracker.RenderDuplicate(duplicate.Torrent))
+		e.markFired(rule, result.ID)
+		return
+	}
+	if spaceErr, ok := downloader.IsSpaceError(err); ok {
+		// Правило сработает снова при следующей проверке; о нехватке места сообщается один раз на раздачу
+		if !retry {
+			e.markNoSpace(rule, result.ID)
+			e.bot.SendMessage(rule.ChatID, spaceErr.Message()+"\nРаздача будет скачана, когда место освободится.")
+		}
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to download release for rule", map[string]interface{}{
+			"id":         rule.ID,
+			"torrent_id": result.ID,
+			"error":      err.Error(),
+		})
+		e.bot.SendMessage(rule.ChatID, fmt.Sprintf("❌ Не удалось добавить раздачу в %s: %s", e.client.Name(), err.Error()))
+		return
+	}
+
+	e.markFired(rule, result.ID)
+}
+
+// markFired запоминает раздачу, на которую сработало правило
+func (e *Engine) markFired(rule *Rule, kzID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	rule.addFired(kzID)
+}
+
+// markNoSpace запоминает раздачу, о нехватке места для которой правило уже сообщило
+func (e *Engine) markNoSpace(rule *Rule, kzID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rule.NoSpace = append(rule.NoSpace, kzID)
+	if len(rule.NoSpace) > maxFired {
+		rule.NoSpace = rule.NoSpace[len(rule.NoSpace)-maxFired:]
+	}
+}
+
+// download скачивает .torrent (или, если Kinozal отказал, использует magnet-ссылку),
+// добавляет раздачу в торрент-клиент и начинает отслеживать загрузку
+func (e *Engine) download(rule *Rule, result torrent.SearchResult, category config.Category) error {
+	var hash string
+	client := downloader.ForUser(e.client, rule.UserID)
+	torrentPath, err := torrent.DownloadTorrent(e.session, result.ID)
+	if err != nil {
+		infoHash, hashErr := torrent.GetInfoHash(e.session, result.ID)
+		if hashErr != nil {
+			return err
+		}
+		hash, err = downloader.AddMagnet(client, torrent.MagnetLink(infoHash, result.Title), category, result.Title, rule.ChatID, e.bot)
+	} else {
+		hash, err = downloader.AddTorrentFile(client, e.cfg, torrentPath, category, downloader.AddOptions{}, result.Title, rule.ChatID, e.bot)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.downloads.Track(tracker.Download{
+		Hash:   hash,
+		Name:   result.Title,
+		KzID:   result.ID,
+		Folder: category.Path,
+		ChatID: rule.ChatID,
+		UserID: rule.UserID,
+	})
+	size, _ := fileutils.ParseSize(result.Size)
+	e.history.Record(history.Entry{
+		UserID:   rule.UserID,
+		ChatID:   rule.ChatID,
+		KzID:     result.ID,
+		Title:    result.Title,
+		Size:     size,
+		Category: category.ID,
+		Folder:   category.Path,
+		Hash:     hash,
+		Source:   history.SourceRule,
+	})
+	return nil
+}
+
+// load читает правила из базы данных
+func (e *Engine) load() error {
+	var items []*Rule
+	err := e.db.ForEach(store.BucketRules, func(key string, decode func(interface{}) error) error {
+		rule := &Rule{}
+		if err := decode(rule); err != nil {
+			return err
+		}
+		items = append(items, rule)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, rule := range items {
+		if err := rule.compile(); err != nil {
+			logger.Warn("Skipping rule with invalid regex", map[string]interface{}{
+				"id":    rule.ID,
+				"error": err.Error(),
+			})
+			continue
+		}
+		e.items = append(e.items, rule)
+		if rule.ID >= e.nextID {
+			e.nextID = rule.ID + 1
+		}
+	}
+	return nil
+}
+
+// save сохраняет правила в базу данных и удаляет из нее удаленные пользователем
+func (e *Engine) save() {
+	e.mu.Lock()
+	items := make(map[string]Rule, len(e.items))
+	for _, rule := range e.items {
+		saved := *rule
+		saved.Fired = append([]string(nil), rule.Fired...)
+		saved.NoSpace = append([]string(nil), rule.NoSpace...)
+		items[store.IDKey(rule.ID)] = saved
+	}
+	e.mu.Unlock()
+
+	var stale []string
+	err := e.db.ForEach(store.BucketRules, func(key string, decode func(interface{}) error) error {
+		if _, ok := items[key]; !ok {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+	for _, key := range stale {
+		if err == nil {
+			err = e.db.Delete(store.BucketRules, key)
+		}
+	}
+	for key, rule := range items {
+		if err == nil {
+			err = e.db.Put(store.BucketRules, key, rule)
+		}
+	}
+	if err != nil {
+		logger.Error("Failed to save rules", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
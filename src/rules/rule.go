@@ -0,0 +1,228 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"kinozal-bot/config"
+	"kinozal-bot/fileutils"
+	"kinozal-bot/torrent"
+)
+
+// gigabyte — множитель для ограничений размера, которые задаются в гигабайтах
+const gigabyte = 1 << 30
+
+// Rule — правило автоматической загрузки. Поиск выполняется по Query (с фильтрами cat:, q:, year:, period:),
+// а найденные раздачи дополнительно проверяются по названию, размеру и числу сидов.
+type Rule struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	ChatID     int64     `json:"chat_id"`
+	Query      string    `json:"query"`
+	TitleRegex string    `json:"title_regex,omitempty"`
+	MinSizeGB  float64   `json:"min_size_gb,omitempty"`
+	MaxSizeGB  float64   `json:"max_size_gb,omitempty"`
+	MinSeeders int       `json:"min_seeders,omitempty"`
+	Category   string    `json:"category"`           // ID категории загрузок из конфигурации
+	DryRun     bool      `json:"dry_run,omitempty"`  // только сообщать о подходящих раздачах, не скачивая их
+	Fired      []string  `json:"fired"`              // ID раздач, на которые правило уже сработало
+	NoSpace    []string  `json:"no_space,omitempty"` // ID раздач, о нехватке места для которых уже сообщено
+	CreatedAt  time.Time `json:"created_at"`
+	CheckedAt  time.Time `json:"checked_at"`
+
+	titleRe *regexp.Regexp
+}
+
+// ParseRule разбирает описание правила вида
+// "Дюна cat:films q:1080p re:(?i)дюна size:4-20 seeders:10 to:films mode:dry".
+// Ключи re:, size:, seeders:, to: и mode: относятся к правилу, остальное — поисковый запрос с фильтрами.
+func ParseRule(input string, cfg *config.Config) (*Rule, error) {
+	rule := &Rule{}
+	var words []string
+
+	for _, token := range strings.Fields(input) {
+		key, value, found := strings.Cut(token, ":")
+		if !found || value == "" {
+			words = append(words, token)
+			continue
+		}
+
+		switch strings.ToLower(key) {
+		case "re", "regex":
+			rule.TitleRegex = value
+		case "size":
+			min, max, err := parseSizeRange(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.MinSizeGB, rule.MaxSizeGB = min, max
+		case "seeders", "seeds":
+			seeders, err := strconv.Atoi(value)
+			if err != nil || seeders < 0 {
+				return nil, fmt.Errorf("некорректное число сидов %q", value)
+			}
+			rule.MinSeeders = seeders
+		case "to":
+			rule.Category = value
+		case "mode":
+			if strings.ToLower(value) != "dry" {
+				return nil, fmt.Errorf("неизвестный режим %q, доступен: dry", value)
+			}
+			rule.DryRun = true
+		default:
+			words = append(words, token)
+		}
+	}
+
+	rule.Query = strings.Join(words, " ")
+	query, filters, err := torrent.ParseSearchQuery(rule.Query)
+	if err != nil {
+		return nil, err
+	}
+	if query == "" && filters.IsEmpty() {
+		return nil, fmt.Errorf("не указан поисковый запрос")
+	}
+
+	if rule.Category == "" {
+		return nil, fmt.Errorf("не указана категория загрузки (to:<категория>)")
+	}
+	if _, ok := cfg.Category(rule.Category); !ok {
+		var ids []string
+		for _, category := range cfg.Categories {
+			ids = append(ids, category.ID)
+		}
+		return nil, fmt.Errorf("неизвестная категория %q, доступны: %s", rule.Category, strings.Join(ids, ", "))
+	}
+
+	if err := rule.compile(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+// compile подготавливает регулярное выражение для проверки названия
+func (r *Rule) compile() error {
+	if r.TitleRegex == "" {
+		r.titleRe = nil
+		return nil
+	}
+	re, err := regexp.Compile(r.TitleRegex)
+	if err != nil {
+		return fmt.Errorf("некорректное регулярное выражение %q: %s", r.TitleRegex, err.Error())
+	}
+	r.titleRe = re
+	return nil
+}
+
+// Match проверяет, подходит ли результат поиска под условия правила
+func (r *Rule) Match(result torrent.SearchResult) bool {
+	if r.titleRe != nil && !r.titleRe.MatchString(result.Title) {
+		return false
+	}
+	if result.Seeders < r.MinSeeders {
+		return false
+	}
+	if r.MinSizeGB > 0 || r.MaxSizeGB > 0 {
+		size, ok := fileutils.ParseSize(result.Size)
+		if !ok {
+			return false
+		}
+		if r.MinSizeGB > 0 && float64(size) < r.MinSizeGB*gigabyte {
+			return false
+		}
+		if r.MaxSizeGB > 0 && float64(size) > r.MaxSizeGB*gigabyte {
+			return false
+		}
+	}
+	return true
+}
+
+// HasFired сообщает, срабатывало ли правило на раздачу
+func (r *Rule) HasFired(kzID string) bool {
+	for _, id := range r.Fired {
+		if id == kzID {
+			return true
+		}
+	}
+	return false
+}
+
+// addFired запоминает раздачу, на которую сработало правило, и забывает о нехватке места для нее.
+// Вызывается под блокировкой движка правил.
+func (r *Rule) addFired(kzID string) {
+	r.Fired = append(r.Fired, kzID)
+	if len(r.Fired) > maxFired {
+		r.Fired = r.Fired[len(r.Fired)-maxFired:]
+	}
+	for i, id := range r.NoSpace {
+		if id == kzID {
+			r.NoSpace = append(r.NoSpace[:i], r.NoSpace[i+1:]...)
+			break
+		}
+	}
+}
+
+// SpaceReported сообщает, было ли уже отправлено уведомление о нехватке места для раздачи
+func (r *Rule) SpaceReported(kzID string) bool {
+	for _, id := range r.NoSpace {
+		if id == kzID {
+			return true
+		}
+	}
+	return false
+}
+
+// String возвращает описание правила в том же синтаксисе, в котором оно вводится
+func (r *Rule) String() string {
+	parts := []string{r.Query}
+	if r.TitleRegex != "" {
+		parts = append(parts, "re:"+r.TitleRegex)
+	}
+	if r.MinSizeGB > 0 || r.MaxSizeGB > 0 {
+		size := "size:"
+		if r.MinSizeGB > 0 {
+			size += strconv.FormatFloat(r.MinSizeGB, 'f', -1, 64)
+		}
+		size += "-"
+		if r.MaxSizeGB > 0 {
+			size += strconv.FormatFloat(r.MaxSizeGB, 'f', -1, 64)
+		}
+		parts = append(parts, size)
+	}
+	if r.MinSeeders > 0 {
+		parts = append(parts, fmt.Sprintf("seeders:%d", r.MinSeeders))
+	}
+	parts = append(parts, "to:"+r.Category)
+	if r.DryRun {
+		parts = append(parts, "mode:dry")
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseSizeRange разбирает диапазон размера в гигабайтах: "4-20", "4-" или "-20"
+func parseSizeRange(value string) (float64, float64, error) {
+	minText, maxText, found := strings.Cut(value, "-")
+	if !found {
+		return 0, 0, fmt.Errorf("некорректный размер %q, ожидается диапазон в ГБ, например size:4-20", value)
+	}
+
+	var min, max float64
+	var err error
+	if minText != "" {
+		if min, err = strconv.ParseFloat(strings.ReplaceAll(minText, ",", "."), 64); err != nil || min < 0 {
+			return 0, 0, fmt.Errorf("некорректный минимальный размер %q", minText)
+		}
+	}
+	if maxText != "" {
+		if max, err = strconv.ParseFloat(strings.ReplaceAll(maxText, ",", "."), 64); err != nil || max < 0 {
+			return 0, 0, fmt.Errorf("некорректный максимальный размер %q", maxText)
+		}
+	}
+	if max > 0 && min > max {
+		return 0, 0, fmt.Errorf("минимальный размер больше максимального")
+	}
+	return min, max, nil
+}
@@ -0,0 +1,90 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"kinozal-bot/callbacks"
+	"kinozal-bot/torrent"
+)
+
+// CaptionLimit — максимальная длина подписи к фото в Telegram
+const CaptionLimit = 1024
+
+// MessageLimit — максимальная длина текстового сообщения в Telegram
+const MessageLimit = 4096
+
+// maxListedFiles — сколько файлов раздачи показывать в карточке
+const maxListedFiles = 10
+
+// RenderDetails формирует текст карточки раздачи, укладываясь в limit символов.
+// При нехватке места в первую очередь сокращается описание.
+func RenderDetails(details *torrent.Details, limit int) string {
+	var header strings.Builder
+	header.WriteString(fmt.Sprintf("🎬 %s\n\n", details.Title))
+	writeField(&header, "📅 Год", details.Year)
+	writeField(&header, "🎭 Жанр", details.Genre)
+	writeField(&header, "🗣 Перевод", details.Translation)
+	writeField(&header, "💿 Качество", details.Quality)
+	writeField(&header, "🎞 Видео", details.Video)
+	writeField(&header, "🔊 Аудио", details.Audio)
+	writeField(&header, "📦 Размер", details.Size)
+
+	var footer strings.Builder
+	if len(details.Files) > 0 {
+		footer.WriteString(fmt.Sprintf("\n📂 Файлы (%d):\n", len(details.Files)))
+		for i, file := range details.Files {
+			if i == maxListedFiles {
+				footer.WriteString(fmt.Sprintf("… и еще %d\n", len(details.Files)-maxListedFiles))
+				break
+			}
+			if file.Size != "" {
+				footer.WriteString(fmt.Sprintf("• %s (%s)\n", file.Name, file.Size))
+			} else {
+				footer.WriteString(fmt.Sprintf("• %s\n", file.Name))
+			}
+		}
+	}
+
+	text := header.String()
+	available := limit - utf8.RuneCountInString(text) - utf8.RuneCountInString(footer.String()) - 2
+	if details.Description != "" && available > 0 {
+		text += "\n" + truncate(details.Description, available) + "\n"
+	}
+	text += footer.String()
+
+	return truncate(text, limit)
+}
+
+// DetailsKeyboard возвращает кнопки карточки раздачи
+func DetailsKeyboard(torrentID, title, section string, store *callbacks.Store) tgbotapi.InlineKeyboardMarkup {
+	download := store.Put(callbacks.Action{Kind: callbacks.KindStartDownload, KzID: torrentID, Name: title, Section: section})
+	back := store.Put(callbacks.Action{Kind: callbacks.KindCloseCard})
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("⬇ Скачать", download),
+			tgbotapi.NewInlineKeyboardButtonData("◀ Назад", back),
+		),
+	)
+}
+
+func writeField(b *strings.Builder, label, value string) {
+	if value != "" {
+		b.WriteString(fmt.Sprintf("%s: %s\n", label, value))
+	}
+}
+
+// truncate обрезает строку до limit символов, добавляя многоточие
+func truncate(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	if limit <= 1 {
+		return ""
+	}
+	runes := []rune(text)
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,132 @@
+package search
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"kinozal-bot/callbacks"
+	"kinozal-bot/torrent"
+)
+
+// PageSize — количество результатов на одной странице
+const PageSize = 7
+
+// resultsTTL — время жизни закэшированных результатов поиска
+const resultsTTL = 1 * time.Hour
+
+// Results хранит полный набор результатов поиска для чата
+type Results struct {
+	ID        int64 // номер набора; кнопки страниц ссылаются на него, чтобы не листать чужой поиск
+	Query     string
+	Items     []torrent.SearchResult
+	CreatedAt time.Time
+}
+
+// Cache хранит последние результаты поиска для каждого чата
+type Cache struct {
+	mu      sync.RWMutex
+	entries map[int64]*Results
+	nextID  int64
+}
+
+// NewCache создает пустой кэш результатов поиска
+func NewCache() *Cache {
+	// Номера начинаются со времени запуска, чтобы кнопки, сохраненные до перезапуска бота,
+	// не совпали с номерами новых поисков
+	return &Cache{entries: make(map[int64]*Results), nextID: time.Now().UnixNano()}
+}
+
+// Put сохраняет результаты поиска для чата, заменяя предыдущие, и возвращает их
+func (c *Cache) Put(chatID int64, query string, items []torrent.SearchResult) *Results {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	results := &Results{
+		ID:        c.nextID,
+		Query:     query,
+		Items:     items,
+		CreatedAt: time.Now(),
+	}
+	c.entries[chatID] = results
+
+	// Попутно удаляем устаревшие записи других чатов
+	for id, entry := range c.entries {
+		if time.Since(entry.CreatedAt) > resultsTTL {
+			delete(c.entries, id)
+		}
+	}
+	return results
+}
+
+// Get возвращает результаты поиска id для чата, если они еще не устарели
+// и не заменены более новым поиском
+func (c *Cache) Get(chatID, id int64) (*Results, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.entries[chatID]
+	if !ok || entry.ID != id || time.Since(entry.CreatedAt) > resultsTTL {
+		return nil, false
+	}
+	return entry, true
+}
+
+// PageCount возвращает количество страниц для заданного числа результатов
+func PageCount(total int) int {
+	if total == 0 {
+		return 1
+	}
+	return (total + PageSize - 1) / PageSize
+}
+
+// RenderPage формирует текст и клавиатуру для страницы результатов.
+// Номер страницы начинается с нуля и приводится к допустимому диапазону.
+// Действия кнопок сохраняются в store, в callback data передаются только токены.
+func RenderPage(results *Results, page int, store *callbacks.Store) (string, tgbotapi.InlineKeyboardMarkup) {
+	pages := PageCount(len(results.Items))
+	if page < 0 {
+		page = 0
+	}
+	if page >= pages {
+		page = pages - 1
+	}
+
+	start := page * PageSize
+	end := start + PageSize
+	if end > len(results.Items) {
+		end = len(results.Items)
+	}
+
+	var keyboardRows [][]tgbotapi.InlineKeyboardButton
+
+	messageText := "🔍 Найденные результаты:\n\n"
+	for i, result := range results.Items[start:end] {
+		messageText += fmt.Sprintf("%d. 🎬 %s\nSeeders: %d | Size: %s\n\n", start+i+1, result.Title, result.Seeders, result.Size)
+		button := tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d. %s", start+i+1, result.Title), store.Put(callbacks.Action{
+			Kind:    callbacks.KindDetails,
+			KzID:    result.ID,
+			Name:    result.Title,
+			Section: torrent.Classify(result),
+		}))
+		keyboardRows = append(keyboardRows, tgbotapi.NewInlineKeyboardRow(button))
+	}
+	messageText += fmt.Sprintf("Страница %d из %d (всего: %d)", page+1, pages, len(results.Items))
+
+	// Кнопки навигации показываем только при наличии нескольких страниц
+	if pages > 1 {
+		var navRow []tgbotapi.InlineKeyboardButton
+		if page > 0 {
+			navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData("◀", store.Put(callbacks.Action{Kind: callbacks.KindPage, ItemID: results.ID, Page: page - 1})))
+		}
+		navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d/%d", page+1, pages), store.Put(callbacks.Action{Kind: callbacks.KindNoop})))
+		if page < pages-1 {
+			navRow = append(navRow, tgbotapi.NewInlineKeyboardButtonData("▶", store.Put(callbacks.Action{Kind: callbacks.KindPage, ItemID: results.ID, Page: page + 1})))
+		}
+		keyboardRows = append(keyboardRows, navRow)
+	}
+
+	return messageText, tgbotapi.NewInlineKeyboardMarkup(keyboardRows...)
+}
@@ -0,0 +1,29 @@
+package search
+
+import (
+	"testing"
+
+	"kinozal-bot/torrent"
+)
+
+func TestCacheGetChecksResultsID(t *testing.T) {
+	c := NewCache()
+	first := c.Put(1, "Дюна", []torrent.SearchResult{{ID: "1"}})
+	if got, ok := c.Get(1, first.ID); !ok || got != first {
+		t.Fatalf("Get(first) = %v, %v", got, ok)
+	}
+
+	second := c.Put(1, "Матрица", []torrent.SearchResult{{ID: "2"}})
+	if second.ID == first.ID {
+		t.Fatal("results of two searches share an ID")
+	}
+	if _, ok := c.Get(1, first.ID); ok {
+		t.Error("Get returned results of a newer search for an old ID")
+	}
+	if got, ok := c.Get(1, second.ID); !ok || got.Query != "Матрица" {
+		t.Errorf("Get(second) = %v, %v", got, ok)
+	}
+	if _, ok := c.Get(2, second.ID); ok {
+		t.Error("Get returned results of another chat")
+	}
+}
@@ -0,0 +1,241 @@
+package status
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"kinozal-bot/callbacks"
+	"kinozal-bot/config"
+	"kinozal-bot/downloader"
+	"kinozal-bot/logger"
+	"kinozal-bot/tracker"
+	"kinozal-bot/transmission"
+)
+
+// maxListed — сколько торрентов показывать в одном сообщении /status
+const maxListed = 10
+
+// HandleStatus отправляет список торрентов торрент-клиента с кнопками управления
+func HandleStatus(bot transmission.BotInterface, client downloader.DownloadClient, store *callbacks.Store, chatID int64) {
+	text, keyboard, err := render(client, store)
+	if err == downloader.ErrUnsupported {
+		bot.SendMessage(chatID, "ℹ️ Торренты передаются через папку наблюдения, и бот не видит их состояние. Смотрите загрузки в самом торрент-клиенте.")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to get torrents for /status", map[string]interface{}{
+			"error": err.Error(),
+		})
+		bot.SendMessage(chatID, fmt.Sprintf("❌ Не удалось получить список торрентов из %s.", client.Name()))
+		return
+	}
+
+	msg := tgbotapi.NewMessage(chatID, text)
+	if keyboard != nil {
+		msg.ReplyMarkup = *keyboard
+	}
+	if _, err := bot.Send(msg); err != nil {
+		logger.Error("Failed to send /status response", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// HandleCallback выполняет действие кнопки сообщения /status
+func HandleCallback(bot transmission.BotInterface, cfg *config.Config, client downloader.DownloadClient, downloads *tracker.Tracker, store *callbacks.Store, callback *tgbotapi.CallbackQuery, action callbacks.Action) {
+	chatID := callback.Message.Chat.ID
+	messageID := callback.Message.MessageID
+	hash := action.Hash
+
+	answer := func(text string) {
+		if _, err := bot.AnswerCallbackQuery(tgbotapi.NewCallback(callback.ID, text)); err != nil {
+			logger.Warn("Failed to answer callback query", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	switch action.Kind {
+	case callbacks.KindStatusRefresh:
+		refresh(bot, client, store, chatID, messageID)
+		answer("Обновлено")
+	case callbacks.KindStatusCancel:
+		bot.Send(tgbotapi.NewDeleteMessage(chatID, messageID))
+		answer("Отменено")
+	case callbacks.KindStatusPause:
+		if err := client.Pause(hash); err != nil {
+			logger.Error("Failed to pause torrent", map[string]interface{}{"hash": hash, "error": err.Error()})
+			answer("Не удалось поставить на паузу")
+			return
+		}
+		refresh(bot, client, store, chatID, messageID)
+		answer("⏸ Пауза")
+	case callbacks.KindStatusResume:
+		if err := client.Resume(hash); err != nil {
+			logger.Error("Failed to resume torrent", map[string]interface{}{"hash": hash, "error": err.Error()})
+			answer("Не удалось возобновить")
+			return
+		}
+		refresh(bot, client, store, chatID, messageID)
+		answer("▶ Возобновлено")
+	case callbacks.KindStatusRemove:
+		info, ok := authorizeRemoval(cfg, client, downloads, callback, hash, answer)
+		if !ok {
+			return
+		}
+		confirm := tgbotapi.NewMessage(chatID, fmt.Sprintf("🗑 Удалить торрент «%s»?", info.Name))
+		confirm.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Только торрент", store.Put(callbacks.Action{Kind: callbacks.KindStatusRemoveKeep, Hash: hash})),
+				tgbotapi.NewInlineKeyboardButtonData("Вместе с данными", store.Put(callbacks.Action{Kind: callbacks.KindStatusRemoveData, Hash: hash})),
+			),
+			tgbotapi.NewInlineKeyboardRow(
+				tgbotapi.NewInlineKeyboardButtonData("Отмена", store.Put(callbacks.Action{Kind: callbacks.KindStatusCancel})),
+			),
+		)
+		bot.Send(confirm)
+		answer("")
+	case callbacks.KindStatusRemoveKeep, callbacks.KindStatusRemoveData:
+		info, ok := authorizeRemoval(cfg, client, downloads, callback, hash, answer)
+		if !ok {
+			return
+		}
+		deleteData := action.Kind == callbacks.KindStatusRemoveData
+		if err := client.Remove(hash, deleteData); err != nil {
+			logger.Error("Failed to remove torrent", map[string]interface{}{"hash": hash, "error": err.Error()})
+			answer("Не удалось удалить торрент")
+			return
+		}
+
+		logger.Info("Torrent removed via /status", map[string]interface{}{
+			"hash":        hash,
+			"name":        info.Name,
+			"delete_data": deleteData,
+			"user_id":     callback.From.ID,
+		})
+
+		text := fmt.Sprintf("🗑 Торрент «%s» удален.", info.Name)
+		if deleteData {
+			text = fmt.Sprintf("🗑 Торрент «%s» удален вместе с данными.", info.Name)
+		}
+		bot.Send(tgbotapi.NewEditMessageText(chatID, messageID, text))
+		answer("Удалено")
+	default:
+		answer("Неизвестное действие")
+	}
+}
+
+// authorizeRemoval проверяет, что торрент удаляет администратор или пользователь, который его добавил
+func authorizeRemoval(cfg *config.Config, client downloader.DownloadClient, downloads *tracker.Tracker, callback *tgbotapi.CallbackQuery, hash string, answer func(string)) (*downloader.TorrentInfo, bool) {
+	info, err := client.Get(hash)
+	if err != nil {
+		answer("Торрент не найден")
+		return nil, false
+	}
+
+	userID := callback.From.ID
+	if userID == int64(cfg.Bot.AdminID) {
+		return info, true
+	}
+	if owner, ok := downloads.Owner(info.Hash); ok && owner == userID {
+		return info, true
+	}
+
+	logger.Warn("Unauthorized torrent removal attempt", map[string]interface{}{
+		"user_id": userID,
+		"hash":    hash,
+	})
+	answer("Удалять торрент может только администратор или тот, кто его добавил.")
+	return nil, false
+}
+
+// refresh перерисовывает сообщение /status
+func refresh(bot transmission.BotInterface, client downloader.DownloadClient, store *callbacks.Store, chatID int64, messageID int) {
+	text, keyboard, err := render(client, store)
+	if err != nil {
+		logger.Error("Failed to refresh /status", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+	edit.ReplyMarkup = keyboard
+	if _, err := bot.Send(edit); err != nil {
+		logger.Warn("Failed to edit /status message", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// render формирует текст и клавиатуру со списком торрентов
+func render(client downloader.DownloadClient, store *callbacks.Store) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	torrents, err := client.List(nil)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(torrents) == 0 {
+		return fmt.Sprintf("📭 В %s нет торрентов.", client.Name()), nil, nil
+	}
+
+	// Сначала активные загрузки, затем остальные, новые выше старых
+	sort.Slice(torrents, func(i, j int) bool {
+		ci, cj := torrents[i].IsComplete(), torrents[j].IsComplete()
+		if ci != cj {
+			return !ci
+		}
+		return torrents[i].AddedDate.After(torrents[j].AddedDate)
+	})
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("📊 Торренты в %s (%d):\n\n", client.Name(), len(torrents)))
+
+	var keyboardRows [][]tgbotapi.InlineKeyboardButton
+	for i, t := range torrents {
+		if i == maxListed {
+			b.WriteString(fmt.Sprintf("… и еще %d\n", len(torrents)-maxListed))
+			break
+		}
+
+		b.WriteString(fmt.Sprintf("%d. %s %s\n", i+1, statusIcon(t), t.Name))
+		if t.IsComplete() {
+			b.WriteString(fmt.Sprintf("%s 100%% | ⬆ %s | ⚖ %.2f\n\n", tracker.ProgressBar(1, 10), tracker.FormatSpeed(t.RateUpload), t.UploadRatio))
+		} else {
+			b.WriteString(fmt.Sprintf("%s %.1f%% | ⚡ %s | ⏱ %s | ⚖ %.2f\n\n",
+				tracker.ProgressBar(t.PercentDone, 10), t.PercentDone*100, tracker.FormatSpeed(t.RateDownload), tracker.FormatETA(t.ETA), t.UploadRatio))
+		}
+
+		var row []tgbotapi.InlineKeyboardButton
+		if t.Stopped {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("▶ %d", i+1), store.Put(callbacks.Action{Kind: callbacks.KindStatusResume, Hash: t.Hash})))
+		} else {
+			row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("⏸ %d", i+1), store.Put(callbacks.Action{Kind: callbacks.KindStatusPause, Hash: t.Hash})))
+		}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑 %d", i+1), store.Put(callbacks.Action{Kind: callbacks.KindStatusRemove, Hash: t.Hash})))
+		keyboardRows = append(keyboardRows, row)
+	}
+
+	keyboardRows = append(keyboardRows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData("🔄 Обновить", store.Put(callbacks.Action{Kind: callbacks.KindStatusRefresh})),
+	))
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(keyboardRows...)
+
+	return b.String(), &keyboard, nil
+}
+
+// statusIcon возвращает значок состояния торрента
+func statusIcon(t downloader.TorrentInfo) string {
+	switch {
+	case t.ErrorString != "":
+		return "⚠️"
+	case t.Stopped:
+		return "⏸"
+	case t.IsComplete():
+		return "⬆️"
+	default:
+		return "⬇️"
+	}
+}
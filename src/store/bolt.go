@@ -0,0 +1,109 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"kinozal-bot/errors"
+)
+
+// boltStore — хранилище во встроенной базе bbolt
+type boltStore struct {
+	db *bolt.DB
+}
+
+// openBolt открывает файл базы данных, создавая его при необходимости
+func openBolt(path string) (*boltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, errors.NewBotError("Failed to create database directory", "STORAGE_ERROR", map[string]interface{}{
+			"path":           path,
+			"original_error": err.Error(),
+		})
+	}
+
+	// Таймаут нужен, чтобы второй экземпляр бота не зависал на блокировке файла
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, errors.NewBotError("Failed to open database", "STORAGE_ERROR", map[string]interface{}{
+			"path":           path,
+			"original_error": err.Error(),
+		})
+	}
+	return &boltStore{db: db}, nil
+}
+
+func (s *boltStore) Get(bucket, key string, value interface{}) (bool, error) {
+	var data []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(key)); v != nil {
+			data = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	if err != nil || data == nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+func (s *boltStore) Put(bucket, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), data)
+	})
+}
+
+func (s *boltStore) Delete(bucket, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+func (s *boltStore) ForEach(bucket string, fn func(key string, decode func(interface{}) error) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			return fn(string(k), func(value interface{}) error {
+				return json.Unmarshal(v, value)
+			})
+		})
+	})
+}
+
+func (s *boltStore) NextID(bucket string) (int64, error) {
+	var id uint64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		id, err = b.NextSequence()
+		return err
+	})
+	return int64(id), err
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
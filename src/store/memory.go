@@ -0,0 +1,91 @@
+package store
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// memoryStore — хранилище в памяти для тестов и запуска без файла базы данных
+type memoryStore struct {
+	mu        sync.RWMutex
+	buckets   map[string]map[string][]byte
+	sequences map[string]int64
+}
+
+// NewMemory создает пустое хранилище в памяти
+func NewMemory() Store {
+	return &memoryStore{
+		buckets:   make(map[string]map[string][]byte),
+		sequences: make(map[string]int64),
+	}
+}
+
+func (s *memoryStore) Get(bucket, key string, value interface{}) (bool, error) {
+	s.mu.RLock()
+	data, ok := s.buckets[bucket][key]
+	s.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+func (s *memoryStore) Put(bucket, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.buckets[bucket]
+	if !ok {
+		b = make(map[string][]byte)
+		s.buckets[bucket] = b
+	}
+	b[key] = data
+	return nil
+}
+
+func (s *memoryStore) Delete(bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.buckets[bucket], key)
+	return nil
+}
+
+func (s *memoryStore) ForEach(bucket string, fn func(key string, decode func(interface{}) error) error) error {
+	// Копируем раздел, чтобы fn могла изменять хранилище
+	s.mu.RLock()
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	values := make(map[string][]byte, len(s.buckets[bucket]))
+	for key, data := range s.buckets[bucket] {
+		keys = append(keys, key)
+		values[key] = data
+	}
+	s.mu.RUnlock()
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		data := values[key]
+		err := fn(key, func(value interface{}) error {
+			return json.Unmarshal(data, value)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) NextID(bucket string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sequences[bucket]++
+	return s.sequences[bucket], nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
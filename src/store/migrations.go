@@ -0,0 +1,203 @@
+package store
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"kinozal-bot/logger"
+)
+
+// schemaVersionKey — ключ раздела meta с номером последней примененной миграции
+const schemaVersionKey = "schema_version"
+
+// Файлы, в которых состояние хранилось до появления базы данных
+const (
+	legacyUsersFile         = "config/users.json"
+	legacyCookiesFile       = "kinozal_cookies.json"
+	legacyCallbacksFile     = "config/callbacks.json"
+	legacySubscriptionsFile = "config/subscriptions.json"
+	legacyDownloadsFile     = "config/downloads.json"
+	legacyWatchlistFile     = "config/watchlist.json"
+	legacyRulesFile         = "config/rules.json"
+)
+
+// SessionKinozal — ключ раздела sessions с куками сессии Kinozal
+const SessionKinozal = "kinozal"
+
+// migration — шаг изменения схемы хранилища
+type migration struct {
+	version     int
+	description string
+	apply       func(s Store) error
+}
+
+// migrations применяются по порядку; новые шаги добавляются только в конец
+var migrations = []migration{
+	{1, "import config/users.json", importUsers},
+	{2, "import kinozal_cookies.json", importCookies},
+	{3, "import config/callbacks.json", importCallbacks},
+	{4, "import config/subscriptions.json", importSubscriptions},
+	{5, "import config/downloads.json", importDownloads},
+	{6, "import config/watchlist.json", importWatchlist},
+	{7, "import config/rules.json", importRules},
+}
+
+// Migrate применяет к хранилищу миграции, которые еще не были применены
+func Migrate(s Store) error {
+	var version int
+	if _, err := s.Get(BucketMeta, schemaVersionKey, &version); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= version {
+			continue
+		}
+		if err := m.apply(s); err != nil {
+			logger.Error("Storage migration failed", map[string]interface{}{
+				"version":     m.version,
+				"description": m.description,
+				"error":       err.Error(),
+			})
+			return err
+		}
+		if err := s.Put(BucketMeta, schemaVersionKey, m.version); err != nil {
+			return err
+		}
+		logger.Info("Storage migration applied", map[string]interface{}{
+			"version":     m.version,
+			"description": m.description,
+		})
+	}
+	return nil
+}
+
+// readLegacy читает JSON-файл старого формата. Возвращает false, если файла нет.
+func readLegacy(path string, value interface{}) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(data, value)
+}
+
+// retireLegacy переименовывает импортированный файл, чтобы его не правили по ошибке вместо базы
+func retireLegacy(path string) {
+	if err := os.Rename(path, path+".migrated"); err != nil {
+		logger.Warn("Failed to rename migrated file", map[string]interface{}{
+			"file":  path,
+			"error": err.Error(),
+		})
+	}
+}
+
+// importUsers переносит список разрешенных пользователей
+func importUsers(s Store) error {
+	var ids []int64
+	found, err := readLegacy(legacyUsersFile, &ids)
+	if err != nil || !found {
+		return err
+	}
+	for _, id := range ids {
+		if err := s.Put(BucketUsers, IDKey(id), User{ID: id, Role: RoleUser, AddedAt: time.Now()}); err != nil {
+			return err
+		}
+	}
+	retireLegacy(legacyUsersFile)
+	return nil
+}
+
+// importCookies переносит куки сессии Kinozal
+func importCookies(s Store) error {
+	var cookies json.RawMessage
+	found, err := readLegacy(legacyCookiesFile, &cookies)
+	if err != nil || !found {
+		return err
+	}
+	if err := s.Put(BucketSessions, SessionKinozal, cookies); err != nil {
+		return err
+	}
+	retireLegacy(legacyCookiesFile)
+	return nil
+}
+
+// importCallbacks переносит действия inline-кнопок
+func importCallbacks(s Store) error {
+	var records map[string]json.RawMessage
+	found, err := readLegacy(legacyCallbacksFile, &records)
+	if err != nil || !found {
+		return err
+	}
+	for token, record := range records {
+		if err := s.Put(BucketCallbacks, token, record); err != nil {
+			return err
+		}
+	}
+	retireLegacy(legacyCallbacksFile)
+	return nil
+}
+
+// importSubscriptions переносит подписки на сериалы
+func importSubscriptions(s Store) error {
+	return importByID(s, legacySubscriptionsFile, BucketSubscriptions)
+}
+
+// importWatchlist переносит сохраненные поиски
+func importWatchlist(s Store) error {
+	return importByID(s, legacyWatchlistFile, BucketWatchlist)
+}
+
+// importRules переносит правила автоматической загрузки
+func importRules(s Store) error {
+	return importByID(s, legacyRulesFile, BucketRules)
+}
+
+// importByID переносит массив записей с полем id из файла path в раздел bucket
+func importByID(s Store, path, bucket string) error {
+	var items []json.RawMessage
+	found, err := readLegacy(path, &items)
+	if err != nil || !found {
+		return err
+	}
+	for _, item := range items {
+		var header struct {
+			ID int64 `json:"id"`
+		}
+		if err := json.Unmarshal(item, &header); err != nil {
+			return err
+		}
+		if err := s.Put(bucket, IDKey(header.ID), item); err != nil {
+			return err
+		}
+	}
+	retireLegacy(path)
+	return nil
+}
+
+// importDownloads переносит загрузки, которые отслеживает трекер
+func importDownloads(s Store) error {
+	var items []json.RawMessage
+	found, err := readLegacy(legacyDownloadsFile, &items)
+	if err != nil || !found {
+		return err
+	}
+	for _, item := range items {
+		var header struct {
+			Hash string `json:"hash"`
+		}
+		if err := json.Unmarshal(item, &header); err != nil {
+			return err
+		}
+		if header.Hash == "" {
+			continue
+		}
+		if err := s.Put(BucketDownloads, header.Hash, item); err != nil {
+			return err
+		}
+	}
+	retireLegacy(legacyDownloadsFile)
+	return nil
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultPath — файл базы данных бота
+const DefaultPath = "config/kinozal-bot.db"
+
+// Разделы хранилища
+const (
+	BucketMeta          = "meta"
+	BucketUsers         = "users"
+	BucketHistory       = "history"
+	BucketSessions      = "sessions"
+	BucketCallbacks     = "callbacks"
+	BucketSubscriptions = "subscriptions"
+	BucketDownloads     = "downloads"
+	BucketSelections    = "file_selections"
+	BucketWatchlist     = "watchlist"
+	BucketRules         = "rules"
+)
+
+// Роли пользователей
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Store — хранилище состояния бота. Значения сохраняются в JSON в именованных разделах.
+// Реализации безопасны для использования из нескольких горутин.
+type Store interface {
+	// Get читает значение по ключу в value. Возвращает false, если ключа нет.
+	Get(bucket, key string, value interface{}) (bool, error)
+	// Put сохраняет значение по ключу, заменяя прежнее
+	Put(bucket, key string, value interface{}) error
+	// Delete удаляет ключ; отсутствие ключа не считается ошибкой
+	Delete(bucket, key string) error
+	// ForEach обходит раздел в порядке возрастания ключей. decode читает значение текущего ключа.
+	// fn не должна изменять хранилище.
+	ForEach(bucket string, fn func(key string, decode func(value interface{}) error) error) error
+	// NextID возвращает следующий порядковый номер для раздела
+	NextID(bucket string) (int64, error)
+	// Close закрывает хранилище
+	Close() error
+}
+
+// User — пользователь, которому разрешен доступ к боту
+type User struct {
+	ID      int64     `json:"id"`
+	Role    string    `json:"role"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// IDKey возвращает ключ для числового идентификатора так, чтобы ключи сортировались по возрастанию чисел
+func IDKey(id int64) string {
+	return fmt.Sprintf("%020d", id)
+}
+
+// Open открывает базу данных по пути path и применяет миграции схемы
+func Open(path string) (Store, error) {
+	s, err := openBolt(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := Migrate(s); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Users возвращает всех пользователей из хранилища
+func Users(s Store) ([]User, error) {
+	var users []User
+	err := s.ForEach(BucketUsers, func(key string, decode func(interface{}) error) error {
+		var user User
+		if err := decode(&user); err != nil {
+			return err
+		}
+		users = append(users, user)
+		return nil
+	})
+	return users, err
+}
@@ -0,0 +1,332 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// implementations возвращает конструкторы всех реализаций хранилища
+func implementations() map[string]func(t *testing.T) Store {
+	return map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store {
+			return NewMemory()
+		},
+		"bolt": func(t *testing.T) Store {
+			s, err := openBolt(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { s.Close() })
+			return s
+		},
+	}
+}
+
+// forEachStore запускает тест для каждой реализации хранилища
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	for name, open := range implementations() {
+		t.Run(name, func(t *testing.T) {
+			test(t, open(t))
+		})
+	}
+}
+
+type record struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestGetPutDelete(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		var got record
+		if found, err := s.Get(BucketHistory, "missing", &got); err != nil || found {
+			t.Fatalf("Get of a missing key = %v, %v", found, err)
+		}
+
+		want := record{Name: "Дюна", Count: 2}
+		if err := s.Put(BucketHistory, "a", want); err != nil {
+			t.Fatal(err)
+		}
+		if found, err := s.Get(BucketHistory, "a", &got); err != nil || !found {
+			t.Fatalf("Get = %v, %v", found, err)
+		}
+		if got != want {
+			t.Errorf("Get = %+v, want %+v", got, want)
+		}
+
+		// Одинаковые ключи в разных разделах не пересекаются
+		if found, _ := s.Get(BucketUsers, "a", &got); found {
+			t.Error("key leaked into another bucket")
+		}
+
+		want.Count = 3
+		if err := s.Put(BucketHistory, "a", want); err != nil {
+			t.Fatal(err)
+		}
+		s.Get(BucketHistory, "a", &got)
+		if got.Count != 3 {
+			t.Errorf("Put did not replace the value: %+v", got)
+		}
+
+		if err := s.Delete(BucketHistory, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if found, _ := s.Get(BucketHistory, "a", &got); found {
+			t.Error("key still present after Delete")
+		}
+		if err := s.Delete(BucketHistory, "a"); err != nil {
+			t.Errorf("Delete of a missing key: %v", err)
+		}
+		if err := s.Delete("no-such-bucket", "a"); err != nil {
+			t.Errorf("Delete in a missing bucket: %v", err)
+		}
+	})
+}
+
+func TestForEachOrder(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		if err := s.ForEach("no-such-bucket", func(string, func(interface{}) error) error {
+			t.Error("callback called for a missing bucket")
+			return nil
+		}); err != nil {
+			t.Fatalf("ForEach of a missing bucket: %v", err)
+		}
+
+		for _, id := range []int64{10, 2, 300, 1} {
+			if err := s.Put(BucketUsers, IDKey(id), User{ID: id, Role: RoleUser}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var ids []int64
+		err := s.ForEach(BucketUsers, func(key string, decode func(interface{}) error) error {
+			var user User
+			if err := decode(&user); err != nil {
+				return err
+			}
+			if key != IDKey(user.ID) {
+				t.Errorf("key %q for user %d", key, user.ID)
+			}
+			ids = append(ids, user.ID)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ids, []int64{1, 2, 10, 300}) {
+			t.Errorf("ForEach order = %v, want ascending IDs", ids)
+		}
+
+		users, err := Users(s)
+		if err != nil || len(users) != 4 {
+			t.Errorf("Users = %v, %v", users, err)
+		}
+
+		stop := fmt.Errorf("stop")
+		calls := 0
+		err = s.ForEach(BucketUsers, func(string, func(interface{}) error) error {
+			calls++
+			return stop
+		})
+		if err != stop || calls != 1 {
+			t.Errorf("ForEach did not stop on error: err %v, calls %d", err, calls)
+		}
+	})
+}
+
+func TestNextID(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		for want := int64(1); want <= 3; want++ {
+			id, err := s.NextID(BucketHistory)
+			if err != nil || id != want {
+				t.Fatalf("NextID = %d, %v, want %d", id, err, want)
+			}
+		}
+		if id, _ := s.NextID(BucketSubscriptions); id != 1 {
+			t.Errorf("NextID of another bucket = %d, want 1", id)
+		}
+	})
+}
+
+func TestBoltPersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(BucketSessions, SessionKinozal, []string{"uid=1"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var cookies []string
+	if found, err := s.Get(BucketSessions, SessionKinozal, &cookies); err != nil || !found {
+		t.Fatalf("Get after reopen = %v, %v", found, err)
+	}
+	if !reflect.DeepEqual(cookies, []string{"uid=1"}) {
+		t.Errorf("cookies = %v", cookies)
+	}
+}
+
+// chdir переходит во временную папку, где миграции ищут старые файлы, и возвращается обратно после теста
+func chdir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	previous, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(previous) })
+	if err := os.MkdirAll("config", 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// writeFixture записывает старый файл состояния
+func writeFixture(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateImportsLegacyFiles(t *testing.T) {
+	for name, open := range implementations() {
+		t.Run(name, func(t *testing.T) {
+			chdir(t)
+			writeFixture(t, legacyUsersFile, `[111, 222]`)
+			writeFixture(t, legacyCookiesFile, `[{"Name":"uid","Value":"42","Domain":"kinozal.tv"}]`)
+			writeFixture(t, legacyCallbacksFile, `{"tok1":{"action":{"kind":"noop"}}}`)
+			writeFixture(t, legacySubscriptionsFile, `[{"id":7,"kz_id":"123","title":"Сериал"}]`)
+			writeFixture(t, legacyDownloadsFile, `[{"hash":"abc","name":"Фильм","message_id":5}]`)
+			writeFixture(t, legacyWatchlistFile, `[{"id":3,"query":"Дюна q:2160p","seen":["1"]}]`)
+			writeFixture(t, legacyRulesFile, `[{"id":4,"query":"Дюна","category":"films","fired":["2"]}]`)
+
+			s := open(t)
+			if err := Migrate(s); err != nil {
+				t.Fatalf("Migrate: %v", err)
+			}
+
+			var version int
+			s.Get(BucketMeta, schemaVersionKey, &version)
+			if version != migrations[len(migrations)-1].version {
+				t.Errorf("schema version = %d, want %d", version, migrations[len(migrations)-1].version)
+			}
+
+			users, err := Users(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != 2 || users[0].ID != 111 || users[1].ID != 222 || users[0].Role != RoleUser {
+				t.Errorf("users = %+v", users)
+			}
+
+			var cookies []map[string]interface{}
+			if found, _ := s.Get(BucketSessions, SessionKinozal, &cookies); !found || len(cookies) != 1 || cookies[0]["Value"] != "42" {
+				t.Errorf("cookies = %v", cookies)
+			}
+
+			var callback map[string]interface{}
+			if found, _ := s.Get(BucketCallbacks, "tok1", &callback); !found {
+				t.Error("callback tok1 not imported")
+			}
+
+			var sub map[string]interface{}
+			if found, _ := s.Get(BucketSubscriptions, IDKey(7), &sub); !found || sub["title"] != "Сериал" {
+				t.Errorf("subscription = %v", sub)
+			}
+
+			var download map[string]interface{}
+			if found, _ := s.Get(BucketDownloads, "abc", &download); !found || download["name"] != "Фильм" {
+				t.Errorf("download = %v", download)
+			}
+
+			var search map[string]interface{}
+			if found, _ := s.Get(BucketWatchlist, IDKey(3), &search); !found || search["query"] != "Дюна q:2160p" {
+				t.Errorf("saved search = %v", search)
+			}
+
+			var rule map[string]interface{}
+			if found, _ := s.Get(BucketRules, IDKey(4), &rule); !found || rule["category"] != "films" {
+				t.Errorf("rule = %v", rule)
+			}
+
+			for _, path := range []string{legacyUsersFile, legacyCookiesFile, legacyCallbacksFile, legacySubscriptionsFile, legacyDownloadsFile, legacyWatchlistFile, legacyRulesFile} {
+				if _, err := os.Stat(path); !os.IsNotExist(err) {
+					t.Errorf("%s was not renamed", path)
+				}
+				if _, err := os.Stat(path + ".migrated"); err != nil {
+					t.Errorf("%s.migrated: %v", path, err)
+				}
+			}
+
+			// Повторный запуск ничего не делает, даже если старый файл появился снова
+			writeFixture(t, legacyUsersFile, `[333]`)
+			if err := Migrate(s); err != nil {
+				t.Fatalf("second Migrate: %v", err)
+			}
+			if users, _ := Users(s); len(users) != 2 {
+				t.Errorf("second Migrate imported users again: %+v", users)
+			}
+			if _, err := os.Stat(legacyUsersFile); err != nil {
+				t.Errorf("second Migrate touched %s: %v", legacyUsersFile, err)
+			}
+		})
+	}
+}
+
+func TestMigrateWithoutLegacyFiles(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		chdir(t)
+		if err := Migrate(s); err != nil {
+			t.Fatalf("Migrate: %v", err)
+		}
+
+		var version int
+		s.Get(BucketMeta, schemaVersionKey, &version)
+		if version != migrations[len(migrations)-1].version {
+			t.Errorf("schema version = %d", version)
+		}
+		if users, _ := Users(s); len(users) != 0 {
+			t.Errorf("users = %+v", users)
+		}
+	})
+}
+
+func TestMigrateInvalidLegacyFile(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		chdir(t)
+		writeFixture(t, legacyUsersFile, `not json`)
+
+		if err := Migrate(s); err == nil {
+			t.Fatal("Migrate succeeded with an invalid users file")
+		}
+		var version int
+		if found, _ := s.Get(BucketMeta, schemaVersionKey, &version); found {
+			t.Errorf("schema version recorded after a failed migration: %d", version)
+		}
+		if _, err := os.Stat(legacyUsersFile); err != nil {
+			t.Errorf("invalid file was renamed: %v", err)
+		}
+	})
+}
+
+func TestMigrationVersionsAreSequential(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+1 {
+			t.Errorf("migration #%d has version %d", i+1, m.version)
+		}
+	}
+}
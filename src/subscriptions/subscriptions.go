@@ -0,0 +1,570 @@
+package subscriptions
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"kinozal-bot/callbacks"
+	"kinozal-bot/config"
+	"kinozal-bot/downloader"
+	"kinozal-bot/history"
+	"kinozal-bot/logger"
+	"kinozal-bot/store"
+	"kinozal-bot/torrent"
+	"kinozal-bot/tracker"
+	"kinozal-bot/transmission"
+)
+
+// checkInterval — период проверки обновлений раздач
+const checkInterval = 30 * time.Minute
+
+// releaseIDPattern распознает ID раздачи или ссылку на нее
+var releaseIDPattern = regexp.MustCompile(`^(?:\S*[?&]id=)?(\d+)$`)
+
+// episodesPattern находит диапазон серий в названии раздачи, например "1-6 серии из 10"
+var episodesPattern = regexp.MustCompile(`(?i)\d+(?:\s*-\s*\d+)?\s+сери[ийя](?:\s+из\s+\S+?)?(?:\)|$|\s)`)
+
+// Subscription — подписка пользователя на обновления сериала
+type Subscription struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	ChatID    int64     `json:"chat_id"`
+	KzID      string    `json:"kz_id"`
+	Query     string    `json:"query,omitempty"` // поисковый запрос, если раздача может быть перезалита под другим ID
+	Title     string    `json:"title"`
+	InfoHash  string    `json:"info_hash"`
+	CreatedAt time.Time `json:"created_at"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Manager хранит подписки и периодически проверяет, не обновились ли раздачи
+type Manager struct {
+	bot       transmission.BotInterface
+	cfg       *config.Config
+	client    downloader.DownloadClient
+	session   *torrent.KinozalSession
+	downloads *tracker.Tracker
+	history   *history.History
+	db        store.Store
+
+	mu     sync.Mutex
+	items  []*Subscription
+	nextID int64
+}
+
+// New создает менеджер подписок и загружает сохраненные подписки
+func New(bot transmission.BotInterface, cfg *config.Config, client downloader.DownloadClient, session *torrent.KinozalSession, downloads *tracker.Tracker, hist *history.History, db store.Store) *Manager {
+	m := &Manager{
+		bot:       bot,
+		cfg:       cfg,
+		client:    client,
+		session:   session,
+		downloads: downloads,
+		history:   hist,
+		db:        db,
+		nextID:    1,
+	}
+
+	if err := m.load(); err != nil {
+		logger.Warn("Failed to load subscriptions", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return m
+}
+
+// HandleSubscribe обрабатывает команду /subscribe <ID раздачи, ссылка или поисковый запрос>
+func (m *Manager) HandleSubscribe(chatID, userID int64, args string) {
+	args = strings.TrimSpace(args)
+	if args == "" {
+		m.bot.SendMessage(chatID, "Укажите ID раздачи, ссылку на нее или поисковый запрос. Например: /subscribe 1234567 или /subscribe Шерлок cat:series")
+		return
+	}
+
+	if err := m.session.EnsureLoggedIn(); err != nil {
+		logger.Error("Failed to login to Kinozal for subscription", map[string]interface{}{
+			"error": err.Error(),
+		})
+		m.bot.SendMessage(chatID, "❌ Ошибка при входе на Kinozal. Попробуйте позже.")
+		return
+	}
+
+	sub := &Subscription{
+		UserID:    userID,
+		ChatID:    chatID,
+		CreatedAt: time.Now(),
+	}
+
+	if match := releaseIDPattern.FindStringSubmatch(args); match != nil {
+		sub.KzID = match[1]
+	} else {
+		result, err := m.findRelease(args, "")
+		if err != nil {
+			m.bot.SendMessage(chatID, fmt.Sprintf("❌ %s", err.Error()))
+			return
+		}
+		sub.KzID = result.ID
+		sub.Query = args
+	}
+
+	details, err := torrent.GetDetails(m.session, sub.KzID)
+	if err != nil {
+		logger.Error("Failed to get details for subscription", map[string]interface{}{
+			"torrent_id": sub.KzID,
+			"error":      err.Error(),
+		})
+		m.bot.SendMessage(chatID, "❌ Не удалось получить описание раздачи. Проверьте ID и попробуйте снова.")
+		return
+	}
+	hash, err := torrent.GetInfoHash(m.session, sub.KzID)
+	if err != nil {
+		m.bot.SendMessage(chatID, "❌ Не удалось получить инфо-хеш раздачи. Попробуйте позже.")
+		return
+	}
+	sub.Title = details.Title
+	sub.InfoHash = hash
+	sub.CheckedAt = time.Now()
+
+	m.mu.Lock()
+	for _, existing := range m.items {
+		if existing.UserID == userID && existing.KzID == sub.KzID {
+			m.mu.Unlock()
+			m.bot.SendMessage(chatID, fmt.Sprintf("Вы уже подписаны на «%s».", existing.Title))
+			return
+		}
+	}
+	sub.ID = m.nextID
+	m.nextID++
+	m.items = append(m.items, sub)
+	m.mu.Unlock()
+	m.save()
+
+	logger.Info("Subscription added", map[string]interface{}{
+		"id":         sub.ID,
+		"user_id":    userID,
+		"torrent_id": sub.KzID,
+		"query":      sub.Query,
+	})
+
+	text := fmt.Sprintf("🔔 Подписка оформлена: %s", sub.Title)
+	if episodes := Episodes(sub.Title); episodes != "" {
+		text += fmt.Sprintf("\nСейчас на раздаче: %s", episodes)
+	}
+	text += "\nКогда появятся новые серии, бот заменит торрент в торрент-клиенте и сообщит вам."
+	m.bot.SendMessage(chatID, text)
+}
+
+// HandleList обрабатывает команду /subscriptions: показывает подписки пользователя с кнопками отписки
+func (m *Manager) HandleList(chatID, userID int64, store *callbacks.Store) {
+	m.mu.Lock()
+	var own []Subscription
+	for _, sub := range m.items {
+		if sub.UserID == userID {
+			own = append(own, *sub)
+		}
+	}
+	m.mu.Unlock()
+
+	if len(own) == 0 {
+		m.bot.SendMessage(chatID, "У вас нет подписок. Подпишитесь на сериал: /subscribe <ID раздачи или запрос>")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("🔔 Ваши подписки:\n\n")
+	var keyboardRows [][]tgbotapi.InlineKeyboardButton
+	for i, sub := range own {
+		b.WriteString(fmt.Sprintf("%d. %s\n", i+1, sub.Title))
+		if sub.Query != "" {
+			b.WriteString(fmt.Sprintf("   запрос: %s\n", sub.Query))
+		}
+		button := tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("❌ Отписаться от %d", i+1), store.Put(callbacks.Action{
+			Kind:   callbacks.KindUnsubscribe,
+			ItemID: sub.ID,
+		}))
+		keyboardRows = append(keyboardRows, tgbotapi.NewInlineKeyboardRow(button))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, b.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboardRows...)
+	if _, err := m.bot.Send(msg); err != nil {
+		logger.Error("Failed to send subscriptions list", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// HandleCallback обрабатывает кнопку отписки
+func (m *Manager) HandleCallback(callback *tgbotapi.CallbackQuery, action callbacks.Action) {
+	answer := func(text string) {
+		if _, err := m.bot.AnswerCallbackQuery(tgbotapi.NewCallback(callback.ID, text)); err != nil {
+			logger.Warn("Failed to answer callback query", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	m.mu.Lock()
+	var removed *Subscription
+	for i, sub := range m.items {
+		if sub.ID != action.ItemID {
+			continue
+		}
+		if sub.UserID != callback.From.ID && callback.From.ID != int64(m.cfg.Bot.AdminID) {
+			m.mu.Unlock()
+			answer("Это не ваша подписка")
+			return
+		}
+		removed = sub
+		m.items = append(m.items[:i], m.items[i+1:]...)
+		break
+	}
+	m.mu.Unlock()
+
+	if removed == nil {
+		answer("Подписка уже удалена")
+		return
+	}
+	m.save()
+
+	logger.Info("Subscription removed", map[string]interface{}{
+		"id":      removed.ID,
+		"user_id": callback.From.ID,
+	})
+	m.bot.SendMessage(callback.Message.Chat.ID, fmt.Sprintf("🔕 Подписка на «%s» отменена.", removed.Title))
+	answer("Отписано")
+}
+
+// Run периодически проверяет подписки до закрытия канала stop
+func (m *Manager) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.checkAll(stop)
+		}
+	}
+}
+
+// checkAll проверяет все подписки по очереди
+func (m *Manager) checkAll(stop <-chan struct{}) {
+	m.mu.Lock()
+	items := make([]*Subscription, len(m.items))
+	copy(items, m.items)
+	m.mu.Unlock()
+
+	if len(items) == 0 {
+		return
+	}
+
+	if err := m.session.EnsureLoggedIn(); err != nil {
+		logger.Warn("Skipping subscription check: Kinozal login failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Частоту запросов к Kinozal ограничивает сессия
+	for _, sub := range items {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		m.check(sub)
+	}
+}
+
+// check проверяет, изменилась ли раздача подписки, и при необходимости заменяет торрент.
+// Поля подписки читаются из копии, снятой под блокировкой: их может менять HandleCallback.
+func (m *Manager) check(sub *Subscription) {
+	m.mu.Lock()
+	current := *sub
+	m.mu.Unlock()
+	kzID := current.KzID
+
+	// Раздачу, найденную по запросу, могут перезалить под новым ID
+	if current.Query != "" {
+		result, err := m.findRelease(current.Query, current.KzID)
+		if err != nil {
+			logger.Warn("Subscription search failed", map[string]interface{}{
+				"id":    current.ID,
+				"query": current.Query,
+				"error": err.Error(),
+			})
+		} else {
+			kzID = result.ID
+		}
+	}
+
+	hash, err := torrent.GetInfoHash(m.session, kzID)
+	if err != nil {
+		logger.Warn("Failed to check subscription", map[string]interface{}{
+			"id":         current.ID,
+			"torrent_id": kzID,
+			"error":      err.Error(),
+		})
+		return
+	}
+	details, err := torrent.GetDetails(m.session, kzID)
+	if err != nil {
+		logger.Warn("Failed to get details for subscription", map[string]interface{}{
+			"id":         current.ID,
+			"torrent_id": kzID,
+			"error":      err.Error(),
+		})
+		return
+	}
+
+	m.mu.Lock()
+	sub.CheckedAt = time.Now()
+	m.mu.Unlock()
+	changed := kzID != current.KzID || !strings.EqualFold(hash, current.InfoHash) || Episodes(details.Title) != Episodes(current.Title)
+
+	if !changed {
+		m.save()
+		return
+	}
+
+	// Пока шла проверка, пользователь мог отписаться
+	if !m.active(current.ID) {
+		return
+	}
+
+	logger.Info("Subscribed release updated", map[string]interface{}{
+		"id":         current.ID,
+		"torrent_id": kzID,
+		"old_title":  current.Title,
+		"new_title":  details.Title,
+	})
+
+	if err := m.replace(current, kzID, details.Title, hash); err != nil {
+		logger.Error("Failed to replace updated torrent", map[string]interface{}{
+			"id":         current.ID,
+			"torrent_id": kzID,
+			"error":      err.Error(),
+		})
+		// Состояние подписки не меняем, чтобы повторить попытку при следующей проверке
+		m.save()
+		return
+	}
+
+	m.mu.Lock()
+	sub.KzID = kzID
+	sub.Title = details.Title
+	sub.InfoHash = hash
+	m.mu.Unlock()
+	m.save()
+
+	text := fmt.Sprintf("🆕 Вышло обновление: %s", details.Title)
+	if episodes := Episodes(details.Title); episodes != "" {
+		text += fmt.Sprintf("\nТеперь на раздаче: %s", episodes)
+	}
+	m.bot.SendMessage(current.ChatID, text)
+}
+
+// active сообщает, есть ли еще подписка id
+func (m *Manager) active(id int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sub := range m.items {
+		if sub.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// replace добавляет новую версию раздачи в папку старой, чтобы клиент проверил уже загруженные серии
+// и докачал только новые, и затем удаляет из торрент-клиента старую версию, сохраняя данные.
+// Старая версия удаляется только после успешного добавления новой, поэтому при ошибке раздача
+// продолжает раздаваться, а замена повторяется при следующей проверке.
+func (m *Manager) replace(sub Subscription, kzID, title, hash string) error {
+	category, ok := m.cfg.CategoryForKind(torrent.KindSeries)
+	if !ok {
+		category = config.Category{ID: torrent.KindSeries, Label: "Сериалы", Path: m.cfg.Folders.Series}
+	}
+
+	torrentPath, downloadErr := torrent.DownloadTorrent(m.session, kzID)
+	if downloadErr != nil && downloadErr != torrent.ErrDownloadLimit {
+		return downloadErr
+	}
+
+	var old []downloader.TorrentInfo
+	if sub.InfoHash != "" {
+		var err error
+		old, err = m.client.List([]string{strings.ToLower(sub.InfoHash)})
+		if err != nil && err != downloader.ErrUnsupported {
+			return err
+		}
+		for _, info := range old {
+			if info.DownloadDir != "" {
+				category.Path = info.DownloadDir
+			}
+		}
+	}
+
+	var newHash string
+	var err error
+	client := downloader.ForUser(m.client, sub.UserID)
+	if downloadErr == torrent.ErrDownloadLimit {
+		// Лимит скачиваний исчерпан — добавляем по magnet-ссылке
+		newHash, err = downloader.AddMagnet(client, torrent.MagnetLink(hash, title), category, title, sub.ChatID, m.bot)
+	} else {
+		newHash, err = downloader.AddTorrentFile(client, m.cfg, torrentPath, category, downloader.AddOptions{
+			// Обновленная раздача в основном состоит из уже загруженных файлов старой версии,
+			// поэтому проверка места по полному размеру раздачи отказала бы зря
+			IgnoreFreeSpace: true,
+		}, title, sub.ChatID, m.bot)
+	}
+	duplicate := false
+	if existing, ok := downloader.IsDuplicate(err); ok {
+		// Новую версию уже добавили в клиент вручную — остается убрать старую
+		duplicate = true
+		newHash = existing.Torrent.Hash
+	} else if err != nil {
+		return err
+	}
+
+	for _, info := range old {
+		if strings.EqualFold(info.Hash, newHash) {
+			continue
+		}
+		if err := m.client.Remove(info.Hash, false); err != nil {
+			// Новая версия уже добавлена; старую пользователь может удалить через /status
+			logger.Warn("Failed to remove previous version of subscribed release", map[string]interface{}{
+				"id":    sub.ID,
+				"hash":  info.Hash,
+				"error": err.Error(),
+			})
+			continue
+		}
+		m.downloads.Untrack(info.Hash)
+	}
+	if duplicate {
+		return nil
+	}
+
+	m.downloads.Track(tracker.Download{
+		Hash:   newHash,
+		Name:   title,
+		KzID:   kzID,
+		Folder: category.Path,
+		ChatID: sub.ChatID,
+		UserID: sub.UserID,
+	})
+	m.history.Record(history.Entry{
+		UserID:   sub.UserID,
+		ChatID:   sub.ChatID,
+		KzID:     kzID,
+		Title:    title,
+		Category: category.ID,
+		Folder:   category.Path,
+		Hash:     newHash,
+		Source:   history.SourceSubscription,
+	})
+	return nil
+}
+
+// findRelease ищет раздачу по запросу. Если среди результатов есть раздача currentID, возвращается она,
+// иначе — первый найденный сериал или просто первый результат.
+func (m *Manager) findRelease(input, currentID string) (*torrent.SearchResult, error) {
+	query, filters, err := torrent.ParseSearchQuery(input)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка в фильтрах: %s", err.Error())
+	}
+
+	results, err := torrent.SearchTorrents(m.session, query, filters)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка поиска на Kinozal")
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("ничего не найдено по запросу «%s»", input)
+	}
+
+	for i := range results {
+		if results[i].ID == currentID {
+			return &results[i], nil
+		}
+	}
+	for i := range results {
+		if torrent.Classify(results[i]) == torrent.KindSeries {
+			return &results[i], nil
+		}
+	}
+	return &results[0], nil
+}
+
+// Episodes возвращает диапазон серий из названия раздачи, например "1-6 серии из 10"
+func Episodes(title string) string {
+	match := episodesPattern.FindString(title)
+	return strings.TrimRight(strings.TrimSpace(match), ")")
+}
+
+// load читает подписки из базы данных
+func (m *Manager) load() error {
+	var items []*Subscription
+	err := m.db.ForEach(store.BucketSubscriptions, func(key string, decode func(interface{}) error) error {
+		sub := &Subscription{}
+		if err := decode(sub); err != nil {
+			return err
+		}
+		items = append(items, sub)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items = items
+	for _, sub := range items {
+		if sub.ID >= m.nextID {
+			m.nextID = sub.ID + 1
+		}
+	}
+	return nil
+}
+
+// save сохраняет подписки в базу данных и удаляет из нее отмененные
+func (m *Manager) save() {
+	m.mu.Lock()
+	items := make(map[string]Subscription, len(m.items))
+	for _, sub := range m.items {
+		items[store.IDKey(sub.ID)] = *sub
+	}
+	m.mu.Unlock()
+
+	var stale []string
+	err := m.db.ForEach(store.BucketSubscriptions, func(key string, decode func(interface{}) error) error {
+		if _, ok := items[key]; !ok {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+	for _, key := range stale {
+		if err == nil {
+			err = m.db.Delete(store.BucketSubscriptions, key)
+		}
+	}
+	for key, sub := range items {
+		if err == nil {
+			err = m.db.Put(store.BucketSubscriptions, key, sub)
+		}
+	}
+	if err != nil {
+		logger.Error("Failed to save subscriptions", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package torrent
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Типы раздач, определяемые классификатором. Совпадают с ID категорий загрузок по умолчанию.
+const (
+	KindFilms         = "films"
+	KindSeries        = "series"
+	KindCartoons      = "cartoons"
+	KindAudiobooks    = "audiobooks"
+	KindDocumentaries = "documentaries"
+	KindMusic         = "music"
+)
+
+// sectionKinds сопоставляет ID раздела Kinozal (значок в строке результатов) с типом раздачи
+var sectionKinds = map[string]string{
+	"45": KindSeries,        // Сериал - Русский
+	"46": KindSeries,        // Сериал - Буржуйский
+	"20": KindCartoons,      // Аниме
+	"21": KindCartoons,      // Мультфильм - Буржуйский
+	"22": KindCartoons,      // Мультфильм - Русский
+	"2":  KindAudiobooks,    // Аудиокниги
+	"48": KindDocumentaries, // Документальный
+	"3":  KindMusic,         // Музыка - Буржуйская
+	"4":  KindMusic,         // Музыка - Русская
+	"5":  KindMusic,         // Музыка - Мультимедиа
+	"42": KindMusic,         // Музыка - Lossless
+}
+
+// filmSections — разделы Kinozal с художественными фильмами
+var filmSections = map[string]bool{
+	"6": true, "7": true, "8": true, "9": true, "10": true, "11": true, "12": true,
+	"13": true, "14": true, "15": true, "16": true, "17": true, "18": true, "24": true,
+	"35": true, "37": true, "39": true, "47": true, "49": true, "50": true,
+}
+
+// sectionPattern извлекает ID раздела из onclick="cat(45);" или src="/pic/cat/45.gif"
+var sectionPattern = regexp.MustCompile(`cat(?:\(|/)(\d+)`)
+
+// Маркеры в названии раздачи
+var (
+	seriesTitlePattern    = regexp.MustCompile(`(?i)\(\s*\d+(\s*-\s*\d+)?\s+сери[ийя]|\d+\s+сезон|сезон\s*:?\s*\d+|серии\s+из\s+\d+`)
+	audiobookTitlePattern = regexp.MustCompile(`(?i)аудиокниг|читает\s`)
+	cartoonTitlePattern   = regexp.MustCompile(`(?i)мультфильм|мультсериал|аниме`)
+)
+
+// ParseSection извлекает ID раздела Kinozal из атрибутов значка раздела
+func ParseSection(attr string) string {
+	match := sectionPattern.FindStringSubmatch(attr)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+// Classify определяет тип раздачи по разделу Kinozal и маркерам в названии.
+// Возвращает пустую строку, если тип определить не удалось.
+func Classify(result SearchResult) string {
+	title := strings.ToLower(result.Title)
+
+	// Маркеры в названии точнее раздела: сериалы и аудиокниги встречаются в разных разделах
+	switch {
+	case audiobookTitlePattern.MatchString(title):
+		return KindAudiobooks
+	case seriesTitlePattern.MatchString(title):
+		if kind := sectionKinds[result.Section]; kind == KindCartoons || kind == KindDocumentaries {
+			return kind
+		}
+		return KindSeries
+	}
+
+	if kind, ok := sectionKinds[result.Section]; ok {
+		return kind
+	}
+	if cartoonTitlePattern.MatchString(title) {
+		return KindCartoons
+	}
+	if filmSections[result.Section] {
+		return KindFilms
+	}
+	return ""
+}
@@ -0,0 +1,288 @@
+package torrent
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"kinozal-bot/config"
+	"kinozal-bot/errors"
+	"kinozal-bot/logger"
+)
+
+// Details содержит информацию со страницы раздачи details.php
+type Details struct {
+	ID          string
+	Title       string
+	PosterURL   string
+	Year        string
+	Genre       string
+	Description string
+	Quality     string
+	Video       string
+	Audio       string
+	Translation string
+	Size        string
+	Files       []FileEntry
+}
+
+// FileEntry описывает файл из списка файлов раздачи
+type FileEntry struct {
+	Name string
+	Size string
+}
+
+// descriptionLabels — подписи, после которых на странице раздачи идет описание,
+// в порядке приоритета: если на странице их несколько, описанием считается первая найденная
+var descriptionLabels = []string{
+	"О фильме",
+	"О сериале",
+	"О мультфильме",
+	"Описание",
+	"О книге",
+	"Об альбоме",
+	"Об игре",
+}
+
+// isDescriptionLabel сообщает, начинает ли подпись label описание раздачи
+func isDescriptionLabel(label string) bool {
+	for _, l := range descriptionLabels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDetails загружает и разбирает страницу раздачи вместе со списком файлов
+func GetDetails(session *KinozalSession, torrentID string) (*Details, error) {
+	cfg := session.Config()
+	detailsURL := fmt.Sprintf("https://%s%s?id=%s", cfg.Kinozal.Address, cfg.Kinozal.Endpoints.Details, url.QueryEscape(torrentID))
+	page, err := fetchPage(session, detailsURL)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := ParseDetails(cfg, page)
+	if err != nil {
+		return nil, err
+	}
+	details.ID = torrentID
+
+	// Список файлов отдается отдельным запросом, его отсутствие не критично
+	srvDetails, err := fetchSrvDetails(session, torrentID)
+	if err != nil {
+		logger.Warn("Failed to fetch torrent file list", map[string]interface{}{
+			"torrent_id": torrentID,
+			"error":      err.Error(),
+		})
+	} else {
+		details.Files = ParseFileList(srvDetails)
+	}
+
+	logger.Debug("Parsed torrent details", map[string]interface{}{
+		"torrent_id": torrentID,
+		"title":      details.Title,
+		"files":      len(details.Files),
+	})
+
+	return details, nil
+}
+
+// ParseDetails разбирает HTML страницы раздачи
+func ParseDetails(cfg *config.Config, html string) (*Details, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil, errors.NewKinozalError("Failed to parse details page", map[string]interface{}{"error": err.Error()})
+	}
+
+	details := &Details{}
+
+	details.Title = strings.TrimSpace(doc.Find("h1 a").First().Text())
+	if details.Title == "" {
+		details.Title = strings.TrimSpace(doc.Find("h1").First().Text())
+	}
+	if details.Title == "" {
+		return nil, errors.NewKinozalError("Details page has no title", nil)
+	}
+
+	// Постер: основной вариант — картинка с классом p200 в левой колонке
+	poster, exists := doc.Find("img.p200").First().Attr("src")
+	if !exists {
+		poster, exists = doc.Find("ul.men img").First().Attr("src")
+	}
+	if exists {
+		details.PosterURL = absoluteURL(cfg, poster)
+	}
+
+	fields := parseLabeledFields(doc)
+	details.Year = fields["Год выпуска"]
+	details.Genre = fields["Жанр"]
+	details.Quality = fields["Качество"]
+	details.Video = fields["Видео"]
+	details.Audio = fields["Аудио"]
+	details.Translation = fields["Перевод"]
+	details.Size = fields["Размер"]
+
+	for _, label := range descriptionLabels {
+		if value, ok := fields[label]; ok {
+			details.Description = value
+			break
+		}
+	}
+
+	// Вес раздачи в левой колонке точнее, чем поле "Размер" в описании
+	doc.Find("ul.men li").Each(func(_ int, li *goquery.Selection) {
+		if strings.HasPrefix(strings.TrimSpace(li.Text()), "Вес") {
+			if size := strings.TrimSpace(li.Find("span").First().Text()); size != "" {
+				details.Size = size
+			}
+		}
+	})
+
+	return details, nil
+}
+
+// ParseFileList разбирает список файлов из ответа get_srv_details.php
+func ParseFileList(html string) []FileEntry {
+	var files []FileEntry
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		logger.Error("Failed to parse file list", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return files
+	}
+
+	items := doc.Find(".treeview li")
+	if items.Length() == 0 {
+		items = doc.Find("li")
+	}
+
+	items.Each(func(_ int, li *goquery.Selection) {
+		// Пропускаем папки — у них есть вложенный список
+		if li.Find("ul").Length() > 0 {
+			return
+		}
+
+		text := strings.TrimSpace(li.Text())
+		if text == "" || strings.Contains(text, "хеш") {
+			return
+		}
+
+		size := strings.TrimSpace(li.Find("i, span.floatright").Last().Text())
+		name := text
+		if size != "" {
+			name = strings.TrimSpace(strings.Replace(text, size, "", 1))
+		}
+		size = strings.Trim(size, "() ")
+
+		files = append(files, FileEntry{Name: name, Size: size})
+	})
+
+	return files
+}
+
+// parseLabeledFields собирает пары "<b>Подпись:</b> значение<br>" со страницы раздачи.
+// Описание может занимать несколько строк, поэтому для него перевод строки не завершает значение.
+func parseLabeledFields(doc *goquery.Document) map[string]string {
+	fields := make(map[string]string)
+
+	doc.Find("b").Parent().Each(func(_ int, parent *goquery.Selection) {
+		label := ""
+		var value strings.Builder
+
+		flush := func() {
+			if label != "" {
+				if _, exists := fields[label]; !exists {
+					fields[label] = strings.TrimSpace(value.String())
+				}
+			}
+			label = ""
+			value.Reset()
+		}
+
+		parent.Contents().Each(func(_ int, node *goquery.Selection) {
+			switch goquery.NodeName(node) {
+			case "b":
+				text := strings.TrimSpace(node.Text())
+				if strings.HasSuffix(text, ":") {
+					flush()
+					label = strings.TrimSpace(strings.TrimSuffix(text, ":"))
+					return
+				}
+				value.WriteString(node.Text())
+			case "br":
+				if isDescriptionLabel(label) {
+					value.WriteString("\n")
+					return
+				}
+				flush()
+			default:
+				if label != "" {
+					value.WriteString(node.Text())
+				}
+			}
+		})
+		flush()
+	})
+
+	return fields
+}
+
+// fetchSrvDetails загружает дополнительные сведения о раздаче (список файлов, инфо-хеш)
+func fetchSrvDetails(session *KinozalSession, torrentID string) (string, error) {
+	cfg := session.Config()
+	srvURL := fmt.Sprintf("https://%s%s?id=%s&action=2", cfg.Kinozal.Address, cfg.Kinozal.Endpoints.Hash, url.QueryEscape(torrentID))
+	return fetchPage(session, srvURL)
+}
+
+// fetchPage выполняет GET-запрос к Kinozal и возвращает тело ответа в UTF-8
+func fetchPage(session *KinozalSession, pageURL string) (string, error) {
+	cfg := session.Config()
+
+	logger.Debug("Fetching Kinozal page", map[string]interface{}{
+		"url": pageURL,
+	})
+
+	req, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return "", errors.NewKinozalError("Failed to create request", map[string]interface{}{"error": err.Error(), "url": pageURL})
+	}
+
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
+	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7")
+	req.Header.Set("Referer", fmt.Sprintf("https://%s/", cfg.Kinozal.Address))
+
+	resp, body, err := session.do(req)
+	if err != nil {
+		return "", errors.NewKinozalError("Failed to execute request", map[string]interface{}{"error": err.Error(), "url": pageURL})
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.NewKinozalError("Unexpected response status", map[string]interface{}{"status": resp.Status, "url": pageURL})
+	}
+
+	decodedBody, err := decodeWindows1251(string(body))
+	if err != nil {
+		return "", errors.NewKinozalError("Failed to decode response from Windows-1251 to UTF-8", map[string]interface{}{"error": err.Error()})
+	}
+
+	return decodedBody, nil
+}
+
+// absoluteURL дополняет относительную ссылку адресом Kinozal
+func absoluteURL(cfg *config.Config, link string) string {
+	if strings.HasPrefix(link, "//") {
+		return "https:" + link
+	}
+	if strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://") {
+		return link
+	}
+	return fmt.Sprintf("https://%s/%s", cfg.Kinozal.Address, strings.TrimPrefix(link, "/"))
+}
@@ -0,0 +1,77 @@
+package torrent
+
+import (
+	"testing"
+
+	"kinozal-bot/config"
+)
+
+// detailsPage возвращает страницу раздачи с блоками описания descriptions в заданном порядке
+func detailsPage(descriptions ...string) string {
+	page := `<html><body>
+<h1><a href="/details.php?id=1">Дюна / Dune / 2021 / WEB-DL (1080p)</a></h1>
+<ul class="men"><li>Вес<span>20.5 ГБ</span></li></ul>
+<div class="bx1">
+<b>Год выпуска:</b> 2021<br>
+<b>Жанр:</b> фантастика<br>
+<b>Качество:</b> WEB-DL (1080p)<br>
+</div>
+`
+	for _, description := range descriptions {
+		page += `<div class="bx1">` + description + "</div>\n"
+	}
+	return page + "</body></html>"
+}
+
+const (
+	generalDescription = `<b>Описание:</b> Общее описание раздачи<br>`
+	filmDescription    = `<b>О фильме:</b> Наследник знаменитого дома<br>отправляется на Арракис<br>`
+	filmText           = "Наследник знаменитого дома\nотправляется на Арракис"
+)
+
+func TestParseDetails(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Kinozal.Address = "kinozal.tv"
+
+	details, err := ParseDetails(cfg, detailsPage(generalDescription, filmDescription))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if details.Title != "Дюна / Dune / 2021 / WEB-DL (1080p)" || details.Year != "2021" || details.Genre != "фантастика" {
+		t.Errorf("unexpected details %+v", details)
+	}
+	if details.Size != "20.5 ГБ" {
+		t.Errorf("Size = %q", details.Size)
+	}
+}
+
+func TestParseDetailsDescriptionPriority(t *testing.T) {
+	tests := []struct {
+		name         string
+		descriptions []string
+		want         string
+	}{
+		{"general first", []string{generalDescription, filmDescription}, filmText},
+		{"film first", []string{filmDescription, generalDescription}, filmText},
+		{"general only", []string{generalDescription}, "Общее описание раздачи"},
+		{"no description", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details, err := ParseDetails(&config.Config{}, detailsPage(tt.descriptions...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if details.Description != tt.want {
+				t.Errorf("Description = %q, want %q", details.Description, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDetailsWithoutTitle(t *testing.T) {
+	if _, err := ParseDetails(&config.Config{}, "<html><body></body></html>"); err == nil {
+		t.Error("ParseDetails returned no error for a page without title")
+	}
+}
@@ -0,0 +1,193 @@
+package torrent
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SearchFilters описывает дополнительные параметры поиска на Kinozal.
+// Пустые поля означают отсутствие фильтра.
+type SearchFilters struct {
+	Category   string // параметр c= (раздел)
+	Quality    string // параметр v= (формат/качество)
+	Year       string // параметр d= (год выпуска)
+	Period     string // параметр w= (время добавления)
+	Resolution string // уточнение по разрешению в названии раздачи (например, 1080p)
+}
+
+// categoryValues сопоставляет название раздела со значением параметра c= в browse.php
+var categoryValues = map[string]string{
+	"films":       "1002",
+	"фильмы":      "1002",
+	"series":      "1001",
+	"сериалы":     "1001",
+	"cartoons":    "1003",
+	"мультфильмы": "1003",
+	"music":       "1004",
+	"музыка":      "1004",
+	"tv":          "1006",
+	"тв":          "1006",
+	"audiobooks":  "2",
+	"аудиокниги":  "2",
+	"games":       "23",
+	"игры":        "23",
+}
+
+// qualityValues сопоставляет качество со значением параметра v= в browse.php
+var qualityValues = map[string]string{
+	"sd":     "1",
+	"dvd":    "2",
+	"hd":     "3",
+	"720p":   "3",
+	"1080p":  "3",
+	"bluray": "4",
+	"remux":  "4",
+	"4k":     "7",
+	"uhd":    "7",
+	"2160p":  "7",
+}
+
+// periodValues сопоставляет период добавления со значением параметра w= в browse.php
+var periodValues = map[string]string{
+	"today":     "1",
+	"сегодня":   "1",
+	"yesterday": "2",
+	"вчера":     "2",
+	"3days":     "3",
+	"week":      "4",
+	"неделя":    "4",
+	"month":     "5",
+	"месяц":     "5",
+}
+
+// resolutionMarkers — значения качества, которые дополнительно проверяются по названию раздачи
+var resolutionMarkers = map[string]bool{
+	"720p":  true,
+	"1080p": true,
+	"2160p": true,
+}
+
+// filterKeys сопоставляет ключи фильтров (включая русские синонимы) с их каноническим именем
+var filterKeys = map[string]string{
+	"cat":      "cat",
+	"category": "cat",
+	"кат":      "cat",
+	"q":        "q",
+	"quality":  "q",
+	"format":   "q",
+	"fmt":      "q",
+	"качество": "q",
+	"year":     "year",
+	"y":        "year",
+	"год":      "year",
+	"period":   "period",
+	"added":    "period",
+	"период":   "period",
+}
+
+// ParseSearchQuery разбирает строку поиска вида "Дюна cat:films year:2021 q:2160p"
+// на текст запроса и фильтры. Слова с неизвестным ключом остаются частью запроса.
+func ParseSearchQuery(input string) (string, SearchFilters, error) {
+	var filters SearchFilters
+	var words []string
+
+	for _, token := range strings.Fields(input) {
+		key, value, found := strings.Cut(token, ":")
+		canonical, known := filterKeys[strings.ToLower(key)]
+		if !found || !known || value == "" {
+			words = append(words, token)
+			continue
+		}
+
+		value = strings.ToLower(value)
+		switch canonical {
+		case "cat":
+			if _, ok := categoryValues[value]; !ok {
+				return "", filters, fmt.Errorf("неизвестный раздел %q, доступны: %s", value, availableKeys(categoryValues))
+			}
+			filters.Category = value
+		case "q":
+			if _, ok := qualityValues[value]; !ok {
+				return "", filters, fmt.Errorf("неизвестное качество %q, доступны: %s", value, availableKeys(qualityValues))
+			}
+			filters.Quality = value
+			if resolutionMarkers[value] {
+				filters.Resolution = value
+			}
+		case "year":
+			year, err := strconv.Atoi(value)
+			if err != nil || year < 1900 || year > 2100 {
+				return "", filters, fmt.Errorf("некорректный год %q", value)
+			}
+			filters.Year = value
+		case "period":
+			if _, ok := periodValues[value]; !ok {
+				return "", filters, fmt.Errorf("неизвестный период %q, доступны: %s", value, availableKeys(periodValues))
+			}
+			filters.Period = value
+		}
+	}
+
+	return strings.Join(words, " "), filters, nil
+}
+
+// IsEmpty сообщает, заданы ли какие-либо фильтры
+func (f SearchFilters) IsEmpty() bool {
+	return f.Category == "" && f.Quality == "" && f.Year == "" && f.Period == ""
+}
+
+// String возвращает фильтры в том же синтаксисе, в котором они вводятся
+func (f SearchFilters) String() string {
+	var parts []string
+	if f.Category != "" {
+		parts = append(parts, "cat:"+f.Category)
+	}
+	if f.Quality != "" {
+		parts = append(parts, "q:"+f.Quality)
+	}
+	if f.Year != "" {
+		parts = append(parts, "year:"+f.Year)
+	}
+	if f.Period != "" {
+		parts = append(parts, "period:"+f.Period)
+	}
+	return strings.Join(parts, " ")
+}
+
+// apply добавляет параметры фильтров к параметрам запроса browse.php
+func (f SearchFilters) apply(params url.Values) {
+	if v, ok := categoryValues[f.Category]; ok {
+		params.Set("c", v)
+	}
+	if v, ok := qualityValues[f.Quality]; ok {
+		params.Set("v", v)
+	}
+	if f.Year != "" {
+		params.Set("d", f.Year)
+	}
+	if v, ok := periodValues[f.Period]; ok {
+		params.Set("w", v)
+	}
+}
+
+// Match проверяет результат поиска на соответствие фильтрам,
+// которые Kinozal не умеет применять на своей стороне
+func (f SearchFilters) Match(result SearchResult) bool {
+	if f.Resolution != "" && !strings.Contains(strings.ToLower(result.Title), f.Resolution) {
+		return false
+	}
+	return true
+}
+
+// availableKeys возвращает отсортированный список допустимых значений фильтра
+func availableKeys(values map[string]string) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
@@ -0,0 +1,230 @@
+package torrent
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		query   string
+		filters SearchFilters
+	}{
+		{
+			name:  "plain query",
+			input: "Матрица",
+			query: "Матрица",
+		},
+		{
+			name:    "all filters",
+			input:   "Дюна cat:films year:2021 q:2160p period:week",
+			query:   "Дюна",
+			filters: SearchFilters{Category: "films", Quality: "2160p", Year: "2021", Period: "week", Resolution: "2160p"},
+		},
+		{
+			name:    "english aliases",
+			input:   "Дюна category:series quality:hd y:2020 added:today",
+			query:   "Дюна",
+			filters: SearchFilters{Category: "series", Quality: "hd", Year: "2020", Period: "today"},
+		},
+		{
+			name:    "format aliases",
+			input:   "Дюна format:bluray",
+			query:   "Дюна",
+			filters: SearchFilters{Quality: "bluray"},
+		},
+		{
+			name:    "fmt alias",
+			input:   "Дюна fmt:4k",
+			query:   "Дюна",
+			filters: SearchFilters{Quality: "4k"},
+		},
+		{
+			name:    "russian aliases and values",
+			input:   "Дюна кат:фильмы качество:1080p год:2021 период:месяц",
+			query:   "Дюна",
+			filters: SearchFilters{Category: "фильмы", Quality: "1080p", Year: "2021", Period: "месяц", Resolution: "1080p"},
+		},
+		{
+			name:    "keys and values are case-insensitive",
+			input:   "Дюна CAT:Films Q:720P",
+			query:   "Дюна",
+			filters: SearchFilters{Category: "films", Quality: "720p", Resolution: "720p"},
+		},
+		{
+			name:    "filters between words",
+			input:   "Звездные cat:films войны",
+			query:   "Звездные войны",
+			filters: SearchFilters{Category: "films"},
+		},
+		{
+			name:  "unknown key stays in query",
+			input: "Миссия невыполнима: Последствия",
+			query: "Миссия невыполнима: Последствия",
+		},
+		{
+			name:    "unknown key:value token stays in query",
+			input:   "Star Trek:Discovery cat:series",
+			query:   "Star Trek:Discovery",
+			filters: SearchFilters{Category: "series"},
+		},
+		{
+			name:  "known key without value stays in query",
+			input: "Дюна year:",
+			query: "Дюна year:",
+		},
+		{
+			name:    "quality without resolution marker",
+			input:   "Дюна q:remux",
+			query:   "Дюна",
+			filters: SearchFilters{Quality: "remux"},
+		},
+		{
+			name:    "filters only",
+			input:   "cat:audiobooks",
+			query:   "",
+			filters: SearchFilters{Category: "audiobooks"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, filters, err := ParseSearchQuery(tt.input)
+			if err != nil {
+				t.Fatalf("ParseSearchQuery(%q): %v", tt.input, err)
+			}
+			if query != tt.query {
+				t.Errorf("query = %q, want %q", query, tt.query)
+			}
+			if filters != tt.filters {
+				t.Errorf("filters = %+v, want %+v", filters, tt.filters)
+			}
+		})
+	}
+}
+
+func TestParseSearchQueryInvalidValues(t *testing.T) {
+	tests := []string{
+		"Дюна cat:anime",
+		"Дюна кат:фильм",
+		"Дюна q:8k",
+		"Дюна quality:hdr",
+		"Дюна year:21",
+		"Дюна year:1899",
+		"Дюна year:2101",
+		"Дюна year:two",
+		"Дюна period:decade",
+		"Дюна added:завтра",
+	}
+
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			if _, _, err := ParseSearchQuery(input); err == nil {
+				t.Errorf("ParseSearchQuery(%q) returned no error", input)
+			}
+		})
+	}
+}
+
+func TestSearchFiltersApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters SearchFilters
+		want    url.Values
+	}{
+		{
+			name: "no filters",
+			want: url.Values{},
+		},
+		{
+			name:    "all filters",
+			filters: SearchFilters{Category: "films", Quality: "2160p", Year: "2021", Period: "week"},
+			want:    url.Values{"c": {"1002"}, "v": {"7"}, "d": {"2021"}, "w": {"4"}},
+		},
+		{
+			name:    "russian values",
+			filters: SearchFilters{Category: "аудиокниги", Period: "вчера"},
+			want:    url.Values{"c": {"2"}, "w": {"2"}},
+		},
+		{
+			name:    "series in hd",
+			filters: SearchFilters{Category: "series", Quality: "720p"},
+			want:    url.Values{"c": {"1001"}, "v": {"3"}},
+		},
+		{
+			name:    "bluray",
+			filters: SearchFilters{Quality: "bluray"},
+			want:    url.Values{"v": {"4"}},
+		},
+		{
+			name:    "games today",
+			filters: SearchFilters{Category: "games", Period: "today"},
+			want:    url.Values{"c": {"23"}, "w": {"1"}},
+		},
+		{
+			name:    "year only",
+			filters: SearchFilters{Year: "1999"},
+			want:    url.Values{"d": {"1999"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := url.Values{}
+			tt.filters.apply(params)
+			if params.Encode() != tt.want.Encode() {
+				t.Errorf("params = %q, want %q", params.Encode(), tt.want.Encode())
+			}
+		})
+	}
+}
+
+func TestSearchFiltersApplyKeepsQuery(t *testing.T) {
+	params := url.Values{"s": {"Дюна"}}
+	SearchFilters{Category: "films"}.apply(params)
+	if params.Get("s") != "Дюна" || params.Get("c") != "1002" {
+		t.Errorf("params = %v", params)
+	}
+}
+
+func TestSearchFiltersMatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters SearchFilters
+		title   string
+		want    bool
+	}{
+		{"no resolution", SearchFilters{Quality: "hd"}, "Дюна / Dune / 2021 / WEB-DL (720p)", true},
+		{"resolution in title", SearchFilters{Quality: "1080p", Resolution: "1080p"}, "Дюна / Dune / 2021 / BDRip (1080p)", true},
+		{"resolution case-insensitive", SearchFilters{Quality: "2160p", Resolution: "2160p"}, "Дюна / 2021 / WEB-DL 2160P HDR", true},
+		{"other resolution", SearchFilters{Quality: "1080p", Resolution: "1080p"}, "Дюна / Dune / 2021 / WEB-DL (720p)", false},
+		{"no resolution in title", SearchFilters{Quality: "720p", Resolution: "720p"}, "Дюна / Dune / 2021 / DVDRip", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filters.Match(SearchResult{Title: tt.title}); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchFiltersRoundTrip(t *testing.T) {
+	input := "cat:series q:1080p year:2020 period:month"
+	_, filters, err := ParseSearchQuery(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filters.String() != input {
+		t.Errorf("String() = %q, want %q", filters.String(), input)
+	}
+	if filters.IsEmpty() {
+		t.Error("IsEmpty() = true for parsed filters")
+	}
+	if !(SearchFilters{}).IsEmpty() {
+		t.Error("IsEmpty() = false for empty filters")
+	}
+}
@@ -0,0 +1,90 @@
+package torrent
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"kinozal-bot/errors"
+	"kinozal-bot/logger"
+)
+
+// ErrDownloadLimit возвращается, когда Kinozal отказывает в скачивании .torrent из-за суточного лимита
+var ErrDownloadLimit = errors.NewKinozalError("Daily torrent download limit reached", nil)
+
+// infoHashPattern находит инфо-хеш в ответе get_srv_details.php
+var infoHashPattern = regexp.MustCompile(`(?i)Инфо хеш:\s*([0-9a-f]{40})`)
+
+// magnetHashPattern находит инфо-хеш в параметре xt magnet-ссылки
+var magnetHashPattern = regexp.MustCompile(`(?i)xt=urn:btih:([0-9a-f]{40})(?:&|$)`)
+
+// downloadLimitMarkers — фразы сообщения Kinozal о превышении суточного лимита скачиваний.
+// Общие слова вроде "не более" сюда не входят: они встречаются и на обычных страницах.
+var downloadLimitMarkers = []string{
+	"лимит скачиваний",
+	"лимит скачивания",
+	"исчерпали лимит",
+	"исчерпан лимит",
+	"превышен лимит",
+}
+
+// GetInfoHash получает инфо-хеш раздачи через get_srv_details.php
+func GetInfoHash(session *KinozalSession, torrentID string) (string, error) {
+	page, err := fetchSrvDetails(session, torrentID)
+	if err != nil {
+		return "", err
+	}
+
+	hash := ParseInfoHash(page)
+	if hash == "" {
+		return "", errors.NewKinozalError("Info hash not found in server details", map[string]interface{}{
+			"torrent_id": torrentID,
+		})
+	}
+
+	logger.Debug("Info hash received", map[string]interface{}{
+		"torrent_id": torrentID,
+		"hash":       hash,
+	})
+	return hash, nil
+}
+
+// ParseInfoHash извлекает инфо-хеш из ответа get_srv_details.php
+func ParseInfoHash(html string) string {
+	match := infoHashPattern.FindStringSubmatch(html)
+	if match == nil {
+		return ""
+	}
+	return strings.ToUpper(match[1])
+}
+
+// MagnetLink формирует magnet-ссылку по инфо-хешу и названию раздачи
+func MagnetLink(hash, title string) string {
+	link := fmt.Sprintf("magnet:?xt=urn:btih:%s", hash)
+	if title != "" {
+		link += "&dn=" + url.QueryEscape(title)
+	}
+	return link
+}
+
+// MagnetHash извлекает инфо-хеш из magnet-ссылки в нижнем регистре.
+// Возвращает пустую строку, если ссылка не содержит hex-хеша BitTorrent v1.
+func MagnetHash(link string) string {
+	match := magnetHashPattern.FindStringSubmatch(link)
+	if match == nil {
+		return ""
+	}
+	return strings.ToLower(match[1])
+}
+
+// isDownloadLimitPage проверяет, сообщает ли страница о превышении лимита скачиваний
+func isDownloadLimitPage(html string) bool {
+	lower := strings.ToLower(html)
+	for _, marker := range downloadLimitMarkers {
+		if strings.Contains(lower, marker) && strings.Contains(lower, "торрент") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package torrent
+
+import "testing"
+
+func TestIsDownloadLimitPage(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want bool
+	}{
+		{"limit exhausted", "<p>Вы исчерпали лимит скачиваний торрент-файлов на сегодня.</p>", true},
+		{"limit exceeded", "<div>Превышен лимит скачивания торрентов за сутки</div>", true},
+		{"upper case", "<b>ЛИМИТ СКАЧИВАНИЙ ТОРРЕНТ-ФАЙЛОВ</b>", true},
+		{"limit without torrent", "<p>Исчерпали лимит сообщений</p>", false},
+		{"ordinary page with не более", "<p>Раздача: не более 2 торрентов в одном архиве</p>", false},
+		{"login page", "<form>Вход. Для скачивания торрента войдите на сайт</form>", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isDownloadLimitPage(tt.html); got != tt.want {
+				t.Errorf("isDownloadLimitPage(%q) = %v, want %v", tt.html, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMagnetHash(t *testing.T) {
+	hash := "C365F0C86634937C6D1BEB87172A6C86CA4C30A0"
+	if got := MagnetHash(MagnetLink(hash, "Дюна")); got != "c365f0c86634937c6d1beb87172a6c86ca4c30a0" {
+		t.Errorf("MagnetHash = %q", got)
+	}
+	if got := MagnetHash("magnet:?xt=urn:btmh:1220abcd"); got != "" {
+		t.Errorf("MagnetHash of a v2 link = %q", got)
+	}
+}
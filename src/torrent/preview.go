@@ -0,0 +1,59 @@
+package torrent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"kinozal-bot/bencode"
+	"kinozal-bot/fileutils"
+)
+
+// maxPreviewLines — сколько строк дерева файлов показывается пользователю,
+// чтобы сообщение не превысило лимит Telegram на больших раздачах
+const maxPreviewLines = 25
+
+// RenderContents описывает содержимое торрента: название, общий размер и дерево файлов
+func RenderContents(meta *bencode.Metainfo) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("📦 %s\n", meta.Name))
+	b.WriteString(fmt.Sprintf("Размер: %s, файлов: %d\n", fileutils.FormatSize(meta.TotalSize()), len(meta.Files)))
+	if !meta.MultiFile {
+		return b.String()
+	}
+
+	files := make([]bencode.File, len(meta.Files))
+	copy(files, meta.Files)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name() < files[j].Name()
+	})
+
+	b.WriteString("\n")
+	lines := 0
+	var previous []string
+	for i, file := range files {
+		dirs := file.Path[:len(file.Path)-1]
+
+		// Печатаем только папки, которые отличаются от папок предыдущего файла
+		common := 0
+		for common < len(dirs) && common < len(previous) && dirs[common] == previous[common] {
+			common++
+		}
+		for depth := common; depth < len(dirs); depth++ {
+			if lines >= maxPreviewLines {
+				break
+			}
+			b.WriteString(fmt.Sprintf("%s📁 %s\n", strings.Repeat("   ", depth), dirs[depth]))
+			lines++
+		}
+		previous = dirs
+
+		if lines >= maxPreviewLines {
+			b.WriteString(fmt.Sprintf("… и еще файлов: %d\n", len(files)-i))
+			break
+		}
+		b.WriteString(fmt.Sprintf("%s📄 %s — %s\n", strings.Repeat("   ", len(dirs)), file.Path[len(file.Path)-1], fileutils.FormatSize(file.Length)))
+		lines++
+	}
+	return b.String()
+}
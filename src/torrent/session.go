@@ -0,0 +1,302 @@
+package torrent
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+
+	"kinozal-bot/config"
+	"kinozal-bot/errors"
+	"kinozal-bot/logger"
+	"kinozal-bot/store"
+)
+
+// requestInterval — минимальный интервал между запросами к Kinozal
+const requestInterval = 1 * time.Second
+
+// KinozalSession — долгоживущая сессия Kinozal с общим HTTP-клиентом и хранилищем кук.
+// Безопасна для использования из нескольких горутин: при истечении сессии повторный
+// вход выполняется один раз, остальные запросы дожидаются его результата.
+type KinozalSession struct {
+	cfg    *config.Config
+	db     store.Store // куки сохраняются между перезапусками
+	client *http.Client
+	jar    *cookiejar.Jar
+
+	mu         sync.Mutex
+	generation int        // увеличивается после каждого успешного входа
+	inflight   *loginCall // выполняющийся в данный момент вход
+
+	// Общий ограничитель частоты запросов для поиска пользователей и фоновых задач
+	throttleMu  sync.Mutex
+	lastRequest time.Time
+}
+
+// loginCall описывает выполняющийся вход, результат которого ожидают другие запросы
+type loginCall struct {
+	done chan struct{}
+	err  error
+}
+
+// NewKinozalSession создает сессию и восстанавливает куки, сохраненные при прошлом запуске
+func NewKinozalSession(cfg *config.Config, db store.Store) (*KinozalSession, error) {
+	// Создаем CookieJar для хранения кук
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create cookie jar: %w", err)
+	}
+
+	s := &KinozalSession{
+		cfg: cfg,
+		db:  db,
+		jar: jar,
+		client: &http.Client{
+			Jar:     jar,
+			Timeout: 30 * time.Second,
+		},
+	}
+
+	var cookies []*http.Cookie
+	found, err := db.Get(store.BucketSessions, store.SessionKinozal, &cookies)
+	if err != nil {
+		logger.Warn("Failed to load cookies", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else if found {
+		// Куки хранятся без домена, поэтому выставляем их для всех хостов Kinozal
+		for _, host := range s.hosts() {
+			jar.SetCookies(host, cookies)
+		}
+		logger.Info("Loaded cookies from storage", nil)
+	}
+
+	return s, nil
+}
+
+// Client возвращает HTTP-клиент сессии
+func (s *KinozalSession) Client() *http.Client {
+	return s.client
+}
+
+// Config возвращает конфигурацию, с которой создана сессия
+func (s *KinozalSession) Config() *config.Config {
+	return s.cfg
+}
+
+// IsLoggedIn сообщает, есть ли у сессии куки авторизации
+func (s *KinozalSession) IsLoggedIn() bool {
+	hasUID := false
+	hasPass := false
+	for _, cookie := range s.jar.Cookies(s.hosts()[0]) {
+		if cookie.Name == "uid" {
+			hasUID = true
+		}
+		if cookie.Name == "pass" {
+			hasPass = true
+		}
+	}
+	return hasUID && hasPass
+}
+
+// EnsureLoggedIn выполняет вход, если у сессии еще нет кук авторизации
+func (s *KinozalSession) EnsureLoggedIn() error {
+	if s.IsLoggedIn() {
+		return nil
+	}
+	return s.Login()
+}
+
+// Login выполняет повторный вход на Kinozal
+func (s *KinozalSession) Login() error {
+	s.mu.Lock()
+	seen := s.generation
+	s.mu.Unlock()
+	return s.relogin(seen)
+}
+
+// relogin выполняет вход, если после входа с номером seen никто другой его еще не выполнил.
+// Параллельные вызовы ожидают результата одного и того же входа.
+func (s *KinozalSession) relogin(seen int) error {
+	s.mu.Lock()
+	if s.generation != seen {
+		// Сессию уже обновил другой запрос
+		s.mu.Unlock()
+		return nil
+	}
+	if call := s.inflight; call != nil {
+		s.mu.Unlock()
+		<-call.done
+		return call.err
+	}
+	call := &loginCall{done: make(chan struct{})}
+	s.inflight = call
+	s.mu.Unlock()
+
+	call.err = s.login()
+
+	s.mu.Lock()
+	if call.err == nil {
+		s.generation++
+	}
+	s.inflight = nil
+	s.mu.Unlock()
+	close(call.done)
+
+	return call.err
+}
+
+// do выполняет запрос от имени сессии и возвращает ответ с прочитанным телом.
+// Если Kinozal вернул форму входа, сессия обновляется и запрос повторяется один раз.
+func (s *KinozalSession) do(req *http.Request) (*http.Response, []byte, error) {
+	s.mu.Lock()
+	seen := s.generation
+	s.mu.Unlock()
+
+	resp, body, err := s.send(req)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !IsLoginPage(body) {
+		return resp, body, nil
+	}
+
+	logger.Warn("Kinozal session expired, logging in again", map[string]interface{}{
+		"url": req.URL.String(),
+	})
+
+	if err := s.relogin(seen); err != nil {
+		return nil, nil, errors.NewKinozalError("Failed to re-login", map[string]interface{}{"error": err.Error()})
+	}
+
+	resp, body, err = s.send(req.Clone(req.Context()))
+	if err != nil {
+		return nil, nil, err
+	}
+	if IsLoginPage(body) {
+		return nil, nil, errors.NewKinozalError("Kinozal still requires login after re-login", map[string]interface{}{
+			"url": req.URL.String(),
+		})
+	}
+	return resp, body, nil
+}
+
+// send выполняет запрос и читает тело ответа целиком
+func (s *KinozalSession) send(req *http.Request) (*http.Response, []byte, error) {
+	s.throttle()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.NewKinozalError("Failed to read response", map[string]interface{}{"error": err.Error()})
+	}
+	return resp, body, nil
+}
+
+// throttle дожидается, пока с последнего запроса к Kinozal пройдет requestInterval.
+// Запросы из всех горутин выполняются по очереди.
+func (s *KinozalSession) throttle() {
+	s.throttleMu.Lock()
+	defer s.throttleMu.Unlock()
+
+	if wait := time.Until(s.lastRequest.Add(requestInterval)); wait > 0 {
+		time.Sleep(wait)
+	}
+	s.lastRequest = time.Now()
+}
+
+// login выполняет вход на Kinozal с учетными данными из конфигурации
+func (s *KinozalSession) login() error {
+	cfg := s.cfg
+
+	// Шаг 1: Тестирование соединения с главной страницей
+	mainPageURL := fmt.Sprintf("https://%s/", cfg.Kinozal.Address)
+	logger.Debug("Testing connection to main page", map[string]interface{}{
+		"url": mainPageURL,
+	})
+
+	s.throttle()
+	resp, err := s.client.Get(mainPageURL)
+	if err != nil {
+		return errors.NewKinozalError("Failed to connect to main page", map[string]interface{}{"error": err.Error()})
+	}
+	resp.Body.Close()
+
+	logger.Debug("Main page response", map[string]interface{}{
+		"status":  resp.StatusCode,
+		"cookies": s.jar.Cookies(resp.Request.URL),
+	})
+
+	// Шаг 2: Отправка запроса логина
+	loginURL := fmt.Sprintf("https://%s%s", cfg.Kinozal.Address, cfg.Kinozal.Endpoints.Login)
+	loginData := url.Values{}
+	loginData.Set("username", cfg.Kinozal.Username)
+	loginData.Set("password", cfg.Kinozal.Password)
+	loginData.Set("returnto", "/")
+	loginData.Set("before", "//")
+	loginData.Set("auth_submit_login", "submit")
+
+	req, err := http.NewRequest("POST", loginURL, bytes.NewBufferString(loginData.Encode()))
+	if err != nil {
+		return errors.NewKinozalError("Failed to create login request", map[string]interface{}{"error": err.Error()})
+	}
+
+	// Устанавливаем заголовки
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Referer", mainPageURL)
+	req.Header.Set("Origin", mainPageURL)
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
+	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7")
+
+	_, body, err := s.send(req)
+	if err != nil {
+		return errors.NewKinozalError("Failed to execute login request", map[string]interface{}{"error": err.Error()})
+	}
+
+	logger.Debug("Login response body", map[string]interface{}{
+		"body": string(body),
+	})
+
+	// Шаг 3: Проверка кук
+	if !s.IsLoggedIn() {
+		return errors.NewKinozalError("Login failed - missing required cookies", map[string]interface{}{
+			"cookies": s.jar.Cookies(s.hosts()[0]),
+		})
+	}
+
+	// Сохраняем куки, чтобы после перезапуска не входить заново
+	err = s.db.Put(store.BucketSessions, store.SessionKinozal, s.jar.Cookies(s.hosts()[0]))
+	if err != nil {
+		logger.Warn("Failed to save cookies after login", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else {
+		logger.Info("Cookies saved successfully after login", nil)
+	}
+
+	logger.Info("Successfully logged in to Kinozal", nil)
+	return nil
+}
+
+// hosts возвращает адреса Kinozal, для которых используются куки сессии
+func (s *KinozalSession) hosts() []*url.URL {
+	return []*url.URL{
+		{Scheme: "https", Host: s.cfg.Kinozal.Address, Path: "/"},
+		{Scheme: "https", Host: "dl." + s.cfg.Kinozal.Address, Path: "/"},
+	}
+}
+
+// IsLoginPage проверяет, содержит ли ответ форму входа вместо запрошенной страницы
+func IsLoginPage(body []byte) bool {
+	return bytes.Contains(body, []byte(`name="username"`)) && bytes.Contains(body, []byte(`name="password"`))
+}
@@ -1,21 +1,17 @@
 package torrent
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
-	"os"
 	"strings"
 	"time"
 
 	"golang.org/x/text/encoding/charmap"
 	"golang.org/x/text/transform"
 
-	"kinozal-bot/config"
+	"kinozal-bot/bencode"
 	"kinozal-bot/errors"
 	"kinozal-bot/fileutils"
 	"kinozal-bot/logger"
@@ -28,167 +24,28 @@ type SearchResult struct {
 	ID      string
 	Seeders int
 	Size    string
+	Section string // ID раздела Kinozal (значок категории в строке результатов)
 }
 
-// Создаем HTTP-клиент с тайм-аутами
-func createHTTPClient() *http.Client {
-	return &http.Client{
-		Timeout: 10 * time.Second,
-	}
-}
-
-// SaveCookies сохраняет куки в файл
-func SaveCookies(cookies []*http.Cookie, filePath string) error {
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("Failed to create cookie file: %w", err)
-	}
-	defer file.Close()
-
-	err = json.NewEncoder(file).Encode(cookies)
-	if err != nil {
-		return fmt.Errorf("Failed to encode cookies to JSON: %w", err)
-	}
-
-	return nil
-}
-
-// LoadCookies загружает куки из файла
-func LoadCookies(filePath string) ([]*http.Cookie, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to open cookie file: %w", err)
-	}
-	defer file.Close()
-
-	var cookies []*http.Cookie
-	err = json.NewDecoder(file).Decode(&cookies)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to decode cookies from JSON: %w", err)
-	}
-
-	return cookies, nil
-}
-
-func LoginKinozal(cfg *config.Config) (*http.Client, []*http.Cookie, error) {
-	// Создаем CookieJar для хранения кук
-	jar, err := cookiejar.New(nil)
-	if err != nil {
-		return nil, nil, fmt.Errorf("Failed to create cookie jar: %w", err)
-	}
-
-	client := &http.Client{
-		Jar: jar,
-	}
-
-	// Шаг 1: Тестирование соединения с главной страницей
-	mainPageURL := fmt.Sprintf("https://%s/", cfg.Kinozal.Address)
-	logger.Debug("Testing connection to main page", map[string]interface{}{
-		"url": mainPageURL,
-	})
-
-	resp, err := client.Get(mainPageURL)
-	if err != nil {
-		return nil, nil, errors.NewKinozalError("Failed to connect to main page", map[string]interface{}{"error": err.Error()})
-	}
-	defer resp.Body.Close()
-
-	logger.Debug("Main page response", map[string]interface{}{
-		"status":  resp.StatusCode,
-		"cookies": jar.Cookies(resp.Request.URL),
-	})
+func SearchTorrents(session *KinozalSession, query string, filters SearchFilters) ([]SearchResult, error) {
+	cfg := session.Config()
 
-	// Шаг 2: Отправка запроса логина
-	loginURL := fmt.Sprintf("https://%s%s", cfg.Kinozal.Address, cfg.Kinozal.Endpoints.Login)
-	loginData := fmt.Sprintf("username=%s&password=%s&returnto=/&before=//&auth_submit_login=submit",
-		cfg.Kinozal.Username, cfg.Kinozal.Password)
-
-	req, err := http.NewRequest("POST", loginURL, bytes.NewBufferString(loginData))
-	if err != nil {
-		return nil, nil, errors.NewKinozalError("Failed to create login request", map[string]interface{}{"error": err.Error()})
-	}
-
-	// Устанавливаем заголовки
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Referer", mainPageURL)
-	req.Header.Set("Origin", mainPageURL)
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7")
-	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
-
-	resp, err = client.Do(req)
-	if err != nil {
-		return nil, nil, errors.NewKinozalError("Failed to execute login request", map[string]interface{}{"error": err.Error()})
-	}
-	defer resp.Body.Close()
-
-	// Чтение тела ответа
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, nil, errors.NewKinozalError("Failed to read login response", map[string]interface{}{"error": err.Error()})
-	}
-
-	logger.Debug("Login response body", map[string]interface{}{
-		"body": string(body),
-	})
-
-	// Шаг 3: Проверка кук
-	cookies := jar.Cookies(resp.Request.URL)
-	hasUID := false
-	hasPass := false
-
-	for _, cookie := range cookies {
-		if cookie.Name == "uid" {
-			hasUID = true
-		}
-		if cookie.Name == "pass" {
-			hasPass = true
-		}
-	}
-
-	logger.Debug("Cookie check after login", map[string]interface{}{
-		"has_uid":  hasUID,
-		"has_pass": hasPass,
-	})
-
-	if !hasUID || !hasPass {
-		return nil, nil, errors.NewKinozalError("Login failed - missing required cookies", map[string]interface{}{
-			"cookies": cookies,
-		})
-	}
-
-	// Сохраняем куки в файл
-	const cookieFilePath = "kinozal_cookies.json"
-	err = SaveCookies(cookies, cookieFilePath)
-	if err != nil {
-		logger.Warn("Failed to save cookies after login", map[string]interface{}{
-			"error": err.Error(),
-		})
-	} else {
-		logger.Info("Cookies saved successfully after login", map[string]interface{}{
-			"file": cookieFilePath,
-		})
-	}
-
-	logger.Info("Successfully logged in to Kinozal", nil)
-
-	// Возвращаем клиент и куки
-	return client, cookies, nil
-}
+	// Requests are rate limited by the session, shared with background jobs
+	// Use correct Kinozal sorting parameters: t=1 (Сидам) and f=0 (Убывание)
+	params := url.Values{}
+	params.Set("s", query)
+	params.Set("t", "1")
+	params.Set("f", "0")
+	filters.apply(params)
 
-func SearchTorrents(cfg *config.Config, client *http.Client, query string) ([]SearchResult, error) {
-	// Add delay to prevent rate limiting
-	time.Sleep(1 * time.Second)
-	
 	// Properly URL encode the query to handle spaces and special characters
-	encodedQuery := url.QueryEscape(query)
-	// Use correct Kinozal sorting parameters: t=1 (Сидам) and f=0 (Убывание)
-	searchURL := fmt.Sprintf("https://%s%s?s=%s&t=1&f=0", cfg.Kinozal.Address, cfg.Kinozal.Endpoints.Search, encodedQuery)
+	encodedQuery := params.Encode()
+	searchURL := fmt.Sprintf("https://%s%s?%s", cfg.Kinozal.Address, cfg.Kinozal.Endpoints.Search, encodedQuery)
 
 	logger.Debug("Searching torrents", map[string]interface{}{
 		"url":           searchURL,
 		"query":         query,
+		"filters":       filters.String(),
 		"encoded_query": encodedQuery,
 	})
 
@@ -213,89 +70,67 @@ func SearchTorrents(cfg *config.Config, client *http.Client, query string) ([]Se
 
 	// Retry mechanism for handling temporary failures
 	maxRetries := 3
-	var resp *http.Response
-	
+	var body []byte
+
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		logger.Debug("Search attempt", map[string]interface{}{
-			"attempt": attempt,
+			"attempt":     attempt,
 			"max_retries": maxRetries,
 		})
-		
-		// Execute the request
-		resp, err = client.Do(req)
+
+		// Execute the request; an expired session is renewed by the session itself
+		var resp *http.Response
+		resp, body, err = session.do(req.Clone(req.Context()))
 		if err != nil {
 			if attempt == maxRetries {
 				return nil, errors.NewKinozalError("Failed to execute search request after retries", map[string]interface{}{
-					"error": err.Error(),
+					"error":    err.Error(),
 					"attempts": attempt,
 				})
 			}
 			logger.Warn("Search request failed, retrying", map[string]interface{}{
-				"error": err.Error(),
+				"error":   err.Error(),
 				"attempt": attempt,
 			})
 			time.Sleep(time.Duration(attempt) * 2 * time.Second) // Progressive delay
 			continue
 		}
-		
+
 		// Check response status
 		if resp.StatusCode == http.StatusOK {
 			break // Success, proceed with processing
 		}
-		
-		resp.Body.Close() // Close body before retry
-		
+
 		if resp.StatusCode == 400 {
 			if attempt == maxRetries {
 				return nil, errors.NewKinozalError("Search request failed with 400 Bad Request", map[string]interface{}{
-					"status": resp.Status,
-					"attempts": attempt,
-					"query": query,
+					"status":        resp.Status,
+					"attempts":      attempt,
+					"query":         query,
 					"encoded_query": encodedQuery,
 				})
 			}
 			logger.Warn("Received 400 Bad Request, retrying with delay", map[string]interface{}{
 				"attempt": attempt,
-				"status": resp.Status,
+				"status":  resp.Status,
 			})
 			time.Sleep(time.Duration(attempt) * 3 * time.Second) // Longer delay for 400 errors
 			continue
 		}
-		
+
 		if attempt == maxRetries {
 			return nil, errors.NewKinozalError("Search request failed", map[string]interface{}{
-				"status": resp.Status,
+				"status":   resp.Status,
 				"attempts": attempt,
 			})
 		}
-		
+
 		logger.Warn("Non-OK status, retrying", map[string]interface{}{
-			"status": resp.Status,
+			"status":  resp.Status,
 			"attempt": attempt,
 		})
 		time.Sleep(time.Duration(attempt) * 2 * time.Second)
 	}
-	
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, errors.NewKinozalError("Failed to read search response", map[string]interface{}{"error": err.Error()})
-	}
-
-	// Check if the response contains a login form, which would indicate authentication issues
-	if strings.Contains(string(body), "name=\"username\"") && strings.Contains(string(body), "name=\"password\"") {
-		logger.Warn("Received login page instead of search results, retrying login", nil)
-
-		// Re-login and try again
-		newClient, _, err := LoginKinozal(cfg)
-		if err != nil {
-			return nil, errors.NewKinozalError("Failed to re-login for search", map[string]interface{}{"error": err.Error()})
-		}
-
-		// Recursive call with the new client (only once to avoid infinite recursion)
-		return SearchTorrents(cfg, newClient, query)
-	}
 
 	decodedBody, err := decodeWindows1251(string(body))
 	if err != nil {
@@ -308,6 +143,15 @@ func SearchTorrents(cfg *config.Config, client *http.Client, query string) ([]Se
 		"count": len(results),
 	})
 
+	// Apply filters that Kinozal cannot evaluate server-side
+	filtered := results[:0]
+	for _, result := range results {
+		if filters.Match(result) {
+			filtered = append(filtered, result)
+		}
+	}
+	results = filtered
+
 	// Results are already sorted by the server using t=1&f=0 parameters (Sort by seeders, descending)
 	// No need for client-side sorting anymore
 
@@ -318,46 +162,25 @@ func SearchTorrents(cfg *config.Config, client *http.Client, query string) ([]Se
 	return results, nil
 }
 
-func DownloadTorrent(cfg *config.Config, client *http.Client, torrentID string) (string, error) {
-	const cookieFilePath = "kinozal_cookies.json"
+func DownloadTorrent(session *KinozalSession, torrentID string) (string, error) {
+	cfg := session.Config()
 
 	logger.Debug("Starting torrent download", map[string]interface{}{
 		"torrent_id": torrentID,
 	})
 
-	// Загружаем куки из файла, если файл существует
-	var cookies []*http.Cookie
-	if _, err := os.Stat(cookieFilePath); err == nil {
-		cookies, err = LoadCookies(cookieFilePath)
-		if err != nil {
-			logger.Warn("Failed to load cookies", map[string]interface{}{
-				"error": err.Error(),
-			})
-		} else {
-			logger.Info("Loaded cookies from file", map[string]interface{}{
-				"file": cookieFilePath,
-			})
-		}
-	}
-
 	// Формируем URL для скачивания
 	downloadURL := fmt.Sprintf("https://dl.%s/download.php?id=%s", cfg.Kinozal.Address, torrentID)
 	logger.Debug("Download URL", map[string]interface{}{
 		"url": downloadURL,
 	})
 
-retryDownload:
 	// Создаём запрос
 	req, err := http.NewRequest("GET", downloadURL, nil)
 	if err != nil {
 		return "", fmt.Errorf("Failed to create download request: %w", err)
 	}
 
-	// Добавляем куки к запросу
-	for _, cookie := range cookies {
-		req.AddCookie(cookie)
-	}
-
 	// Устанавливаем заголовки
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
 	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
@@ -371,12 +194,11 @@ retryDownload:
 	req.Header.Set("Upgrade-Insecure-Requests", "1")
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/130.0.0.0 Safari/537.36")
 
-	// Выполняем запрос
-	resp, err := client.Do(req)
+	// Выполняем запрос; истекшую сессию обновит сама сессия
+	resp, data, err := session.do(req)
 	if err != nil {
 		return "", fmt.Errorf("Failed to execute download request: %w", err)
 	}
-	defer resp.Body.Close()
 
 	// Проверяем статус ответа
 	if resp.StatusCode != http.StatusOK {
@@ -392,9 +214,11 @@ retryDownload:
 		"content_type": contentType,
 	})
 
-	if contentType != "application/x-bittorrent" {
-		htmlBody, _ := ioutil.ReadAll(resp.Body)
-		bodyPreview := string(htmlBody)
+	// Ответ считается торрентом, только если он разбирается как метаинформация:
+	// заголовок Content-Type бывает неверным в обе стороны
+	meta, metaErr := bencode.ParseMetainfo(data)
+	if metaErr != nil && contentType != "application/x-bittorrent" {
+		bodyPreview := string(data)
 		if len(bodyPreview) > 200 {
 			bodyPreview = bodyPreview[:200] + "..." // Truncate for logging
 		}
@@ -403,43 +227,37 @@ retryDownload:
 			"body_preview": bodyPreview,
 		})
 
-		// Если это HTML, проверяем авторизацию
-		if strings.Contains(string(htmlBody), "name=\"username\"") ||
-			strings.Contains(string(htmlBody), "name=\"password\"") ||
-			strings.Contains(string(htmlBody), "login") ||
-			strings.Contains(string(htmlBody), "вход") {
-			logger.Warn("Authorization required, retrying login", map[string]interface{}{
+		// Проверяем, не исчерпан ли суточный лимит скачивания .torrent-файлов
+		if decodedBody, err := decodeWindows1251(string(data)); err == nil && isDownloadLimitPage(decodedBody) {
+			logger.Warn("Kinozal download limit reached", map[string]interface{}{
 				"torrent_id": torrentID,
 			})
-
-			client, cookies, err = LoginKinozal(cfg)
-			if err != nil {
-				return "", fmt.Errorf("Failed to re-login: %w", err)
-			}
-
-			// Повторяем запрос после повторного логина
-			goto retryDownload
+			return "", ErrDownloadLimit
 		}
 
 		logger.Error("Unexpected HTML response", map[string]interface{}{
-			"body": string(htmlBody),
+			"body": string(data),
 		})
 		return "", fmt.Errorf("Received HTML instead of torrent file")
 	}
 
-	// Читаем данные файла
-	data, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("Failed to read torrent file data: %w", err)
-	}
-
 	// Проверяем размер данных
 	if len(data) == 0 {
 		return "", fmt.Errorf("Received empty torrent file")
 	}
+	if metaErr != nil {
+		logger.Error("Received invalid torrent file", map[string]interface{}{
+			"torrent_id": torrentID,
+			"error":      metaErr.Error(),
+		})
+		return "", fmt.Errorf("Received invalid torrent file: %w", metaErr)
+	}
 
 	logger.Debug("Torrent file data received", map[string]interface{}{
 		"size_bytes": len(data),
+		"name":       meta.Name,
+		"files":      len(meta.Files),
+		"info_hash":  meta.InfoHash,
 	})
 
 	// Сохраняем файл
@@ -448,18 +266,6 @@ retryDownload:
 		return "", fmt.Errorf("Failed to save torrent file: %w", err)
 	}
 
-	// Сохраняем актуальные куки после успешного запроса
-	err = SaveCookies(resp.Cookies(), cookieFilePath)
-	if err != nil {
-		logger.Warn("Failed to save updated cookies", map[string]interface{}{
-			"error": err.Error(),
-		})
-	} else {
-		logger.Info("Updated cookies saved successfully", map[string]interface{}{
-			"file": cookieFilePath,
-		})
-	}
-
 	logger.Info("Torrent downloaded successfully", map[string]interface{}{
 		"torrent_id": torrentID,
 		"path":       torrentPath,
@@ -590,6 +396,13 @@ func ParseSearchResults(html string) []SearchResult {
 			})
 		}
 
+		// Раздел Kinozal: <td class="bt"><img src="/pic/cat/45.gif" onclick="cat(45);"></td>
+		icon := row.Find("td.bt img")
+		section := ParseSection(icon.AttrOr("onclick", ""))
+		if section == "" {
+			section = ParseSection(icon.AttrOr("src", ""))
+		}
+
 		// ID торрента
 		torrentID := extractIDFromHref(href)
 		if torrentID == "" {
@@ -604,6 +417,7 @@ func ParseSearchResults(html string) []SearchResult {
 			ID:      torrentID,
 			Seeders: seeders,
 			Size:    size,
+			Section: section,
 		}
 
 		logger.Debug("Parsed search result", map[string]interface{}{
@@ -611,6 +425,7 @@ func ParseSearchResults(html string) []SearchResult {
 			"id":      torrentID,
 			"seeders": seeders,
 			"size":    size,
+			"section": section,
 		})
 
 		results = append(results, result)
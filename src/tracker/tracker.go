@@ -0,0 +1,396 @@
+package tracker
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"kinozal-bot/config"
+	"kinozal-bot/downloader"
+	"kinozal-bot/fileutils"
+	"kinozal-bot/logger"
+	"kinozal-bot/store"
+	"kinozal-bot/transmission"
+)
+
+// pollInterval — период опроса торрент-клиента
+const pollInterval = 10 * time.Second
+
+// Tracker отслеживает загрузку торрентов, добавленных через бота,
+// обновляет сообщение со статусом и уведомляет пользователя о завершении
+type Tracker struct {
+	bot    transmission.BotInterface
+	cfg    *config.Config
+	client downloader.DownloadClient
+	db     store.Store
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// Download описывает торрент, добавленный через бота
+type Download struct {
+	Hash   string `json:"hash"`
+	Name   string `json:"name"`
+	KzID   string `json:"kz_id"`
+	Folder string `json:"folder"`
+	ChatID int64  `json:"chat_id"`
+	UserID int64  `json:"user_id"`
+}
+
+// entry — отслеживаемый торрент. Завершенные загрузки хранятся, пока торрент
+// остается в торрент-клиенте, чтобы было известно, кто его добавил.
+type entry struct {
+	Download
+	MessageID int       `json:"message_id"`
+	AddedAt   time.Time `json:"added_at"`
+	Completed bool      `json:"completed"`
+	lastText  string
+}
+
+// New создает трекер загрузок и восстанавливает сохраненный список загрузок
+func New(bot transmission.BotInterface, cfg *config.Config, client downloader.DownloadClient, db store.Store) *Tracker {
+	t := &Tracker{
+		bot:     bot,
+		cfg:     cfg,
+		client:  client,
+		db:      db,
+		entries: make(map[string]*entry),
+	}
+
+	if err := t.load(); err != nil {
+		logger.Warn("Failed to load tracked downloads", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else if len(t.entries) > 0 {
+		logger.Info("Restored tracked downloads", map[string]interface{}{
+			"count": len(t.entries),
+		})
+	}
+
+	return t
+}
+
+// Track начинает отслеживать торрент и отправляет в чат сообщение со статусом
+func (t *Tracker) Track(download Download) {
+	if download.Hash == "" {
+		logger.Warn("Cannot track torrent without hash", map[string]interface{}{
+			"name": download.Name,
+		})
+		return
+	}
+	// Клиент без RPC (папка наблюдения) не сообщает состояние торрентов — следить не за чем
+	if _, err := t.client.List([]string{download.Hash}); err == downloader.ErrUnsupported {
+		return
+	}
+
+	text := fmt.Sprintf("⏳ %s\nОжидание данных от %s...", download.Name, t.client.Name())
+	sent, err := t.bot.Send(tgbotapi.NewMessage(download.ChatID, text))
+	if err != nil {
+		logger.Error("Failed to send progress message", map[string]interface{}{
+			"chat_id": download.ChatID,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	e := &entry{
+		Download:  download,
+		MessageID: sent.MessageID,
+		AddedAt:   time.Now(),
+		lastText:  text,
+	}
+	t.mu.Lock()
+	t.entries[download.Hash] = e
+	t.mu.Unlock()
+	t.save(e)
+
+	logger.Info("Tracking torrent progress", map[string]interface{}{
+		"hash":    download.Hash,
+		"name":    download.Name,
+		"chat_id": download.ChatID,
+	})
+}
+
+// Run периодически опрашивает торрент-клиент до закрытия канала stop
+func (t *Tracker) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			t.poll()
+		}
+	}
+}
+
+// poll обновляет статус всех отслеживаемых торрентов
+func (t *Tracker) poll() {
+	t.mu.Lock()
+	hashes := make([]string, 0, len(t.entries))
+	for hash := range t.entries {
+		hashes = append(hashes, hash)
+	}
+	t.mu.Unlock()
+
+	if len(hashes) == 0 {
+		return
+	}
+
+	torrents, err := t.client.List(hashes)
+	if err != nil {
+		logger.Warn("Failed to poll download client", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	found := make(map[string]downloader.TorrentInfo, len(torrents))
+	for _, info := range torrents {
+		found[info.Hash] = info
+	}
+
+	for _, hash := range hashes {
+		t.mu.Lock()
+		e, ok := t.entries[hash]
+		t.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		info, exists := found[hash]
+		switch {
+		case e.Completed:
+			if !exists {
+				t.forget(e)
+			}
+		case !exists:
+			t.update(e, fmt.Sprintf("❌ %s\nТоррент удален из %s.", e.Name, t.client.Name()))
+			t.forget(e)
+		case info.IsComplete():
+			t.complete(e, info)
+		default:
+			t.update(e, RenderProgress(info))
+		}
+	}
+}
+
+// update редактирует сообщение со статусом, если текст изменился
+func (t *Tracker) update(e *entry, text string) {
+	if text == e.lastText {
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(e.ChatID, e.MessageID, text)
+	if _, err := t.bot.Send(edit); err != nil {
+		logger.Warn("Failed to update progress message", map[string]interface{}{
+			"hash":  e.Hash,
+			"error": err.Error(),
+		})
+		return
+	}
+	e.lastText = text
+}
+
+// complete выводит итоговый статус, уведомляет пользователя и прекращает обновление прогресса
+func (t *Tracker) complete(e *entry, info downloader.TorrentInfo) {
+	t.update(e, fmt.Sprintf("✅ %s\nЗагрузка завершена (%s).", info.Name, fileutils.FormatSize(info.TotalSize)))
+	t.notifyCompleted(e, info)
+
+	t.mu.Lock()
+	e.Completed = true
+	t.mu.Unlock()
+	t.save(e)
+
+	logger.Info("Torrent download completed", map[string]interface{}{
+		"hash": e.Hash,
+		"name": e.Name,
+	})
+}
+
+// forget прекращает отслеживание торрента, которого больше нет в торрент-клиенте
+func (t *Tracker) forget(e *entry) {
+	t.mu.Lock()
+	delete(t.entries, e.Hash)
+	t.mu.Unlock()
+	if err := t.db.Delete(store.BucketDownloads, e.Hash); err != nil {
+		logger.Error("Failed to delete tracked download", map[string]interface{}{
+			"hash":  e.Hash,
+			"error": err.Error(),
+		})
+	}
+
+	logger.Info("Stopped tracking torrent", map[string]interface{}{
+		"hash": e.Hash,
+		"name": e.Name,
+	})
+}
+
+// Untrack прекращает отслеживание торрента без изменения сообщения со статусом.
+// Используется, когда торрент удаляется из торрент-клиента намеренно, например при замене обновленной раздачей.
+func (t *Tracker) Untrack(hash string) {
+	t.mu.Lock()
+	e, ok := t.entries[strings.ToLower(hash)]
+	t.mu.Unlock()
+	if ok {
+		t.forget(e)
+	}
+}
+
+// Owner возвращает ID пользователя, добавившего торрент через бота
+func (t *Tracker) Owner(hash string) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.entries[strings.ToLower(hash)]
+	if !ok {
+		return 0, false
+	}
+	return e.UserID, true
+}
+
+// HasRelease сообщает, добавлялась ли раздача Kinozal через бота и находится ли она еще в торрент-клиенте
+func (t *Tracker) HasRelease(kzID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, e := range t.entries {
+		if e.KzID == kzID {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyCompleted отправляет пользователю отдельное уведомление о завершении загрузки
+func (t *Tracker) notifyCompleted(e *entry, info downloader.TorrentInfo) {
+	folder := info.DownloadDir
+	if folder == "" {
+		folder = e.Folder
+	}
+
+	text := fmt.Sprintf("✅ Загрузка завершена: %s, %s в %s", info.Name, fileutils.FormatSize(info.TotalSize), folder)
+	if !info.DoneDate.IsZero() {
+		text += fmt.Sprintf("\n🕒 %s", info.DoneDate.Local().Format("02.01.2006 15:04"))
+	}
+
+	msg := tgbotapi.NewMessage(e.ChatID, text)
+	msg.ReplyToMessageID = e.MessageID
+	if e.KzID != "" {
+		detailsURL := fmt.Sprintf("https://%s%s?id=%s", t.cfg.Kinozal.Address, t.cfg.Kinozal.Endpoints.Details, e.KzID)
+		msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonURL("🔗 Открыть раздачу", detailsURL)),
+		)
+	}
+
+	if _, err := t.bot.Send(msg); err != nil {
+		logger.Error("Failed to send completion notification", map[string]interface{}{
+			"chat_id": e.ChatID,
+			"hash":    e.Hash,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// load читает отслеживаемые загрузки из базы данных
+func (t *Tracker) load() error {
+	var entries []*entry
+	err := t.db.ForEach(store.BucketDownloads, func(key string, decode func(interface{}) error) error {
+		e := &entry{}
+		if err := decode(e); err != nil {
+			return err
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, e := range entries {
+		t.entries[e.Hash] = e
+	}
+	return nil
+}
+
+// save сохраняет отслеживаемую загрузку в базу данных
+func (t *Tracker) save(e *entry) {
+	t.mu.Lock()
+	saved := *e
+	t.mu.Unlock()
+
+	if err := t.db.Put(store.BucketDownloads, saved.Hash, saved); err != nil {
+		logger.Error("Failed to save tracked download", map[string]interface{}{
+			"hash":  saved.Hash,
+			"error": err.Error(),
+		})
+	}
+}
+
+// RenderProgress формирует текст статуса загрузки
+func RenderProgress(info downloader.TorrentInfo) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("⬇️ %s\n", info.Name))
+	b.WriteString(fmt.Sprintf("%s %.1f%%\n", ProgressBar(info.PercentDone, 10), info.PercentDone*100))
+	b.WriteString(fmt.Sprintf("⚡ %s | ⏱ %s | 👥 %d", FormatSpeed(info.RateDownload), FormatETA(info.ETA), info.PeersConnected))
+	if info.ErrorString != "" {
+		b.WriteString(fmt.Sprintf("\n⚠️ %s", info.ErrorString))
+	}
+	return b.String()
+}
+
+// RenderDuplicate описывает торрент, который не добавлен повторно, потому что уже есть в торрент-клиенте
+func RenderDuplicate(info downloader.TorrentInfo) string {
+	state := "загрузка завершена"
+	if !info.IsComplete() {
+		state = fmt.Sprintf("загружено %.1f%%", info.PercentDone*100)
+	}
+	if info.Stopped {
+		state += ", на паузе"
+	}
+	return fmt.Sprintf("♻️ Торрент уже есть в торрент-клиенте, повторно не добавляю.\n⬇️ %s\n📁 %s\n%s %s",
+		info.Name, info.DownloadDir, ProgressBar(info.PercentDone, 10), state)
+}
+
+// ProgressBar рисует полосу прогресса заданной ширины
+func ProgressBar(percent float64, width int) string {
+	if percent < 0 {
+		percent = 0
+	}
+	if percent > 1 {
+		percent = 1
+	}
+	filled := int(percent * float64(width))
+	return "[" + strings.Repeat("█", filled) + strings.Repeat("░", width-filled) + "]"
+}
+
+// FormatSpeed возвращает скорость в удобочитаемом виде
+func FormatSpeed(bytesPerSecond int64) string {
+	return fileutils.FormatSize(bytesPerSecond) + "/с"
+}
+
+// FormatETA возвращает оставшееся время в удобочитаемом виде
+func FormatETA(eta time.Duration) string {
+	if eta < 0 {
+		return "∞"
+	}
+	hours := int(eta.Hours())
+	minutes := int(eta.Minutes()) % 60
+	switch {
+	case hours >= 24:
+		return fmt.Sprintf("%d д %d ч", hours/24, hours%24)
+	case hours > 0:
+		return fmt.Sprintf("%d ч %d мин", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%d мин", minutes)
+	default:
+		return fmt.Sprintf("%d с", int(eta.Seconds()))
+	}
+}
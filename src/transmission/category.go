@@ -0,0 +1,122 @@
+package transmission
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/hekmon/transmissionrpc"
+	"kinozal-bot/config"
+	"kinozal-bot/errors"
+	"kinozal-bot/logger"
+)
+
+// applyCategory применяет к добавленному торренту настройки категории: ограничения скорости, рейтинг раздачи и метки
+func applyCategory(instance config.TransmissionInstance, client *transmissionrpc.Client, added *transmissionrpc.Torrent, category config.Category) {
+	if added == nil || added.ID == nil {
+		return
+	}
+	id := *added.ID
+
+	payload := &transmissionrpc.TorrentSetPayload{IDs: []int64{id}}
+	changed := false
+	if category.DownloadLimit > 0 {
+		limited := true
+		payload.DownloadLimit = &category.DownloadLimit
+		payload.DownloadLimited = &limited
+		changed = true
+	}
+	if category.UploadLimit > 0 {
+		limited := true
+		payload.UploadLimit = &category.UploadLimit
+		payload.UploadLimited = &limited
+		changed = true
+	}
+	if category.SeedRatio > 0 {
+		mode := transmissionrpc.SeedRatioModeCustom
+		payload.SeedRatioLimit = &category.SeedRatio
+		payload.SeedRatioMode = &mode
+		changed = true
+	}
+
+	if changed {
+		if err := client.TorrentSet(payload); err != nil {
+			logger.Warn("Failed to apply category settings", map[string]interface{}{
+				"id":       id,
+				"category": category.ID,
+				"error":    err.Error(),
+			})
+		}
+	}
+
+	if len(category.Labels) > 0 {
+		if err := setLabels(instance, id, category.Labels); err != nil {
+			logger.Warn("Failed to set torrent labels", map[string]interface{}{
+				"id":       id,
+				"category": category.ID,
+				"error":    err.Error(),
+			})
+		}
+	}
+}
+
+// setLabels устанавливает метки торрента. transmissionrpc не поддерживает поле labels
+// (появилось в Transmission 3.0), поэтому запрос torrent-set отправляется напрямую.
+func setLabels(instance config.TransmissionInstance, id int64, labels []string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"method": "torrent-set",
+		"arguments": map[string]interface{}{
+			"ids":    []int64{id},
+			"labels": labels,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	rpcURL := fmt.Sprintf("http://%s/transmission/rpc", instance.Address())
+	client := &http.Client{Timeout: rpcTimeout}
+	sessionID := ""
+
+	// Первый запрос обычно получает 409 с идентификатором сессии, с которым запрос повторяется
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequest("POST", rpcURL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Transmission-Session-Id", sessionID)
+		if instance.Username != "" {
+			req.SetBasicAuth(instance.Username, instance.Password)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode == http.StatusConflict {
+			sessionID = resp.Header.Get("X-Transmission-Session-Id")
+			resp.Body.Close()
+			continue
+		}
+
+		var answer struct {
+			Result string `json:"result"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&answer)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		if answer.Result != "success" {
+			return errors.NewTransmissionError("Transmission rejected torrent labels", map[string]interface{}{
+				"result": answer.Result,
+			})
+		}
+		return nil
+	}
+
+	return errors.NewTransmissionError("Failed to obtain Transmission session ID", nil)
+}
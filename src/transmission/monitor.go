@@ -0,0 +1,133 @@
+package transmission
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"kinozal-bot/config"
+	"kinozal-bot/logger"
+)
+
+// healthInterval — как часто проверяется доступность экземпляров Transmission
+const healthInterval = time.Minute
+
+// Monitor проверяет доступность экземпляров Transmission и сообщает администратору,
+// когда экземпляр перестает отвечать и когда снова становится доступен. Результаты проверок
+// сохраняются в маршрутизаторе, который по ним выбирает запасной экземпляр.
+type Monitor struct {
+	bot    BotInterface
+	cfg    *config.Config
+	router *Router
+}
+
+// NewMonitor создает монитор экземпляров маршрутизатора router
+func NewMonitor(bot BotInterface, cfg *config.Config, router *Router) *Monitor {
+	return &Monitor{
+		bot:    bot,
+		cfg:    cfg,
+		router: router,
+	}
+}
+
+// Run проверяет экземпляры сразу после запуска и затем периодически до закрытия канала stop
+func (m *Monitor) Run(stop <-chan struct{}) {
+	m.checkAll()
+
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.checkAll()
+		}
+	}
+}
+
+// checkAll проверяет все экземпляры по очереди
+func (m *Monitor) checkAll() {
+	for _, instance := range m.cfg.TransmissionInstances {
+		m.check(instance)
+	}
+}
+
+// check проверяет экземпляр и уведомляет администратора, если его доступность изменилась.
+// О недоступности при первой проверке тоже сообщается, о доступности — нет.
+func (m *Monitor) check(instance config.TransmissionInstance) {
+	err := m.router.Client(instance.Name).Ping()
+	checked, previous := m.router.recordHealth(instance.Name, err)
+
+	switch {
+	case err != nil && (!checked || previous == nil):
+		logger.Warn("Transmission instance went down", map[string]interface{}{
+			"instance": instance.Name,
+			"error":    err.Error(),
+		})
+		text := fmt.Sprintf("🔴 Transmission «%s» (%s) не отвечает.", instance.Name, instance.Address())
+		if instance.Fallback != "" {
+			text += fmt.Sprintf("\nНовые загрузки получает «%s».", instance.Fallback)
+		}
+		m.notifyAdmin(text)
+	case err == nil && checked && previous != nil:
+		logger.Info("Transmission instance is back up", map[string]interface{}{
+			"instance": instance.Name,
+		})
+		m.notifyAdmin(fmt.Sprintf("🟢 Transmission «%s» (%s) снова доступен.", instance.Name, instance.Address()))
+	}
+}
+
+// HandleHealth проверяет все экземпляры и отправляет отчет об их состоянии
+func (m *Monitor) HandleHealth(chatID int64) {
+	var b strings.Builder
+	b.WriteString("🩺 Экземпляры Transmission:\n")
+
+	for _, instance := range m.cfg.TransmissionInstances {
+		m.check(instance)
+		client := m.router.Client(instance.Name)
+		err := m.router.lastHealth(instance.Name)
+
+		b.WriteString("\n")
+		if err != nil {
+			fmt.Fprintf(&b, "🔴 %s (%s) — не отвечает\n", instance.Name, instance.Address())
+		} else if torrents, listErr := client.List(nil); listErr != nil {
+			fmt.Fprintf(&b, "🟡 %s (%s) — RPC отвечает, но список торрентов недоступен\n", instance.Name, instance.Address())
+		} else {
+			fmt.Fprintf(&b, "🟢 %s (%s) — торрентов: %d\n", instance.Name, instance.Address(), len(torrents))
+		}
+
+		if categories := m.routedCategories(instance.Name); len(categories) > 0 {
+			fmt.Fprintf(&b, "   Категории: %s\n", strings.Join(categories, ", "))
+		}
+		if instance.Fallback != "" {
+			fmt.Fprintf(&b, "   Запасной: %s\n", instance.Fallback)
+		}
+	}
+
+	m.bot.SendMessage(chatID, b.String())
+}
+
+// routedCategories возвращает категории, загрузки которых по умолчанию попадают в экземпляр name
+func (m *Monitor) routedCategories(name string) []string {
+	var titles []string
+	for _, category := range m.cfg.Categories {
+		if m.cfg.TransmissionInstanceFor(category.ID, 0).Name == name {
+			titles = append(titles, category.Title())
+		}
+	}
+	return titles
+}
+
+// notifyAdmin отправляет сообщение администратору бота
+func (m *Monitor) notifyAdmin(text string) {
+	if m.cfg.Bot.AdminID == 0 {
+		return
+	}
+	if err := m.bot.SendMessage(int64(m.cfg.Bot.AdminID), text); err != nil {
+		logger.Error("Failed to notify admin about Transmission instance", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
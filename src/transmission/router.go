@@ -0,0 +1,206 @@
+package transmission
+
+import (
+	"sync"
+
+	"kinozal-bot/config"
+	"kinozal-bot/downloader"
+	"kinozal-bot/errors"
+	"kinozal-bot/logger"
+)
+
+// Router распределяет загрузки между экземплярами Transmission по маршрутам из config/transmission.json.
+// Если основной экземпляр не ответил при последней проверке Monitor, загрузка передается его
+// запасному экземпляру. Операции с добавленными торрентами выполняются в том экземпляре, где найден торрент.
+type Router struct {
+	cfg     *config.Config
+	clients map[string]*Client
+	health  *health
+	userID  int64 // пользователь, для которого выбираются маршруты; 0 — только маршруты без пользователя
+}
+
+// health хранит результаты последних проверок экземпляров, общие для всех копий маршрутизатора
+type health struct {
+	mu     sync.Mutex
+	errors map[string]error // nil — экземпляр доступен
+}
+
+// NewRouter создает клиенты всех экземпляров Transmission из конфигурации
+func NewRouter(cfg *config.Config) *Router {
+	clients := make(map[string]*Client, len(cfg.TransmissionInstances))
+	for _, instance := range cfg.TransmissionInstances {
+		clients[instance.Name] = New(instance)
+	}
+	return &Router{cfg: cfg, clients: clients, health: &health{errors: make(map[string]error)}}
+}
+
+// ForUser возвращает маршрутизатор, который учитывает маршруты пользователя userID
+func (r *Router) ForUser(userID int64) downloader.DownloadClient {
+	return &Router{cfg: r.cfg, clients: r.clients, health: r.health, userID: userID}
+}
+
+// Client возвращает клиент экземпляра по имени
+func (r *Router) Client(name string) *Client {
+	return r.clients[name]
+}
+
+// Name возвращает название клиента для сообщений пользователю
+func (r *Router) Name() string {
+	return "Transmission"
+}
+
+// AddFile добавляет торрент в экземпляр, выбранный для категории и пользователя
+func (r *Router) AddFile(content []byte, category config.Category, files downloader.FileChoice) (string, error) {
+	return r.route(category.ID).AddFile(content, category, files)
+}
+
+// AddMagnet добавляет торрент по magnet-ссылке в экземпляр, выбранный для категории и пользователя
+func (r *Router) AddMagnet(link string, category config.Category) (string, error) {
+	return r.route(category.ID).AddMagnet(link, category)
+}
+
+// FreeSpace возвращает свободное место в папке path на экземпляре, куда попадут загрузки категории с этой папкой
+func (r *Router) FreeSpace(path string) (int64, error) {
+	categoryID := ""
+	for _, category := range r.cfg.Categories {
+		if category.Path == path {
+			categoryID = category.ID
+			break
+		}
+	}
+	return r.route(categoryID).FreeSpace(path)
+}
+
+// List возвращает торренты всех экземпляров. Недоступный экземпляр пропускается, если без него
+// ответ полный: запрошены все торренты или все запрошенные хеши найдены в других экземплярах.
+// Иначе отсутствующий торрент нельзя отличить от удаленного, и возвращается ошибка.
+func (r *Router) List(hashes []string) ([]downloader.TorrentInfo, error) {
+	var result []downloader.TorrentInfo
+	var lastErr error
+	failed := 0
+	for _, instance := range r.cfg.TransmissionInstances {
+		infos, err := r.clients[instance.Name].List(hashes)
+		if err != nil {
+			logger.Warn("Failed to list torrents of Transmission instance", map[string]interface{}{
+				"instance": instance.Name,
+				"error":    err.Error(),
+			})
+			lastErr = err
+			failed++
+			continue
+		}
+		result = append(result, infos...)
+	}
+
+	if failed == len(r.cfg.TransmissionInstances) {
+		return nil, lastErr
+	}
+	if failed > 0 && len(hashes) > 0 && len(result) < len(hashes) {
+		return nil, lastErr
+	}
+	return result, nil
+}
+
+// Get возвращает состояние торрента по хешу
+func (r *Router) Get(hash string) (*downloader.TorrentInfo, error) {
+	client, err := r.locate(hash)
+	if err != nil {
+		return nil, err
+	}
+	return client.Get(hash)
+}
+
+// Pause ставит торрент на паузу
+func (r *Router) Pause(hash string) error {
+	client, err := r.locate(hash)
+	if err != nil {
+		return err
+	}
+	return client.Pause(hash)
+}
+
+// Resume возобновляет загрузку торрента
+func (r *Router) Resume(hash string) error {
+	client, err := r.locate(hash)
+	if err != nil {
+		return err
+	}
+	return client.Resume(hash)
+}
+
+// Remove удаляет торрент из экземпляра, в котором он находится
+func (r *Router) Remove(hash string, deleteData bool) error {
+	client, err := r.locate(hash)
+	if err != nil {
+		return err
+	}
+	return client.Remove(hash, deleteData)
+}
+
+// route возвращает клиент экземпляра для загрузки в категорию. Если экземпляр не ответил
+// при последней проверке и его запасной доступен, возвращается запасной. Экземпляры
+// не опрашиваются при каждом вызове: состояние обновляет Monitor раз в healthInterval.
+func (r *Router) route(categoryID string) *Client {
+	instance := r.cfg.TransmissionInstanceFor(categoryID, r.userID)
+	client := r.clients[instance.Name]
+	if instance.Fallback == "" {
+		return client
+	}
+
+	err := r.lastHealth(instance.Name)
+	if err == nil {
+		return client
+	}
+	if r.lastHealth(instance.Fallback) != nil {
+		// Недоступны оба экземпляра: ошибка основного понятнее пользователю
+		return client
+	}
+
+	logger.Warn("Transmission instance is unreachable, using fallback", map[string]interface{}{
+		"instance": instance.Name,
+		"fallback": instance.Fallback,
+		"category": categoryID,
+		"error":    err.Error(),
+	})
+	return r.clients[instance.Fallback]
+}
+
+// recordHealth запоминает результат проверки экземпляра name. Возвращает false, если экземпляр
+// проверяется впервые, и результат предыдущей проверки.
+func (r *Router) recordHealth(name string, err error) (bool, error) {
+	r.health.mu.Lock()
+	defer r.health.mu.Unlock()
+	previous, checked := r.health.errors[name]
+	r.health.errors[name] = err
+	return checked, previous
+}
+
+// lastHealth возвращает ошибку последней проверки экземпляра name; nil — экземпляр доступен.
+// Еще не проверенный экземпляр считается доступным.
+func (r *Router) lastHealth(name string) error {
+	r.health.mu.Lock()
+	defer r.health.mu.Unlock()
+	return r.health.errors[name]
+}
+
+// locate возвращает клиент экземпляра, в котором находится торрент с хешем hash
+func (r *Router) locate(hash string) (*Client, error) {
+	var lastErr error
+	for _, instance := range r.cfg.TransmissionInstances {
+		client := r.clients[instance.Name]
+		infos, err := client.List([]string{hash})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(infos) > 0 {
+			return client, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, errors.NewTransmissionError("Torrent not found in Transmission", map[string]interface{}{
+		"hash": hash,
+	})
+}
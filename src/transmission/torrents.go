@@ -0,0 +1,181 @@
+package transmission
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hekmon/transmissionrpc"
+	"kinozal-bot/downloader"
+	"kinozal-bot/errors"
+)
+
+// torrentFields — поля, запрашиваемые у Transmission для TorrentInfo
+var torrentFields = []string{
+	"id", "hashString", "name", "downloadDir", "status", "percentDone", "eta",
+	"rateDownload", "rateUpload", "peersConnected", "totalSize", "uploadRatio",
+	"addedDate", "doneDate", "errorString",
+}
+
+// List возвращает состояние торрентов с указанными хешами.
+// Если хеши не указаны, возвращаются все торренты.
+func (c *Client) List(hashes []string) ([]downloader.TorrentInfo, error) {
+	torrents, err := c.torrents(hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]downloader.TorrentInfo, 0, len(torrents))
+	for _, t := range torrents {
+		infos = append(infos, toTorrentInfo(t))
+	}
+	return infos, nil
+}
+
+// Get возвращает состояние торрента по хешу
+func (c *Client) Get(hash string) (*downloader.TorrentInfo, error) {
+	t, err := c.torrent(hash)
+	if err != nil {
+		return nil, err
+	}
+	info := toTorrentInfo(t)
+	return &info, nil
+}
+
+// Pause ставит торрент на паузу
+func (c *Client) Pause(hash string) error {
+	client, err := newClient(c.instance)
+	if err != nil {
+		return err
+	}
+	if err := client.TorrentStopHashes([]string{hash}); err != nil {
+		return errors.NewTransmissionError("Failed to stop torrent", map[string]interface{}{
+			"hash":  hash,
+			"error": err.Error(),
+		})
+	}
+	return nil
+}
+
+// Resume возобновляет загрузку торрента
+func (c *Client) Resume(hash string) error {
+	client, err := newClient(c.instance)
+	if err != nil {
+		return err
+	}
+	if err := client.TorrentStartHashes([]string{hash}); err != nil {
+		return errors.NewTransmissionError("Failed to start torrent", map[string]interface{}{
+			"hash":  hash,
+			"error": err.Error(),
+		})
+	}
+	return nil
+}
+
+// Remove удаляет торрент из Transmission, при deleteData — вместе с загруженными файлами.
+// transmissionrpc удаляет торренты только по идентификаторам, поэтому сначала ищем торрент по хешу.
+func (c *Client) Remove(hash string, deleteData bool) error {
+	t, err := c.torrent(hash)
+	if err != nil {
+		return err
+	}
+	client, err := newClient(c.instance)
+	if err != nil {
+		return err
+	}
+	err = client.TorrentRemove(&transmissionrpc.TorrentRemovePayload{
+		IDs:             []int64{*t.ID},
+		DeleteLocalData: deleteData,
+	})
+	if err != nil {
+		return errors.NewTransmissionError("Failed to remove torrent", map[string]interface{}{
+			"hash":        hash,
+			"delete_data": deleteData,
+			"error":       err.Error(),
+		})
+	}
+	return nil
+}
+
+// torrents запрашивает у Transmission торренты с указанными хешами, без хешей — все
+func (c *Client) torrents(hashes []string) ([]*transmissionrpc.Torrent, error) {
+	client, err := newClient(c.instance)
+	if err != nil {
+		return nil, err
+	}
+
+	var torrents []*transmissionrpc.Torrent
+	if len(hashes) == 0 {
+		torrents, err = client.TorrentGet(torrentFields, nil)
+	} else {
+		torrents, err = client.TorrentGetHashes(torrentFields, hashes)
+	}
+	if err != nil {
+		return nil, errors.NewTransmissionError("Failed to get torrents from Transmission", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	return torrents, nil
+}
+
+// torrent запрашивает у Transmission торрент по хешу
+func (c *Client) torrent(hash string) (*transmissionrpc.Torrent, error) {
+	torrents, err := c.torrents([]string{hash})
+	if err != nil {
+		return nil, err
+	}
+	if len(torrents) == 0 || torrents[0].ID == nil {
+		return nil, errors.NewTransmissionError("Torrent not found in Transmission", map[string]interface{}{
+			"hash": hash,
+		})
+	}
+	return torrents[0], nil
+}
+
+// toTorrentInfo переводит ответ transmissionrpc в TorrentInfo
+func toTorrentInfo(t *transmissionrpc.Torrent) downloader.TorrentInfo {
+	info := downloader.TorrentInfo{ETA: -1}
+	if t.HashString != nil {
+		info.Hash = strings.ToLower(*t.HashString)
+	}
+	if t.Name != nil {
+		info.Name = *t.Name
+	}
+	if t.DownloadDir != nil {
+		info.DownloadDir = *t.DownloadDir
+	}
+	if t.Status != nil {
+		info.Status = t.Status.String()
+		info.Stopped = *t.Status == transmissionrpc.TorrentStatusStopped
+	}
+	if t.PercentDone != nil {
+		info.PercentDone = *t.PercentDone
+	}
+	if t.Eta != nil && *t.Eta >= 0 {
+		info.ETA = time.Duration(*t.Eta) * time.Second
+	}
+	if t.RateDownload != nil {
+		info.RateDownload = *t.RateDownload
+	}
+	if t.RateUpload != nil {
+		info.RateUpload = *t.RateUpload
+	}
+	if t.PeersConnected != nil {
+		info.PeersConnected = *t.PeersConnected
+	}
+	if t.TotalSize != nil {
+		info.TotalSize = int64(t.TotalSize.Byte())
+	}
+	if t.UploadRatio != nil {
+		info.UploadRatio = *t.UploadRatio
+	}
+	if t.AddedDate != nil {
+		info.AddedDate = *t.AddedDate
+	}
+	if t.DoneDate != nil {
+		info.DoneDate = *t.DoneDate
+	}
+	if t.ErrorString != nil {
+		info.ErrorString = *t.ErrorString
+	}
+	return info
+}
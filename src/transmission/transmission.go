@@ -2,17 +2,14 @@ package transmission
 
 import (
 	"encoding/base64"
-	"fmt"
-	"io"
-	"log"
-	"os"
+	"strings"
+	"time"
 
-	"github.com/hekmon/transmissionrpc"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"kinozal-bot/fileutils"
-	"kinozal-bot/logger"
-	"kinozal-bot/errors"
+	"github.com/hekmon/transmissionrpc"
 	"kinozal-bot/config"
+	"kinozal-bot/downloader"
+	"kinozal-bot/errors"
 )
 
 // BotInterface определяет необходимые методы для взаимодействия с Telegram Bot API
@@ -22,85 +19,124 @@ type BotInterface interface {
 	AnswerCallbackQuery(callbackConfig tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error)
 }
 
-// fileToBase64 конвертирует файл в строку Base64
-func fileToBase64(file *os.File) (string, error) {
-	content, err := io.ReadAll(file)
-	if err != nil {
-		return "", err
-	}
-	return base64.StdEncoding.EncodeToString(content), nil
+// rpcTimeout ограничивает время ответа RPC, чтобы недоступный экземпляр быстро уступал запасному
+const rpcTimeout = 30 * time.Second
+
+// Client передает загрузки в один экземпляр Transmission через RPC
+type Client struct {
+	instance config.TransmissionInstance
+}
+
+// New создает клиент экземпляра Transmission
+func New(instance config.TransmissionInstance) *Client {
+	return &Client{instance: instance}
+}
+
+// Name возвращает название клиента для сообщений пользователю
+func (c *Client) Name() string {
+	return "Transmission"
 }
 
-// AddToTransmission добавляет торрент в Transmission
-func AddToTransmission(torrentPath, downloadPath, kzName string, chatID int64, bot BotInterface) error {
-	cfg, err := config.LoadConfig()
+// AddFile добавляет торрент в Transmission в папку категории и возвращает его хеш
+func (c *Client) AddFile(content []byte, category config.Category, files downloader.FileChoice) (string, error) {
+	client, err := newClient(c.instance)
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		return "", err
 	}
 
-	// Подключение к Transmission RPC
-	client, err := transmissionrpc.New(cfg.Transmission.Host, cfg.Transmission.Auth.Username, cfg.Transmission.Auth.Password, &transmissionrpc.AdvancedConfig{
-		HTTPS: false,
-		Port:  uint16(cfg.Transmission.Port), // Исправлено
+	downloadPath := category.Path
+	metaInfo := base64.StdEncoding.EncodeToString(content)
+	added, err := client.TorrentAdd(&transmissionrpc.TorrentAddPayload{
+		DownloadDir:   &downloadPath,
+		MetaInfo:      &metaInfo,
+		FilesUnwanted: files.Unwanted,
+		PriorityHigh:  files.High,
 	})
 	if err != nil {
-		return errors.NewTransmissionError("Failed to connect to Transmission RPC", map[string]interface{}{
+		return "", errors.NewTransmissionError("Failed to add torrent to Transmission", map[string]interface{}{
 			"error": err.Error(),
 		})
 	}
 
-	// Открываем файл торрента
-	torrentFile, err := os.Open(torrentPath)
+	applyCategory(c.instance, client, added, category)
+	return addedHash(added), nil
+}
+
+// AddMagnet добавляет торрент в Transmission по magnet-ссылке и возвращает его хеш
+func (c *Client) AddMagnet(link string, category config.Category) (string, error) {
+	client, err := newClient(c.instance)
 	if err != nil {
-		return errors.NewTransmissionError("Failed to open torrent file", map[string]interface{}{
-			"torrent_path": torrentPath,
-			"error":        err.Error(),
-		})
+		return "", err
 	}
-	defer torrentFile.Close()
 
-	// Конвертируем торрент-файл в Base64
-	metaInfo, err := fileToBase64(torrentFile)
+	// Transmission принимает magnet-ссылку в поле filename
+	downloadPath := category.Path
+	added, err := client.TorrentAdd(&transmissionrpc.TorrentAddPayload{
+		DownloadDir: &downloadPath,
+		Filename:    &link,
+	})
 	if err != nil {
-		return errors.NewTransmissionError("Failed to encode torrent file to Base64", map[string]interface{}{
-			"torrent_path": torrentPath,
-			"error":        err.Error(),
+		return "", errors.NewTransmissionError("Failed to add magnet link to Transmission", map[string]interface{}{
+			"magnet": link,
+			"error":  err.Error(),
 		})
 	}
 
-	// Добавляем торрент в Transmission
-	_, err = client.TorrentAdd(&transmissionrpc.TorrentAddPayload{
-		DownloadDir: &downloadPath,
-		MetaInfo:    &metaInfo, // Исправлено
-	})
+	applyCategory(c.instance, client, added, category)
+	return addedHash(added), nil
+}
+
+// FreeSpace возвращает свободное место в папке path по данным Transmission, байт
+func (c *Client) FreeSpace(path string) (int64, error) {
+	client, err := newClient(c.instance)
 	if err != nil {
-		return errors.NewTransmissionError("Failed to add torrent to Transmission", map[string]interface{}{
+		return 0, err
+	}
+	free, err := client.FreeSpace(path)
+	if err != nil {
+		return 0, errors.NewTransmissionError("Failed to get free space from Transmission", map[string]interface{}{
+			"path":  path,
 			"error": err.Error(),
 		})
 	}
+	return int64(free.Byte()), nil
+}
 
-	// Удаляем торрент-файл после добавления
-	err = fileutils.CleanupTorrentFile(torrentPath)
+// Ping проверяет, что RPC экземпляра отвечает
+func (c *Client) Ping() error {
+	client, err := newClient(c.instance)
 	if err != nil {
-		logger.Error("Failed to cleanup torrent file", map[string]interface{}{
-			"torrent_path": torrentPath,
-			"error":        err.Error(),
+		return err
+	}
+	if _, _, _, err := client.RPCVersion(); err != nil {
+		return errors.NewTransmissionError("Transmission RPC is unreachable", map[string]interface{}{
+			"instance": c.instance.Name,
+			"error":    err.Error(),
 		})
 	}
+	return nil
+}
 
-	// Отправляем сообщение пользователю
-	message := fmt.Sprintf("Торрент %s добавлен в Transmission и будет загружен в папку \"%s\".", kzName, downloadPath)
-	err = bot.SendMessage(chatID, message)
+// newClient создает клиент Transmission RPC для экземпляра
+func newClient(instance config.TransmissionInstance) (*transmissionrpc.Client, error) {
+	client, err := transmissionrpc.New(instance.Host, instance.Username, instance.Password, &transmissionrpc.AdvancedConfig{
+		HTTPS:       false,
+		Port:        uint16(instance.Port),
+		HTTPTimeout: rpcTimeout,
+	})
 	if err != nil {
-		logger.Error("Failed to send message to Telegram", map[string]interface{}{
-			"chat_id": chatID,
-			"error":   err.Error(),
+		return nil, errors.NewTransmissionError("Failed to connect to Transmission RPC", map[string]interface{}{
+			"instance": instance.Name,
+			"error":    err.Error(),
 		})
 	}
+	return client, nil
+}
 
-	logger.Info("Torrent added to Transmission successfully", map[string]interface{}{
-		"torrent_name": kzName,
-		"download_dir": downloadPath,
-	})
-	return nil
-}
\ No newline at end of file
+// addedHash возвращает хеш добавленного торрента в нижнем регистре
+func addedHash(added *transmissionrpc.Torrent) string {
+	if added == nil || added.HashString == nil {
+		return ""
+	}
+	return strings.ToLower(*added.HashString)
+}
@@ -4,19 +4,26 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"kinozal-bot/config"
 	"kinozal-bot/logger"
+	"kinozal-bot/store"
 )
 
-func handleAddUser(bot *tgbotapi.BotAPI, cfg *config.Config, chatID int64, args string) {
+func handleAddUser(bot *tgbotapi.BotAPI, cfg *config.Config, db store.Store, chatID int64, args string) {
 	userID, err := strconv.Atoi(args)
 	if err != nil || userID <= 0 {
 		bot.Send(tgbotapi.NewMessage(chatID, "Укажите корректный ID пользователя."))
 		return
 	}
 
+	if userID == cfg.Bot.AdminID {
+		bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Пользователь %d — администратор бота.", userID)))
+		return
+	}
+
 	for _, id := range cfg.Bot.AllowedUsers {
 		if id == userID {
 			bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Пользователь %d уже добавлен.", userID)))
@@ -24,19 +31,20 @@ func handleAddUser(bot *tgbotapi.BotAPI, cfg *config.Config, chatID int64, args
 		}
 	}
 
-	cfg.Bot.AllowedUsers = append(cfg.Bot.AllowedUsers, userID)
-	if err := config.SaveUsersToFile(cfg); err != nil {
+	user := store.User{ID: int64(userID), Role: store.RoleUser, AddedAt: time.Now()}
+	if err := db.Put(store.BucketUsers, store.IDKey(user.ID), user); err != nil {
 		logger.Error("Failed to save users", map[string]interface{}{
 			"error": err.Error(),
 		})
 		bot.Send(tgbotapi.NewMessage(chatID, "Ошибка сохранения пользователей."))
 		return
 	}
+	cfg.Bot.AllowedUsers = append(cfg.Bot.AllowedUsers, userID)
 
 	bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Пользователь %d добавлен в список разрешенных.", userID)))
 }
 
-func handleRemoveUser(bot *tgbotapi.BotAPI, cfg *config.Config, chatID int64, args string) {
+func handleRemoveUser(bot *tgbotapi.BotAPI, cfg *config.Config, db store.Store, chatID int64, args string) {
 	userID, err := strconv.Atoi(args)
 	if err != nil || userID <= 0 {
 		bot.Send(tgbotapi.NewMessage(chatID, "Укажите корректный ID пользователя."))
@@ -58,21 +66,20 @@ func handleRemoveUser(bot *tgbotapi.BotAPI, cfg *config.Config, chatID int64, ar
 		return
 	}
 
-	cfg.Bot.AllowedUsers = newAllowedUsers
-	if err := config.SaveUsersToFile(cfg); err != nil {
+	if err := db.Delete(store.BucketUsers, store.IDKey(int64(userID))); err != nil {
 		logger.Error("Failed to save users", map[string]interface{}{
 			"error": err.Error(),
 		})
 		bot.Send(tgbotapi.NewMessage(chatID, "Ошибка сохранения пользователей."))
 		return
 	}
+	cfg.Bot.AllowedUsers = newAllowedUsers
 
 	bot.Send(tgbotapi.NewMessage(chatID, fmt.Sprintf("Пользователь %d удален из списка разрешенных.", userID)))
 }
 
 // HandleUserCommands обрабатывает команды для управления пользователями
-// HandleUserCommands обрабатывает команды для управления пользователями
-func HandleUserCommands(bot *tgbotapi.BotAPI, cfg *config.Config, chatID int64, command string, args string) {
+func HandleUserCommands(bot *tgbotapi.BotAPI, cfg *config.Config, db store.Store, chatID int64, command string, args string) {
 	if chatID != int64(cfg.Bot.AdminID) {
 		bot.Send(tgbotapi.NewMessage(chatID, "У вас нет прав для выполнения этой команды."))
 		return
@@ -80,9 +87,9 @@ func HandleUserCommands(bot *tgbotapi.BotAPI, cfg *config.Config, chatID int64,
 
 	switch command {
 	case "adduser":
-		handleAddUser(bot, cfg, chatID, args)
+		handleAddUser(bot, cfg, db, chatID, args)
 	case "removeuser":
-		handleRemoveUser(bot, cfg, chatID, args)
+		handleRemoveUser(bot, cfg, db, chatID, args)
 	case "listusers":
 		handleListUsers(bot, cfg, chatID)
 	default:
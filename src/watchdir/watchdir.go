@@ -0,0 +1,143 @@
+package watchdir
+
+import (
+	"os"
+	"path/filepath"
+
+	"kinozal-bot/bencode"
+	"kinozal-bot/config"
+	"kinozal-bot/downloader"
+	"kinozal-bot/errors"
+	"kinozal-bot/logger"
+)
+
+// Client кладет .torrent-файлы в папку наблюдения категории, откуда их забирает торрент-клиент
+// без RPC (rtorrent, Synology Download Station). Состояние торрентов такой клиент не сообщает,
+// поэтому остальные операции возвращают downloader.ErrUnsupported.
+type Client struct {
+	cfg *config.Config
+}
+
+// New создает клиент папок наблюдения по настройкам из конфигурации
+func New(cfg *config.Config) *Client {
+	return &Client{cfg: cfg}
+}
+
+// Name возвращает название клиента для сообщений вида "добавлен в ..."
+func (c *Client) Name() string {
+	return "папку наблюдения"
+}
+
+// AddFile записывает .torrent-файл в папку наблюдения категории и возвращает хеш торрента.
+// Файл сначала пишется под временным именем и затем переименовывается, чтобы торрент-клиент
+// не забрал недописанный файл. Выбор файлов в папку наблюдения передать нельзя.
+func (c *Client) AddFile(content []byte, category config.Category, files downloader.FileChoice) (string, error) {
+	meta, err := bencode.ParseMetainfo(content)
+	if err != nil {
+		return "", errors.NewDownloadClientError("Invalid torrent file", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	dir := c.cfg.WatchDir(category)
+	if dir == "" {
+		return "", errors.NewDownloadClientError("No watch folder configured for category", map[string]interface{}{
+			"category": category.ID,
+		})
+	}
+	if !files.IsEmpty() {
+		logger.Warn("Watch folder mode ignores file selection", map[string]interface{}{
+			"hash":     meta.InfoHash,
+			"category": category.ID,
+		})
+	}
+
+	if err := writeAtomic(dir, meta.InfoHash+".torrent", content); err != nil {
+		return "", errors.NewDownloadClientError("Failed to write torrent to watch folder", map[string]interface{}{
+			"dir":   dir,
+			"error": err.Error(),
+		})
+	}
+
+	logger.Info("Torrent placed into watch folder", map[string]interface{}{
+		"hash":     meta.InfoHash,
+		"dir":      dir,
+		"category": category.ID,
+	})
+	return meta.InfoHash, nil
+}
+
+// AddMagnet не поддерживается: в папку наблюдения можно положить только .torrent-файл
+func (c *Client) AddMagnet(link string, category config.Category) (string, error) {
+	return "", errors.NewDownloadClientError("Watch folder mode cannot add magnet links", map[string]interface{}{
+		"magnet": link,
+	})
+}
+
+// List не поддерживается
+func (c *Client) List(hashes []string) ([]downloader.TorrentInfo, error) {
+	return nil, downloader.ErrUnsupported
+}
+
+// Get не поддерживается
+func (c *Client) Get(hash string) (*downloader.TorrentInfo, error) {
+	return nil, downloader.ErrUnsupported
+}
+
+// Pause не поддерживается
+func (c *Client) Pause(hash string) error {
+	return downloader.ErrUnsupported
+}
+
+// Resume не поддерживается
+func (c *Client) Resume(hash string) error {
+	return downloader.ErrUnsupported
+}
+
+// Remove не поддерживается
+func (c *Client) Remove(hash string, deleteData bool) error {
+	return downloader.ErrUnsupported
+}
+
+// FreeSpace не поддерживается
+func (c *Client) FreeSpace(path string) (int64, error) {
+	return 0, downloader.ErrUnsupported
+}
+
+// writeAtomic записывает файл name в папку dir через временный файл в той же папке.
+// Временное имя начинается с точки и не оканчивается на .torrent, чтобы клиенты его не подхватили.
+func writeAtomic(dir, name string, content []byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	// Клиенту нужно прочитать файл, а CreateTemp создает его с правами 0600
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(dir, name)); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,414 @@
+package watchlist
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"kinozal-bot/callbacks"
+	"kinozal-bot/config"
+	"kinozal-bot/logger"
+	"kinozal-bot/store"
+	"kinozal-bot/torrent"
+	"kinozal-bot/transmission"
+)
+
+// checkInterval — период повторного выполнения сохраненных поисков
+const checkInterval = 1 * time.Hour
+
+// maxPerUser — сколько сохраненных поисков может быть у одного пользователя
+const maxPerUser = 20
+
+// maxSeen — сколько ID уже показанных раздач хранится для одного поиска
+const maxSeen = 500
+
+// maxAnnounced — сколько новых раздач перечисляется в одном уведомлении
+const maxAnnounced = 10
+
+// SavedSearch — сохраненный поиск пользователя
+type SavedSearch struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	ChatID    int64     `json:"chat_id"`
+	Query     string    `json:"query"` // запрос вместе с фильтрами, как его ввел пользователь
+	Seen      []string  `json:"seen"`  // ID раздач, о которых пользователь уже знает
+	CreatedAt time.Time `json:"created_at"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Watchlist хранит сохраненные поиски и периодически сообщает о новых раздачах
+type Watchlist struct {
+	bot     transmission.BotInterface
+	cfg     *config.Config
+	session *torrent.KinozalSession
+	db      store.Store
+	store   *callbacks.Store
+
+	mu     sync.Mutex
+	items  []*SavedSearch
+	nextID int64
+}
+
+// New создает список наблюдения и загружает сохраненные поиски
+func New(bot transmission.BotInterface, cfg *config.Config, session *torrent.KinozalSession, db store.Store, store *callbacks.Store) *Watchlist {
+	w := &Watchlist{
+		bot:     bot,
+		cfg:     cfg,
+		session: session,
+		db:      db,
+		store:   store,
+		nextID:  1,
+	}
+
+	if err := w.load(); err != nil {
+		logger.Warn("Failed to load watchlist", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+
+	return w
+}
+
+// HandleWatch обрабатывает команду /watch <запрос с фильтрами>
+func (w *Watchlist) HandleWatch(chatID, userID int64, args string) {
+	args = strings.TrimSpace(args)
+	query, filters, err := torrent.ParseSearchQuery(args)
+	if err != nil {
+		w.bot.SendMessage(chatID, fmt.Sprintf("❌ Ошибка в фильтрах: %s", err.Error()))
+		return
+	}
+	if query == "" && filters.IsEmpty() {
+		w.bot.SendMessage(chatID, "Укажите запрос для наблюдения. Например: /watch Дюна q:2160p")
+		return
+	}
+
+	w.mu.Lock()
+	count := 0
+	for _, item := range w.items {
+		if item.UserID != userID {
+			continue
+		}
+		count++
+		if strings.EqualFold(item.Query, args) {
+			w.mu.Unlock()
+			w.bot.SendMessage(chatID, fmt.Sprintf("Запрос «%s» уже есть в списке наблюдения.", args))
+			return
+		}
+	}
+	w.mu.Unlock()
+	if count >= maxPerUser {
+		w.bot.SendMessage(chatID, fmt.Sprintf("❌ Можно сохранить не более %d запросов. Удалите лишние через /watchlist.", maxPerUser))
+		return
+	}
+
+	if err := w.session.EnsureLoggedIn(); err != nil {
+		w.bot.SendMessage(chatID, "❌ Ошибка при входе на Kinozal. Попробуйте позже.")
+		return
+	}
+
+	// Текущие результаты считаем уже известными, чтобы уведомлять только о новых
+	results, err := torrent.SearchTorrents(w.session, query, filters)
+	if err != nil {
+		logger.Error("Failed to run saved search", map[string]interface{}{
+			"query": args,
+			"error": err.Error(),
+		})
+		w.bot.SendMessage(chatID, "❌ Ошибка поиска на Kinozal. Попробуйте позже.")
+		return
+	}
+
+	item := &SavedSearch{
+		UserID:    userID,
+		ChatID:    chatID,
+		Query:     args,
+		CreatedAt: time.Now(),
+		CheckedAt: time.Now(),
+	}
+	for _, result := range results {
+		item.Seen = append(item.Seen, result.ID)
+	}
+
+	w.mu.Lock()
+	item.ID = w.nextID
+	w.nextID++
+	w.items = append(w.items, item)
+	w.mu.Unlock()
+	w.save()
+
+	logger.Info("Saved search added", map[string]interface{}{
+		"id":      item.ID,
+		"user_id": userID,
+		"query":   args,
+	})
+
+	w.bot.SendMessage(chatID, fmt.Sprintf("👀 Запрос «%s» сохранен. Сейчас найдено раздач: %d. Я сообщу, когда появятся новые.", args, len(results)))
+}
+
+// HandleList обрабатывает команду /watchlist: показывает сохраненные поиски пользователя с кнопками удаления
+func (w *Watchlist) HandleList(chatID, userID int64) {
+	w.mu.Lock()
+	var own []SavedSearch
+	for _, item := range w.items {
+		if item.UserID == userID {
+			own = append(own, *item)
+		}
+	}
+	w.mu.Unlock()
+
+	if len(own) == 0 {
+		w.bot.SendMessage(chatID, "Список наблюдения пуст. Добавьте запрос: /watch <запрос с фильтрами>")
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("👀 Сохраненные поиски:\n\n")
+	var keyboardRows [][]tgbotapi.InlineKeyboardButton
+	for i, item := range own {
+		b.WriteString(fmt.Sprintf("%d. %s\n", i+1, item.Query))
+		button := tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑 Удалить %d", i+1), w.store.Put(callbacks.Action{
+			Kind:   callbacks.KindUnwatch,
+			ItemID: item.ID,
+		}))
+		keyboardRows = append(keyboardRows, tgbotapi.NewInlineKeyboardRow(button))
+	}
+
+	msg := tgbotapi.NewMessage(chatID, b.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboardRows...)
+	if _, err := w.bot.Send(msg); err != nil {
+		logger.Error("Failed to send watchlist", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}
+
+// HandleCallback обрабатывает кнопку удаления сохраненного поиска
+func (w *Watchlist) HandleCallback(callback *tgbotapi.CallbackQuery, action callbacks.Action) {
+	answer := func(text string) {
+		if _, err := w.bot.AnswerCallbackQuery(tgbotapi.NewCallback(callback.ID, text)); err != nil {
+			logger.Warn("Failed to answer callback query", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	w.mu.Lock()
+	var removed *SavedSearch
+	for i, item := range w.items {
+		if item.ID != action.ItemID {
+			continue
+		}
+		if item.UserID != callback.From.ID && callback.From.ID != int64(w.cfg.Bot.AdminID) {
+			w.mu.Unlock()
+			answer("Это не ваш запрос")
+			return
+		}
+		removed = item
+		w.items = append(w.items[:i], w.items[i+1:]...)
+		break
+	}
+	w.mu.Unlock()
+
+	if removed == nil {
+		answer("Запрос уже удален")
+		return
+	}
+	w.save()
+
+	logger.Info("Saved search removed", map[string]interface{}{
+		"id":      removed.ID,
+		"user_id": callback.From.ID,
+	})
+	w.bot.SendMessage(callback.Message.Chat.ID, fmt.Sprintf("🗑 Запрос «%s» удален из списка наблюдения.", removed.Query))
+	answer("Удалено")
+}
+
+// Run периодически выполняет сохраненные поиски до закрытия канала stop
+func (w *Watchlist) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.checkAll(stop)
+		}
+	}
+}
+
+// checkAll выполняет все сохраненные поиски по очереди
+func (w *Watchlist) checkAll(stop <-chan struct{}) {
+	w.mu.Lock()
+	items := make([]*SavedSearch, len(w.items))
+	copy(items, w.items)
+	w.mu.Unlock()
+
+	if len(items) == 0 {
+		return
+	}
+
+	if err := w.session.EnsureLoggedIn(); err != nil {
+		logger.Warn("Skipping watchlist check: Kinozal login failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	// Частоту запросов к Kinozal ограничивает сессия
+	for _, item := range items {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		w.check(item)
+	}
+	w.save()
+}
+
+// check выполняет сохраненный поиск и уведомляет пользователя о раздачах, которых он еще не видел
+func (w *Watchlist) check(item *SavedSearch) {
+	query, filters, err := torrent.ParseSearchQuery(item.Query)
+	if err != nil {
+		logger.Warn("Invalid saved search", map[string]interface{}{
+			"id":    item.ID,
+			"query": item.Query,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	results, err := torrent.SearchTorrents(w.session, query, filters)
+	if err != nil {
+		logger.Warn("Saved search failed", map[string]interface{}{
+			"id":    item.ID,
+			"query": item.Query,
+			"error": err.Error(),
+		})
+		return
+	}
+
+	w.mu.Lock()
+	seen := make(map[string]bool, len(item.Seen))
+	for _, id := range item.Seen {
+		seen[id] = true
+	}
+	var fresh []torrent.SearchResult
+	for _, result := range results {
+		if !seen[result.ID] {
+			fresh = append(fresh, result)
+			item.Seen = append(item.Seen, result.ID)
+		}
+	}
+	if len(item.Seen) > maxSeen {
+		item.Seen = item.Seen[len(item.Seen)-maxSeen:]
+	}
+	item.CheckedAt = time.Now()
+	w.mu.Unlock()
+
+	if len(fresh) == 0 {
+		return
+	}
+
+	logger.Info("New releases for saved search", map[string]interface{}{
+		"id":    item.ID,
+		"query": item.Query,
+		"count": len(fresh),
+	})
+	w.notify(item, fresh)
+}
+
+// notify отправляет пользователю список новых раздач с кнопками для открытия карточек
+func (w *Watchlist) notify(item *SavedSearch, fresh []torrent.SearchResult) {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("🆕 Новые раздачи по запросу «%s»:\n\n", item.Query))
+
+	var keyboardRows [][]tgbotapi.InlineKeyboardButton
+	for i, result := range fresh {
+		if i == maxAnnounced {
+			b.WriteString(fmt.Sprintf("… и еще %d\n", len(fresh)-maxAnnounced))
+			break
+		}
+		b.WriteString(fmt.Sprintf("%d. 🎬 %s\nSeeders: %d | Size: %s\n\n", i+1, result.Title, result.Seeders, result.Size))
+		button := tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("%d. %s", i+1, result.Title), w.store.Put(callbacks.Action{
+			Kind:    callbacks.KindDetails,
+			KzID:    result.ID,
+			Name:    result.Title,
+			Section: torrent.Classify(result),
+		}))
+		keyboardRows = append(keyboardRows, tgbotapi.NewInlineKeyboardRow(button))
+	}
+
+	msg := tgbotapi.NewMessage(item.ChatID, b.String())
+	msg.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(keyboardRows...)
+	if _, err := w.bot.Send(msg); err != nil {
+		logger.Error("Failed to send watchlist notification", map[string]interface{}{
+			"chat_id": item.ChatID,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// load читает сохраненные поиски из базы данных
+func (w *Watchlist) load() error {
+	var items []*SavedSearch
+	err := w.db.ForEach(store.BucketWatchlist, func(key string, decode func(interface{}) error) error {
+		item := &SavedSearch{}
+		if err := decode(item); err != nil {
+			return err
+		}
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.items = items
+	for _, item := range items {
+		if item.ID >= w.nextID {
+			w.nextID = item.ID + 1
+		}
+	}
+	return nil
+}
+
+// save сохраняет поиски в базу данных и удаляет из нее удаленные пользователем
+func (w *Watchlist) save() {
+	w.mu.Lock()
+	items := make(map[string]SavedSearch, len(w.items))
+	for _, item := range w.items {
+		saved := *item
+		saved.Seen = append([]string(nil), item.Seen...)
+		items[store.IDKey(item.ID)] = saved
+	}
+	w.mu.Unlock()
+
+	var stale []string
+	err := w.db.ForEach(store.BucketWatchlist, func(key string, decode func(interface{}) error) error {
+		if _, ok := items[key]; !ok {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+	for _, key := range stale {
+		if err == nil {
+			err = w.db.Delete(store.BucketWatchlist, key)
+		}
+	}
+	for key, item := range items {
+		if err == nil {
+			err = w.db.Put(store.BucketWatchlist, key, item)
+		}
+	}
+	if err != nil {
+		logger.Error("Failed to save watchlist", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+}